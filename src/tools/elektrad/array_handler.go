@@ -0,0 +1,461 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+var errArrayIndex = errors.New("array index out of range")
+
+type arrayElementResult struct {
+	Index int               `json:"index"`
+	Name  string            `json:"name"`
+	Value interface{}       `json:"value,omitempty"`
+	Meta  map[string]string `json:"meta,omitempty"`
+}
+
+// elektraArray is an Elektra array that has been cut from a KeySet.
+type elektraArray struct {
+	parent   elektra.Key
+	elements []*arrayElement
+}
+
+type arrayElement struct {
+	// name is the name of the element key
+	name string
+	// keys contains the element key and all keys below it
+	keys []elektra.Key
+}
+
+// getArrayHandler lists the elements of an Elektra array in order.
+//
+// Arguments:
+//		keyName		the name of the array parent. URL path param.
+//		typed		if `true` values are converted according to their
+//					`type` metadata. Optional query parameter (bool).
+//
+// Response Code:
+//		200 OK if the request is successfull.
+//		400 Bad Request if the key name is invalid or the key is not an array.
+//
+// Returns: JSON array of `arrayElementResult` structs.
+//
+// Example: `curl localhost:33333/kdbArray/user/test/hosts`
+func (s *server) getArrayHandler(w http.ResponseWriter, r *http.Request) {
+	parent, err := elektra.NewKey(parseKeyNameFromURL(r))
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer parent.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, parent)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	dup := ks.Duplicate()
+	defer dup.Close()
+
+	subtree := dup.Cut(parent)
+	defer subtree.Close()
+
+	array, err := parseArray(parent, subtree)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	typed := parseTyped(r)
+	result := []*arrayElementResult{}
+
+	for _, element := range array.elements {
+		index, _ := parseArrayIndex(element.baseName(array.parent))
+
+		elementResult := &arrayElementResult{
+			Index: index,
+			Name:  element.name,
+		}
+
+		if k := element.key(); k != nil {
+			elementResult.Value = lookupValue(k, typed)
+			elementResult.Meta = k.MetaMap()
+		}
+
+		result = append(result, elementResult)
+	}
+
+	writeResponse(w, result)
+}
+
+// postArrayHandler appends an element to an Elektra array or inserts it
+// at an index. Following elements are renumbered.
+//
+// Arguments:
+//		keyName		the name of the array parent. URL path param.
+//		index		the index of the new element. Optional query parameter (int).
+//					Default is the end of the array.
+//		value		the value of the new element. JSON POST body.
+//
+// Response Code:
+//		201 Created if the element was added.
+//		400 Bad Request if the key name, index or value is invalid.
+//
+// Returns: JSON marshaled `arrayElementResult` struct of the new element.
+//
+// Example: `curl -X POST -d '"example.com"' localhost:33333/kdbArray/user/test/hosts`
+func (s *server) postArrayHandler(w http.ResponseWriter, r *http.Request) {
+	value, err := jsonBody(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	parent, err := elektra.NewKey(parseKeyNameFromURL(r))
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer parent.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, parent)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var result *arrayElementResult
+
+	err = updateArray(handle, ks, parent, func(array *elektraArray) error {
+		index := len(array.elements)
+
+		if _, ok := r.URL.Query()["index"]; ok {
+			var err error
+
+			if index, err = parseIndex(r); err != nil {
+				return err
+			}
+		}
+
+		if index < 0 || index > len(array.elements) {
+			return fmt.Errorf("invalid index %d", index)
+		}
+
+		k, err := elektra.NewKey(array.parent.Name() + "/" + arrayElementName(index))
+
+		if err != nil {
+			return err
+		}
+
+		stringValue, err := typedToString(k, keyType(ks, k), value)
+
+		if err != nil {
+			k.Close()
+			return err
+		}
+
+		if err = k.SetString(stringValue); err != nil {
+			k.Close()
+			return err
+		}
+
+		array.insert(index, &arrayElement{
+			name: k.Name(),
+			keys: []elektra.Key{k},
+		})
+
+		result = &arrayElementResult{
+			Index: index,
+			Name:  k.Name(),
+			Value: stringValue,
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		writeArrayError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	created(w)
+	writeResponse(w, result)
+}
+
+// deleteArrayHandler removes an element from an Elektra array and
+// renumbers the following elements.
+//
+// Arguments:
+//		keyName		the name of the array parent. URL path param.
+//		index		the position of the element. Query parameter (int).
+//
+// Response Code:
+//		204 No Content if the element was removed.
+//		400 Bad Request if the key name or index is invalid.
+//		404 Not Found if the element does not exist.
+//
+// Example: `curl -X DELETE localhost:33333/kdbArray/user/test/hosts?index=1`
+func (s *server) deleteArrayHandler(w http.ResponseWriter, r *http.Request) {
+	index, err := parseIndex(r)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	parent, err := elektra.NewKey(parseKeyNameFromURL(r))
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer parent.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, parent)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = updateArray(handle, ks, parent, func(array *elektraArray) error {
+		if index < 0 || index >= len(array.elements) {
+			return errArrayIndex
+		}
+
+		array.elements = append(array.elements[:index], array.elements[index+1:]...)
+
+		return nil
+	})
+
+	if err != nil {
+		writeArrayError(w, err)
+		return
+	}
+
+	noContent(w)
+}
+
+// putArrayHandler reorders the elements of an Elektra array.
+//
+// Arguments:
+//		keyName		the name of the array parent. URL path param.
+//		order		the current positions of the elements in their new
+//					order, e.g. `[2, 0, 1]`. JSON int array PUT body.
+//
+// Response Code:
+//		204 No Content if the array was reordered.
+//		400 Bad Request if the key name or order is invalid.
+//
+// Example: `curl -X PUT -d '[1, 0]' localhost:33333/kdbArray/user/test/hosts`
+func (s *server) putArrayHandler(w http.ResponseWriter, r *http.Request) {
+	var order []int
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&order); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	parent, err := elektra.NewKey(parseKeyNameFromURL(r))
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer parent.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, parent)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = updateArray(handle, ks, parent, func(array *elektraArray) error {
+		if len(order) != len(array.elements) {
+			return fmt.Errorf("the order must contain %d positions", len(array.elements))
+		}
+
+		elements := make([]*arrayElement, len(order))
+		used := make([]bool, len(order))
+
+		for i, position := range order {
+			if position < 0 || position >= len(order) || used[position] {
+				return fmt.Errorf("invalid position %d", position)
+			}
+
+			used[position] = true
+			elements[i] = array.elements[position]
+		}
+
+		array.elements = elements
+
+		return nil
+	})
+
+	if err != nil {
+		writeArrayError(w, err)
+		return
+	}
+
+	noContent(w)
+}
+
+// updateArray cuts the array below `parent` from `ks`, modifies it and
+// commits the renumbered array. If anything fails the KeySet is restored.
+func updateArray(handle elektra.KDB, ks elektra.KeySet, parent elektra.Key, modify func(array *elektraArray) error) error {
+	oldKs := ks.Cut(parent)
+	defer oldKs.Close()
+
+	array, err := parseArray(parent, oldKs)
+
+	if err == nil {
+		err = modify(array)
+	}
+
+	if err == nil {
+		var newKs elektra.KeySet
+
+		if newKs, err = array.keySet(); err == nil {
+			defer newKs.Close()
+
+			ks.Append(newKs)
+
+			err = set(handle, ks, parent)
+		}
+	}
+
+	if err != nil {
+		// restore the session KeySet
+		ks.Cut(parent).Close()
+		ks.Append(oldKs)
+	}
+
+	return err
+}
+
+// parseArray groups the keys of `ks` below `parent` by array element. All
+// keys directly below `parent` must be array elements.
+func parseArray(parent elektra.Key, ks elektra.KeySet) (*elektraArray, error) {
+	array := &elektraArray{
+		parent: ks.Lookup(parent),
+	}
+
+	if array.parent == nil {
+		array.parent = parent
+	}
+
+	parentName := array.parent.Name()
+
+	var current *arrayElement
+
+	for _, k := range ks.ToSlice() {
+		parts := splitKeyName(relativeKeyName(parentName, k.Name()))
+
+		if len(parts) == 0 {
+			continue
+		}
+
+		if _, ok := parseArrayIndex(parts[0]); !ok {
+			return nil, fmt.Errorf("%s is not an array element", k.Name())
+		}
+
+		name := parentName + "/" + parts[0]
+
+		if current == nil || current.name != name {
+			current = &arrayElement{name: name}
+			array.elements = append(array.elements, current)
+		}
+
+		current.keys = append(current.keys, k)
+	}
+
+	return array, nil
+}
+
+func (a *elektraArray) insert(index int, element *arrayElement) {
+	a.elements = append(a.elements, nil)
+	copy(a.elements[index+1:], a.elements[index:])
+	a.elements[index] = element
+}
+
+// keySet returns the keys of the array with its elements renumbered from
+// `#0` and the `array` metadata of the parent updated.
+func (a *elektraArray) keySet() (elektra.KeySet, error) {
+	ks := elektra.NewKeySet()
+
+	parent := a.parent.Duplicate(elektra.KEY_CP_ALL)
+
+	lastIndex := ""
+
+	if len(a.elements) > 0 {
+		lastIndex = arrayElementName(len(a.elements) - 1)
+	}
+
+	if err := parent.SetMeta("array", lastIndex); err != nil {
+		return nil, err
+	}
+
+	ks.AppendKey(parent)
+
+	for i, element := range a.elements {
+		name := a.parent.Name() + "/" + arrayElementName(i)
+
+		for _, k := range element.keys {
+			ks.AppendKey(renameKey(k, element.name, name))
+		}
+	}
+
+	return ks, nil
+}
+
+func (e *arrayElement) key() elektra.Key {
+	if len(e.keys) > 0 && e.keys[0].Name() == e.name {
+		return e.keys[0]
+	}
+
+	return nil
+}
+
+func (e *arrayElement) baseName(parent elektra.Key) string {
+	return relativeKeyName(parent.Name(), e.name)
+}
+
+func parseIndex(r *http.Request) (int, error) {
+	return strconv.Atoi(r.URL.Query().Get("index"))
+}
+
+func writeArrayError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errArrayIndex) {
+		writeErrorCode(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeError(w, err)
+}
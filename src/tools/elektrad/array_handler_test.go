@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func setupArray(t *testing.T, keyName string, values ...string) {
+	t.Helper()
+
+	w := testPut(t, "/kdbTree/"+keyName, values)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "could not create array: %v", code)
+}
+
+func arrayValues(t *testing.T, keyName string) []string {
+	t.Helper()
+
+	w := testGet(t, "/kdbArray/"+keyName)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var elements []arrayElementResult
+	parseBody(t, w, &elements)
+
+	values := []string{}
+
+	for i, element := range elements {
+		Assertf(t, element.Index == i, "element %d has index %d", i, element.Index)
+
+		value, _ := element.Value.(string)
+		values = append(values, value)
+	}
+
+	return values
+}
+
+func TestPostArray(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdbarray/post"
+
+	setupArray(t, keyName, "a", "c")
+
+	w := testPost(t, "/kdbArray/"+keyName, "d")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusCreated, "wrong status code: %v", code)
+
+	w = testPost(t, "/kdbArray/"+keyName+"?index=1", "b")
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusCreated, "wrong status code: %v", code)
+
+	values := arrayValues(t, keyName)
+	parent := getKey(t, keyName)
+
+	removeTree(t, keyName)
+
+	Assertf(t, len(values) == 4 && values[0] == "a" && values[1] == "b" && values[2] == "c" && values[3] == "d", "wrong array %v", values)
+	Assertf(t, parent.Meta("array") == "#3", "wrong array metadata %q", parent.Meta("array"))
+}
+
+func TestDeleteArray(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdbarray/delete"
+
+	setupArray(t, keyName, "a", "b", "c")
+
+	w := testDelete(t, "/kdbArray/"+keyName+"?index=0", nil)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	w = testDelete(t, "/kdbArray/"+keyName+"?index=5", nil)
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusNotFound, "wrong status code: %v", code)
+
+	values := arrayValues(t, keyName)
+	removed := getKey(t, keyName+"/#2")
+
+	removeTree(t, keyName)
+
+	Assertf(t, len(values) == 2 && values[0] == "b" && values[1] == "c", "wrong array %v", values)
+	Assert(t, removed == nil, "last element was not renumbered")
+}
+
+func TestPutArray(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdbarray/put"
+
+	setupArray(t, keyName, "a", "b", "c")
+
+	w := testPut(t, "/kdbArray/"+keyName, []int{2, 0, 1})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	w = testPut(t, "/kdbArray/"+keyName, []int{0, 0, 1})
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusBadRequest, "wrong status code: %v", code)
+
+	values := arrayValues(t, keyName)
+
+	removeTree(t, keyName)
+
+	Assertf(t, len(values) == 3 && values[0] == "c" && values[1] == "a" && values[2] == "b", "wrong array %v", values)
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	elektra "go.libelektra.org/kdb"
+)
+
+// changeDetectionDelay collects the events of a single write, e.g. of
+// writing a temporary file and renaming it, into a single change.
+const changeDetectionDelay = 100 * time.Millisecond
+
+// mountpointsKey contains the mountpoints, the backend storing it is
+// resolved again after changes.
+const mountpointsKey = "system:/elektra/mountpoints"
+
+// fileNamespaces are the namespaces whose keys are stored in files.
+var fileNamespaces = []string{"spec", "dir", "user", "system"}
+
+// changeDetector watches the files of the mounted backends with inotify and
+// reports the mountpoints of modified files. It notices the changes of other
+// processes that do not send notifications, e.g. of `kdb set` or an editor.
+//
+// Only the files of the default resolver context are watched.
+type changeDetector struct {
+	// resolve returns the file of the backend mounted at a mountpoint
+	resolve func(mountpoint string) (string, error)
+	changed func(mountpoint string)
+	delay   time.Duration
+
+	watcher *fsnotify.Watcher
+	// files are the mountpoints by file, the directories of the files are
+	// watched because the resolver replaces the files on every write
+	files map[string][]string
+	dirs  map[string]bool
+	// missing are the directories of files that do not exist yet, their
+	// nearest existing parent directory is watched until they are created
+	missing map[string]bool
+}
+
+func newChangeDetector(resolve func(mountpoint string) (string, error), changed func(mountpoint string), delay time.Duration) (*changeDetector, error) {
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return nil, err
+	}
+
+	d := &changeDetector{
+		resolve: resolve,
+		changed: changed,
+		delay:   delay,
+		watcher: watcher,
+		dirs:    map[string]bool{},
+	}
+
+	if err = d.watchBackends(); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// watchBackends resolves the files of all mountpoints and watches their
+// directories.
+func (d *changeDetector) watchBackends() error {
+	mountpoints, err := backendMountpoints()
+
+	if err != nil {
+		return err
+	}
+
+	files := map[string][]string{}
+
+	for _, mountpoint := range mountpoints {
+		file, err := d.resolve(mountpoint)
+
+		// not every backend is stored in a file
+		if err != nil || file == "" {
+			continue
+		}
+
+		file = filepath.Clean(file)
+		files[file] = append(files[file], mountpoint)
+	}
+
+	d.watchFiles(files)
+
+	return nil
+}
+
+// watchFiles watches the directories of `files`. If a directory does not
+// exist yet, e.g. of `dir:/` before the first write, its nearest existing
+// parent directory is watched instead.
+func (d *changeDetector) watchFiles(files map[string][]string) {
+	dirs := map[string]bool{}
+	missing := map[string]bool{}
+
+	for file := range files {
+		dir := filepath.Dir(file)
+
+		if d.watchDir(dir, dirs) != dir {
+			missing[dir] = true
+		}
+	}
+
+	for dir := range d.dirs {
+		if !dirs[dir] {
+			d.watcher.Remove(dir)
+		}
+	}
+
+	d.files = files
+	d.dirs = dirs
+	d.missing = missing
+}
+
+// watchDir watches `dir` or its nearest parent directory that can be
+// watched and returns the watched directory.
+func (d *changeDetector) watchDir(dir string, dirs map[string]bool) string {
+	for {
+		if dirs[dir] {
+			return dir
+		}
+
+		if d.dirs[dir] || d.watcher.Add(dir) == nil {
+			dirs[dir] = true
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+
+		if parent == dir {
+			return ""
+		}
+
+		dir = parent
+	}
+}
+
+// createsMissing returns true if the created `path` is a missing directory
+// or one of its parents.
+func (d *changeDetector) createsMissing(path string) bool {
+	for dir := range d.missing {
+		if isBelowOrSamePath(dir, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isBelowOrSamePath returns true if `path` is `dir` or below it.
+func isBelowOrSamePath(path, dir string) bool {
+	separator := string(filepath.Separator)
+
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, separator)+separator)
+}
+
+// backendMountpoints returns the mountpoints and the root of every namespace
+// stored in files. Cascading mountpoints are returned once per namespace.
+func backendMountpoints() ([]string, error) {
+	h, err := newHandle()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeHandle(h)
+
+	parentKey, err := elektra.NewKey(mountpointsKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer parentKey.Close()
+
+	result := []string{"system:/elektra"}
+
+	for _, namespace := range fileNamespaces {
+		result = append(result, namespace+":/")
+	}
+
+	for _, k := range h.keySet.ToSlice() {
+		if !k.IsDirectlyBelow(parentKey) {
+			continue
+		}
+
+		mountpoint := k.BaseName()
+
+		if !strings.HasPrefix(mountpoint, "/") {
+			result = append(result, mountpoint)
+			continue
+		}
+
+		for _, namespace := range fileNamespaces {
+			result = append(result, namespace+":"+mountpoint)
+		}
+	}
+
+	return result, nil
+}
+
+// run reports the changes until the detector is closed.
+func (d *changeDetector) run() {
+	pending := map[string]bool{}
+
+	var timeout <-chan time.Time
+
+	for {
+		select {
+		case event, ok := <-d.watcher.Events:
+			if !ok {
+				return
+			}
+
+			name := filepath.Clean(event.Name)
+
+			if event.Op&fsnotify.Create != 0 && d.createsMissing(name) {
+				d.watchFiles(d.files)
+
+				// the files may have been written before their directory
+				// was watched
+				for file, mountpoints := range d.files {
+					if _, err := os.Stat(file); err == nil && isBelowOrSamePath(file, name) {
+						for _, mountpoint := range mountpoints {
+							pending[mountpoint] = true
+						}
+					}
+				}
+
+				if len(pending) > 0 && timeout == nil {
+					timeout = time.After(d.delay)
+				}
+
+				continue
+			}
+
+			mountpoints, ok := d.files[name]
+
+			if !ok || event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			for _, mountpoint := range mountpoints {
+				pending[mountpoint] = true
+			}
+
+			if timeout == nil {
+				timeout = time.After(d.delay)
+			}
+		case err, ok := <-d.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			log.Printf("change detection: %v", err)
+		case <-timeout:
+			d.report(pending)
+
+			pending = map[string]bool{}
+			timeout = nil
+		}
+	}
+}
+
+func (d *changeDetector) report(pending map[string]bool) {
+	var mountpoints []string
+
+	for mountpoint := range pending {
+		mountpoints = append(mountpoints, mountpoint)
+	}
+
+	sort.Strings(mountpoints)
+
+	for _, mountpoint := range mountpoints {
+		d.changed(mountpoint)
+	}
+
+	for _, mountpoint := range mountpoints {
+		if storesMountpoints(mountpoint) {
+			// backends may have been mounted or unmounted
+			if err := d.watchBackends(); err != nil {
+				log.Printf("change detection: could not resolve the backends: %v", err)
+			}
+
+			return
+		}
+	}
+}
+
+// storesMountpoints returns true if the backend mounted at `mountpoint`
+// stores the mountpoints.
+func storesMountpoints(mountpoint string) bool {
+	key, err := elektra.NewKey(mountpoint)
+
+	if err != nil {
+		return false
+	}
+
+	defer key.Close()
+
+	mountpoints, err := elektra.NewKey(mountpointsKey)
+
+	if err != nil {
+		return false
+	}
+
+	defer mountpoints.Close()
+
+	return mountpoints.IsBelowOrSame(key)
+}
+
+func (d *changeDetector) close() error {
+	return d.watcher.Close()
+}
+
+// backendFile returns the file of the backend mounted at `mountpoint` with
+// `kdb file`.
+func (s *server) backendFile(mountpoint string) (string, error) {
+	out, err := s.kdbCommand("file", mountpoint).Output()
+
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// handleRefresher refreshes the handles of the pool and the sessions after
+// changes of other processes, so that their KeySets are not outdated.
+type handleRefresher struct {
+	pool   *handlePool
+	notify chan struct{}
+}
+
+func newHandleRefresher(pool *handlePool) *handleRefresher {
+	return &handleRefresher{
+		pool:   pool,
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// changed notifies the refresher of a change, it does not block.
+func (r *handleRefresher) changed() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+		// a refresh is already pending
+	}
+}
+
+// run refreshes the handles after every notification.
+func (r *handleRefresher) run() {
+	for range r.notify {
+		r.pool.refreshAll()
+		refreshSessions()
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChangeDetector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elektrad")
+	Check(t, err, "could not create directory")
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "user.ecf")
+
+	resolve := func(mountpoint string) (string, error) {
+		if mountpoint == "user:/" {
+			return file, nil
+		}
+
+		return "", errors.New("not stored in a file")
+	}
+
+	changed := make(chan string, 10)
+
+	d, err := newChangeDetector(resolve, func(mountpoint string) {
+		changed <- mountpoint
+	}, 10*time.Millisecond)
+	Check(t, err, "could not create detector")
+	defer d.close()
+
+	go d.run()
+
+	expectChange := func() {
+		t.Helper()
+
+		select {
+		case mountpoint := <-changed:
+			Assertf(t, mountpoint == "user:/", "wrong mountpoint %s", mountpoint)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the change was not detected")
+		}
+	}
+
+	err = ioutil.WriteFile(file, []byte("a = 1"), 0600)
+	Check(t, err, "could not write file")
+
+	expectChange()
+
+	// the resolver writes a temporary file and renames it
+	tmp := filepath.Join(dir, "user.ecf.tmp")
+
+	err = ioutil.WriteFile(tmp, []byte("a = 2"), 0600)
+	Check(t, err, "could not write file")
+
+	err = os.Rename(tmp, file)
+	Check(t, err, "could not rename file")
+
+	expectChange()
+
+	// other files are ignored
+	err = ioutil.WriteFile(filepath.Join(dir, "other.ecf"), []byte("b = 1"), 0600)
+	Check(t, err, "could not write file")
+
+	select {
+	case mountpoint := <-changed:
+		t.Fatalf("unexpected change of %s", mountpoint)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestChangeDetectorMissingDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "elektrad")
+	Check(t, err, "could not create directory")
+	defer os.RemoveAll(dir)
+
+	// the directories are created on the first write
+	file := filepath.Join(dir, "config", "elektra", "user.ecf")
+
+	resolve := func(mountpoint string) (string, error) {
+		if mountpoint == "user:/" {
+			return file, nil
+		}
+
+		return "", errors.New("not stored in a file")
+	}
+
+	changed := make(chan string, 10)
+
+	d, err := newChangeDetector(resolve, func(mountpoint string) {
+		changed <- mountpoint
+	}, 10*time.Millisecond)
+	Check(t, err, "could not create detector")
+	defer d.close()
+
+	go d.run()
+
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	Check(t, err, "could not create directory")
+
+	err = ioutil.WriteFile(file, []byte("a = 1"), 0600)
+	Check(t, err, "could not write file")
+
+	select {
+	case mountpoint := <-changed:
+		Assertf(t, mountpoint == "user:/", "wrong mountpoint %s", mountpoint)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change was not detected")
+	}
+
+	// wait until the write is reported
+	time.Sleep(50 * time.Millisecond)
+
+	for len(changed) > 0 {
+		<-changed
+	}
+
+	err = ioutil.WriteFile(file, []byte("a = 2"), 0600)
+	Check(t, err, "could not write file")
+
+	select {
+	case mountpoint := <-changed:
+		Assertf(t, mountpoint == "user:/", "wrong mountpoint %s", mountpoint)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the change in the created directory was not detected")
+	}
+}
+
+func TestHandleRefresh(t *testing.T) {
+	keyName := "user:/tests/elektrad/refresh/key"
+
+	removeTree(t, "user:/tests/elektrad/refresh")
+	defer removeTree(t, "user:/tests/elektrad/refresh")
+
+	pool := initPool(1)
+
+	s := storeSession(pool, "refresh-test")
+	defer sessions.Delete("refresh-test")
+
+	before := s.handle.refreshed
+
+	// changed by another process
+	setupKey(t, keyName)
+
+	Assert(t, s.handle.keySet.LookupByName(keyName) == nil, "the key is visible before the refresh")
+
+	pool.refreshAll()
+	refreshSessions()
+
+	Assert(t, s.handle.keySet.LookupByName(keyName) != nil, "the key of the session handle was not refreshed")
+	Assert(t, s.handle.refreshed.After(before), "the refresh time was not updated")
+
+	h := pool.Get()
+	Assert(t, h.keySet.LookupByName(keyName) != nil, "the key of the pooled handle was not refreshed")
+}
+
+func TestRefreshedHeader(t *testing.T) {
+	w := testGet(t, "/version")
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+
+	refreshed, err := time.Parse(time.RFC3339Nano, w.Header().Get("X-Elektrad-Refreshed"))
+	Check(t, err, "invalid refresh time")
+
+	Assertf(t, time.Since(refreshed) < time.Minute, "wrong refresh time %v", refreshed)
+}
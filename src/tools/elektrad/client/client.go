@@ -0,0 +1,358 @@
+// Package client implements a client for the HTTP API of elektrad.
+//
+// The client keeps the session cookie of elektrad, so that all requests of
+// a client are served by the same KDB handle. Key names must contain a
+// namespace, e.g. `user:/sw/app`.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client is a client for a single elektrad instance. It is safe for
+// concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	header     http.Header
+	retries    int
+	retryDelay time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. If it has no
+// cookie jar, a new one is set.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithHeader adds a header to all requests, e.g. the `Authorization`
+// header required by a reverse proxy in front of elektrad.
+func WithHeader(name, value string) Option {
+	return func(c *Client) {
+		c.header.Add(name, value)
+	}
+}
+
+// WithRetries sets how often idempotent requests are retried after network
+// errors and `5xx` responses and the delay before the first retry, which
+// is doubled for every further retry.
+func WithRetries(retries int, delay time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.retryDelay = delay
+	}
+}
+
+// New creates a client for the elektrad instance at `baseURL`, e.g.
+// `http://localhost:33333`.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{},
+		header:     http.Header{},
+		retries:    2,
+		retryDelay: 100 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.httpClient.Jar == nil {
+		jar, err := cookiejar.New(nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		c.httpClient.Jar = jar
+	}
+
+	return c, nil
+}
+
+// Version is the version of the API and of Elektra.
+type Version struct {
+	API     int `json:"api"`
+	Elektra struct {
+		Version string `json:"version"`
+		Major   int    `json:"major"`
+		Minor   int    `json:"minor"`
+		Micro   int    `json:"micro"`
+	} `json:"elektra"`
+}
+
+// Key is a key as returned by `Get`.
+type Key struct {
+	Exists bool   `json:"exists"`
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	// Ls contains the key and all keys below it.
+	Ls []string `json:"ls"`
+	// Value is base64 encoded if Binary is set.
+	Value    string            `json:"value"`
+	Binary   bool              `json:"binary"`
+	Meta     map[string]string `json:"meta"`
+	Children []*Key            `json:"children"`
+}
+
+// Version returns the version of the API and of Elektra.
+func (c *Client) Version(ctx context.Context) (*Version, error) {
+	var version Version
+
+	if err := c.do(ctx, "GET", "/version", nil, nil, &version); err != nil {
+		return nil, err
+	}
+
+	return &version, nil
+}
+
+// Get returns the key `name` and the names of all keys below it. If the key
+// does not exist, `Exists` of the result is false.
+func (c *Client) Get(ctx context.Context, name string) (*Key, error) {
+	var key Key
+
+	if err := c.do(ctx, "GET", keyPath("/kdb", name), nil, nil, &key); err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// Set sets the value of the key `name`, the key is created if it does not
+// exist.
+func (c *Client) Set(ctx context.Context, name, value string) error {
+	return c.do(ctx, "PUT", keyPath("/kdb", name), nil, value, nil)
+}
+
+// Delete deletes the key `name`. If the key does not exist an error that
+// matches `ErrNotFound` is returned.
+func (c *Client) Delete(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", keyPath("/kdb", name), nil, nil, nil)
+}
+
+// DeleteRecursive deletes the key `name` and all keys below it. If no key
+// exists an error that matches `ErrNotFound` is returned. Deleting more keys
+// than the delete limit of elektrad fails with an error that matches
+// `ErrConflict`, unless `confirm` is set.
+func (c *Client) DeleteRecursive(ctx context.Context, name string, confirm bool) error {
+	query := url.Values{"recursive": {"true"}}
+
+	if confirm {
+		query.Set("confirm", "true")
+	}
+
+	return c.do(ctx, "DELETE", keyPath("/kdb", name), query, nil, nil)
+}
+
+// Tree returns the subtree below `name` as nested JSON. If `meta` is set,
+// the values and metadata of the keys are returned in `@value` and `@meta`
+// fields.
+func (c *Client) Tree(ctx context.Context, name string, meta bool) (json.RawMessage, error) {
+	var tree json.RawMessage
+
+	query := url.Values{"meta": {strconv.FormatBool(meta)}}
+
+	if err := c.do(ctx, "GET", keyPath("/kdbTree", name), query, nil, &tree); err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// SetTree writes the subtree below `name` from nested JSON in one commit.
+// If `merge` is not set, keys below `name` that are not part of the tree
+// are removed.
+func (c *Client) SetTree(ctx context.Context, name string, tree json.RawMessage, merge bool) error {
+	query := url.Values{}
+
+	if merge {
+		query.Set("mode", "merge")
+	}
+
+	return c.do(ctx, "PUT", keyPath("/kdbTree", name), query, tree, nil)
+}
+
+// Meta returns the metadata of the key `name`. If the key does not exist
+// an error that matches `ErrNotFound` is returned.
+func (c *Client) Meta(ctx context.Context, name string) (map[string]string, error) {
+	var meta map[string]string
+
+	if err := c.do(ctx, "GET", keyPath("/kdbMeta", name), nil, nil, &meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// Find returns the names of all keys that match the regular expression.
+func (c *Client) Find(ctx context.Context, regex string) ([]string, error) {
+	var names []string
+
+	if err := c.do(ctx, "GET", "/kdbFind/"+url.PathEscape(regex), nil, nil, &names); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// Move moves the key `from` to `to` in one commit, with all keys below it
+// if `recursive` is set.
+func (c *Client) Move(ctx context.Context, from, to string, recursive bool) error {
+	query := url.Values{"recursive": {strconv.FormatBool(recursive)}}
+
+	return c.do(ctx, "POST", keyPath("/kdbMv", from), query, to, nil)
+}
+
+// Copy copies the key `from` with its metadata to `to` in one commit, with
+// all keys below it if `recursive` is set. Binary values are copied
+// unchanged.
+func (c *Client) Copy(ctx context.Context, from, to string, recursive bool) error {
+	query := url.Values{"recursive": {strconv.FormatBool(recursive)}}
+
+	return c.do(ctx, "POST", keyPath("/kdbCp", from), query, to, nil)
+}
+
+// SetMeta sets the metakey `metaName` of the key `name`, the key is
+// created if it does not exist.
+func (c *Client) SetMeta(ctx context.Context, name, metaName, value string) error {
+	body := map[string]string{
+		"key":   metaName,
+		"value": value,
+	}
+
+	return c.do(ctx, "POST", keyPath("/kdbMeta", name), nil, body, nil)
+}
+
+// RemoveMeta removes the metakey `metaName` of the key `name`.
+func (c *Client) RemoveMeta(ctx context.Context, name, metaName string) error {
+	return c.do(ctx, "DELETE", metaPath(name, metaName), nil, nil, nil)
+}
+
+// do sends a request with `body` encoded as JSON and decodes the JSON
+// response into `result`, if it is not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	var data []byte
+
+	if body != nil {
+		var err error
+
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	// the path is already escaped
+	target := c.baseURL.String() + path
+
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	delay := c.retryDelay
+
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, method, target, data, result)
+
+		if attempt >= c.retries || !isIdempotent(method) || !isTemporary(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, target string, data []byte, result interface{}) error {
+	var body io.Reader
+
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, target, body)
+
+	if err != nil {
+		return err
+	}
+
+	req = req.WithContext(ctx)
+
+	for name, values := range c.header {
+		req.Header[name] = values
+	}
+
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return newError(resp)
+	}
+
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// keyPath returns the URL path of the key `name` below the endpoint.
+func keyPath(endpoint, name string) string {
+	parts := strings.Split(strings.TrimPrefix(name, "/"), "/")
+
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+
+	return endpoint + "/" + strings.Join(parts, "/")
+}
+
+// metaPath returns the URL path of the metakey `metaName` of the key `name`.
+func metaPath(name, metaName string) string {
+	return strings.TrimSuffix(keyPath("/kdbMeta", name), "/") + keyPath("/meta:", metaName)
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE":
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*Client, func()) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+
+	c, err := New(server.URL, WithRetries(2, time.Millisecond))
+
+	if err != nil {
+		server.Close()
+		t.Fatalf("could not create client: %v", err)
+	}
+
+	return c, server.Close
+}
+
+func TestGet(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/kdb/user:/tests/hello world" {
+			t.Errorf("wrong path %q", r.URL.Path)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"exists": true,
+			"name":   "hello world",
+			"path":   "user:/tests/hello world",
+			"ls":     []string{"user:/tests/hello world"},
+			"value":  "hi",
+			"meta":   map[string]string{"type": "string"},
+		})
+	})
+	defer closeServer()
+
+	key, err := c.Get(context.Background(), "user:/tests/hello world")
+
+	if err != nil {
+		t.Fatalf("could not get key: %v", err)
+	}
+
+	if !key.Exists || key.Value != "hi" || key.Meta["type"] != "string" {
+		t.Errorf("unexpected key %+v", key)
+	}
+}
+
+func TestSetAndSession(t *testing.T) {
+	requests := 0
+
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if requests == 1 {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		} else if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "abc" {
+			t.Errorf("the session cookie was not sent")
+		}
+
+		var value string
+
+		if err := json.NewDecoder(r.Body).Decode(&value); err != nil || value != "world" {
+			t.Errorf("wrong body %q: %v", value, err)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer closeServer()
+
+	for i := 0; i < 2; i++ {
+		if err := c.Set(context.Background(), "user:/tests/hello", "world"); err != nil {
+			t.Fatalf("could not set key: %v", err)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "DELETE":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid key name"}`))
+		}
+	})
+	defer closeServer()
+
+	err := c.Delete(context.Background(), "user:/tests/missing")
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	err = c.Move(context.Background(), "user:/tests/a", "invalid", true)
+
+	var e *Error
+
+	if !errors.As(err, &e) || !errors.Is(err, ErrBadRequest) || e.Message != "invalid key name" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	requests := 0
+
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		json.NewEncoder(w).Encode([]string{"user:/tests/a"})
+	})
+	defer closeServer()
+
+	names, err := c.Find(context.Background(), "tests")
+
+	if err != nil {
+		t.Fatalf("request was not retried: %v", err)
+	}
+
+	if len(names) != 1 || requests != 3 {
+		t.Errorf("unexpected result %v after %d requests", names, requests)
+	}
+
+	requests = 0
+
+	if err = c.Move(context.Background(), "user:/tests/a", "user:/tests/b", true); err == nil || requests != 1 {
+		t.Errorf("POST requests must not be retried, %d requests", requests)
+	}
+}
+
+func TestRemoveMeta(t *testing.T) {
+	c, closeServer := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != "/kdbMeta/user:/tests/a/meta:/check/type" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer closeServer()
+
+	if err := c.RemoveMeta(context.Background(), "user:/tests/a", "check/type"); err != nil {
+		t.Fatalf("could not remove meta: %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+var (
+	// ErrBadRequest matches errors of requests with invalid arguments, e.g.
+	// an invalid key name.
+	ErrBadRequest = errors.New("bad request")
+	// ErrNotFound matches errors of requests for keys that do not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict matches errors of requests that conflict with the current
+	// state of the key database.
+	ErrConflict = errors.New("conflict")
+)
+
+// Error is returned for responses with an error status code.
+type Error struct {
+	StatusCode int
+	// Message is the `error` field of the response body, if any.
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("elektrad: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+
+	return fmt.Sprintf("elektrad: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Is matches `ErrBadRequest`, `ErrNotFound` and `ErrConflict` by the status
+// code.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	}
+
+	return false
+}
+
+func newError(resp *http.Response) error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+	}
+
+	var body struct {
+		Error string `json:"error"`
+	}
+
+	if data, err := ioutil.ReadAll(resp.Body); err == nil && json.Unmarshal(data, &body) == nil {
+		e.Message = body.Error
+	}
+
+	return e
+}
+
+// isTemporary checks if a request that failed with `err` may succeed if it
+// is retried.
+func isTemporary(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var e *Error
+
+	if errors.As(err, &e) {
+		return e.StatusCode >= 500
+	}
+
+	var netErr net.Error
+
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	return false
+}
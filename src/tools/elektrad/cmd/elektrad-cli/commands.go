@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/ElektraInitiative/libelektra/elektrad/client"
+)
+
+// parseArgs parses the options of a command and checks that between `min`
+// and `max` arguments are passed.
+func parseArgs(flags *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	flags.SetOutput(ioutil.Discard)
+
+	if err := flags.Parse(args); err != nil {
+		return nil, &commandError{code: exitInvalidArgs, message: "Invalid arguments passed: " + err.Error(), usage: true}
+	}
+
+	if flags.NArg() < min || flags.NArg() > max {
+		return nil, &commandError{code: exitInvalidArgs, message: "Invalid arguments passed: wrong number of arguments", usage: true}
+	}
+
+	return flags.Args(), nil
+}
+
+func getCommand(env *environment, args []string) error {
+	flags := flag.NewFlagSet("get", flag.ContinueOnError)
+	noNewline := flags.Bool("n", false, "do not print a newline after the value")
+
+	args, err := parseArgs(flags, args, 1, 1)
+
+	if err != nil {
+		return err
+	}
+
+	key, err := env.client.Get(env.ctx, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	if !key.Exists {
+		return newCommandError(exitCommandError, "Did not find key '%s'", args[0])
+	}
+
+	if key.Binary {
+		value, err := base64.StdEncoding.DecodeString(key.Value)
+
+		if err != nil {
+			return err
+		}
+
+		_, err = env.stdout.Write(value)
+
+		return err
+	}
+
+	fmt.Fprint(env.stdout, key.Value)
+
+	if !*noNewline {
+		fmt.Fprintln(env.stdout)
+	}
+
+	return nil
+}
+
+func setCommand(env *environment, args []string) error {
+	flags := flag.NewFlagSet("set", flag.ContinueOnError)
+	quiet := flags.Bool("q", false, "only print errors")
+
+	args, err := parseArgs(flags, args, 2, 2)
+
+	if err != nil {
+		return err
+	}
+
+	name, value := args[0], args[1]
+
+	key, err := env.client.Get(env.ctx, name)
+
+	if err != nil {
+		return err
+	}
+
+	if isCascading(name) && !key.Exists {
+		return newCommandError(exitInvalidArgs, "Aborting: A cascading write to a non-existent key is ambiguous.")
+	}
+
+	if err = env.client.Set(env.ctx, name, value); err != nil {
+		return err
+	}
+
+	if *quiet {
+		return nil
+	}
+
+	if key.Exists {
+		fmt.Fprintf(env.stdout, "Set string to \"%s\"\n", value)
+	} else {
+		fmt.Fprintf(env.stdout, "Create a new key %s with string \"%s\"\n", name, value)
+	}
+
+	return nil
+}
+
+func lsCommand(env *environment, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("ls", flag.ContinueOnError), args, 1, 1)
+
+	if err != nil {
+		return err
+	}
+
+	key, err := env.client.Get(env.ctx, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range key.Ls {
+		fmt.Fprintln(env.stdout, name)
+	}
+
+	return nil
+}
+
+func rmCommand(env *environment, args []string) error {
+	flags := flag.NewFlagSet("rm", flag.ContinueOnError)
+	recursive := flags.Bool("r", false, "remove the keys below the key as well")
+	force := flags.Bool("f", false, "do not fail on missing keys, confirm large recursive removals")
+
+	args, err := parseArgs(flags, args, 1, 1)
+
+	if err != nil {
+		return err
+	}
+
+	if *recursive {
+		err = env.client.DeleteRecursive(env.ctx, args[0], *force)
+	} else {
+		err = env.client.Delete(env.ctx, args[0])
+	}
+
+	switch {
+	case errors.Is(err, client.ErrNotFound) && *force:
+		return nil
+	case errors.Is(err, client.ErrNotFound) && *recursive:
+		return newCommandError(exitCommandError, "Did not find any key")
+	case errors.Is(err, client.ErrNotFound):
+		return newCommandError(exitCommandError, "Did not find the key")
+	case errors.Is(err, client.ErrConflict) && *recursive:
+		return newCommandError(exitCommandError, "Too many keys below '%s', use -f to remove them", args[0])
+	}
+
+	return err
+}
+
+func mvCommand(env *environment, args []string) error {
+	flags := flag.NewFlagSet("mv", flag.ContinueOnError)
+	recursive := flags.Bool("r", false, "move the keys below the key as well")
+
+	args, err := parseArgs(flags, args, 2, 2)
+
+	if err != nil {
+		return err
+	}
+
+	source, destination := args[0], args[1]
+
+	key, err := env.client.Get(env.ctx, source)
+
+	if err != nil {
+		return err
+	}
+
+	if !*recursive {
+		if !key.Exists {
+			return newCommandError(exitCommandError, "Did not find the key")
+		}
+
+		return env.client.Move(env.ctx, source, destination, false)
+	}
+
+	if len(key.Ls) == 0 {
+		return newCommandError(exitCommandError, "No key to move found below '%s'", source)
+	}
+
+	return env.client.Move(env.ctx, source, destination, true)
+}
+
+func cpCommand(env *environment, args []string) error {
+	flags := flag.NewFlagSet("cp", flag.ContinueOnError)
+	recursive := flags.Bool("r", false, "copy the keys below the key as well")
+
+	args, err := parseArgs(flags, args, 2, 2)
+
+	if err != nil {
+		return err
+	}
+
+	source, destination := args[0], args[1]
+
+	key, err := env.client.Get(env.ctx, source)
+
+	if err != nil {
+		return err
+	}
+
+	if !*recursive {
+		if !key.Exists {
+			return newCommandError(exitCommandError, "Did not find the key")
+		}
+
+		return env.client.Copy(env.ctx, source, destination, false)
+	}
+
+	if len(key.Ls) == 0 {
+		return newCommandError(exitCommandError, "No key to copy found below '%s'", source)
+	}
+
+	return env.client.Copy(env.ctx, source, destination, true)
+}
+
+func findCommand(env *environment, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("find", flag.ContinueOnError), args, 1, 1)
+
+	if err != nil {
+		return err
+	}
+
+	names, err := env.client.Find(env.ctx, args[0])
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		fmt.Fprintln(env.stdout, name)
+	}
+
+	return nil
+}
+
+func metaGetCommand(env *environment, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("meta-get", flag.ContinueOnError), args, 2, 2)
+
+	if err != nil {
+		return err
+	}
+
+	meta, err := env.client.Meta(env.ctx, args[0])
+
+	if errors.Is(err, client.ErrNotFound) {
+		return newCommandError(1, "Key not found")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	value, ok := meta[args[1]]
+
+	if !ok {
+		return newCommandError(2, "Metakey not found")
+	}
+
+	fmt.Fprintln(env.stdout, value)
+
+	return nil
+}
+
+func metaLsCommand(env *environment, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("meta-ls", flag.ContinueOnError), args, 1, 1)
+
+	if err != nil {
+		return err
+	}
+
+	meta, err := env.client.Meta(env.ctx, args[0])
+
+	if errors.Is(err, client.ErrNotFound) {
+		return newCommandError(exitCommandError, "Did not find key '%s'", args[0])
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var names []string
+
+	for name := range meta {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintln(env.stdout, name)
+	}
+
+	return nil
+}
+
+func metaSetCommand(env *environment, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("meta-set", flag.ContinueOnError), args, 3, 3)
+
+	if err != nil {
+		return err
+	}
+
+	return env.client.SetMeta(env.ctx, args[0], args[1], args[2])
+}
+
+func metaRmCommand(env *environment, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("meta-rm", flag.ContinueOnError), args, 2, 2)
+
+	if err != nil {
+		return err
+	}
+
+	return env.client.RemoveMeta(env.ctx, args[0], args[1])
+}
+
+// checkFormat checks the format argument of `export` and `import`, only the
+// JSON format of `/kdbTree` is supported.
+func checkFormat(args []string) error {
+	if len(args) > 1 && args[1] != "json" {
+		return newCommandError(exitInvalidArgs, "The format %s is not supported, only json is available", args[1])
+	}
+
+	return nil
+}
+
+func exportCommand(env *environment, args []string) error {
+	args, err := parseArgs(flag.NewFlagSet("export", flag.ContinueOnError), args, 1, 2)
+
+	if err != nil {
+		return err
+	}
+
+	if err = checkFormat(args); err != nil {
+		return err
+	}
+
+	tree, err := env.client.Tree(env.ctx, args[0], true)
+
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+
+	if err = json.Indent(&out, tree, "", "  "); err != nil {
+		return err
+	}
+
+	out.WriteByte('\n')
+
+	_, err = out.WriteTo(env.stdout)
+
+	return err
+}
+
+func importCommand(env *environment, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	strategy := flags.String("s", "merge", "merge: keep keys missing in the input, replace: remove them")
+
+	args, err := parseArgs(flags, args, 1, 2)
+
+	if err != nil {
+		return err
+	}
+
+	if err = checkFormat(args); err != nil {
+		return err
+	}
+
+	if *strategy != "merge" && *strategy != "replace" {
+		return newCommandError(exitInvalidArgs, "Invalid arguments passed: unknown strategy %s", *strategy)
+	}
+
+	data, err := ioutil.ReadAll(env.stdin)
+
+	if err != nil {
+		return err
+	}
+
+	if !json.Valid(data) {
+		return newCommandError(exitInvalidArgs, "Invalid arguments passed: the input is not valid JSON")
+	}
+
+	return env.client.SetTree(env.ctx, args[0], data, *strategy == "merge")
+}
+
+func versionCommand(env *environment, args []string) error {
+	version, err := env.client.Version(env.ctx)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(env.stdout, "KDB_VERSION: %s\n", version.Elektra.Version)
+	fmt.Fprintf(env.stdout, "API_VERSION: %d\n", version.API)
+
+	return nil
+}
+
+// isCascading checks if a key name has no namespace.
+func isCascading(name string) bool {
+	return strings.HasPrefix(name, "/")
+}
@@ -0,0 +1,202 @@
+// Command elektrad-cli is a `kdb` compatible command line client for a
+// remote elektrad instance.
+//
+// Usage:
+//
+//	elektrad-cli [-profile <name>] [-url <url>] <command> [<options>] <arguments>
+//
+// The supported commands have the same names, arguments, output and exit
+// codes as the corresponding `kdb` commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ElektraInitiative/libelektra/elektrad/client"
+)
+
+// exit codes of `kdb`
+const (
+	exitOK           = 0
+	exitInvalidArgs  = 2
+	exitUnknownCmd   = 4
+	exitKDBError     = 5
+	exitCommandError = 11
+)
+
+// commandError is a failed command with the exit code `kdb` uses for it.
+type commandError struct {
+	code    int
+	message string
+	// usage is set if the usage of the command should be printed
+	usage bool
+}
+
+func (e *commandError) Error() string {
+	return e.message
+}
+
+func newCommandError(code int, format string, args ...interface{}) error {
+	return &commandError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+type command struct {
+	usage string
+	run   func(env *environment, args []string) error
+}
+
+// environment is passed to the commands.
+type environment struct {
+	ctx    context.Context
+	client *client.Client
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var commands = map[string]*command{
+	"get":       {"get [-n] <name>", getCommand},
+	"set":       {"set [-q] <name> <value>", setCommand},
+	"ls":        {"ls <name>", lsCommand},
+	"rm":        {"rm [-r] [-f] <name>", rmCommand},
+	"mv":        {"mv [-r] <source> <destination>", mvCommand},
+	"cp":        {"cp [-r] <source> <destination>", cpCommand},
+	"find":      {"find <regex>", findCommand},
+	"meta-get":  {"meta-get <name> <metaname>", metaGetCommand},
+	"meta-ls":   {"meta-ls <name>", metaLsCommand},
+	"meta-set":  {"meta-set <name> <metaname> <value>", metaSetCommand},
+	"meta-rm":   {"meta-rm <name> <metaname>", metaRmCommand},
+	"export":    {"export <name> [json]", exportCommand},
+	"import":    {"import [-s merge|replace] <name> [json]", importCommand},
+	"-V":        {"-V", versionCommand},
+	"--version": {"--version", versionCommand},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line `args` and returns the exit code.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("elektrad-cli", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { usage(stderr) }
+
+	profileName := flags.String("profile", os.Getenv("ELEKTRAD_PROFILE"), "the profile used to connect to elektrad")
+	serverURL := flags.String("url", os.Getenv("ELEKTRAD_URL"), "the URL of elektrad, overrides the URL of the profile")
+
+	if err := flags.Parse(args); err != nil {
+		return exitInvalidArgs
+	}
+
+	if flags.NArg() == 0 {
+		usage(stderr)
+		return exitOK
+	}
+
+	name := flags.Arg(0)
+	cmd, ok := commands[name]
+
+	if !ok {
+		fmt.Fprintf(stderr, "Command %s not found\n", name)
+		return exitUnknownCmd
+	}
+
+	p, err := selectProfile(*profileName)
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitInvalidArgs
+	}
+
+	if *serverURL != "" {
+		p.URL = *serverURL
+	}
+
+	c, err := client.New(p.URL, p.clientOptions()...)
+
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitInvalidArgs
+	}
+
+	env := &environment{
+		ctx:    context.Background(),
+		client: c,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	return exitCode(stderr, name, cmd.run(env, flags.Args()[1:]))
+}
+
+func selectProfile(name string) (*profile, error) {
+	filename, err := profilesFile()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		return loadProfile(filename, "default", false)
+	}
+
+	return loadProfile(filename, name, true)
+}
+
+// exitCode prints the error and returns the exit code of `kdb` for it.
+func exitCode(stderr io.Writer, name string, err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var cmdErr *commandError
+
+	if errors.As(err, &cmdErr) {
+		if cmdErr.message != "" {
+			fmt.Fprintln(stderr, cmdErr.message)
+		}
+
+		if cmdErr.usage {
+			fmt.Fprintf(stderr, "Usage: elektrad-cli %s\n", commands[name].usage)
+		}
+
+		return cmdErr.code
+	}
+
+	if errors.Is(err, client.ErrBadRequest) {
+		fmt.Fprintf(stderr, "Invalid arguments passed: %v\n", err)
+		return exitInvalidArgs
+	}
+
+	fmt.Fprintf(stderr, "The command elektrad-cli %s terminated unsuccessfully with the info:\n%v\n", name, err)
+
+	return exitKDBError
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: elektrad-cli [-profile <name>] [-url <url>] <command> [<options>] <arguments>")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+
+	var names []string
+
+	for name := range commands {
+		if name[0] != '-' {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeServer serves the keys of a map like elektrad.
+func fakeServer(t *testing.T, keys map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/kdb/")
+		value, exists := keys[name]
+
+		if r.Method == "POST" {
+			transfer(t, keys, w, r)
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			var ls []string
+
+			for k := range keys {
+				if k == name || strings.HasPrefix(k, name+"/") {
+					ls = append(ls, k)
+				}
+			}
+
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"exists": exists,
+				"path":   name,
+				"ls":     ls,
+				"value":  value,
+			})
+		case "PUT":
+			var value string
+			json.NewDecoder(r.Body).Decode(&value)
+			keys[name] = value
+			w.WriteHeader(http.StatusCreated)
+		case "DELETE":
+			if !exists {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			delete(keys, name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+}
+
+// transfer copies or moves the keys of a map like elektrad.
+func transfer(t *testing.T, keys map[string]string, w http.ResponseWriter, r *http.Request) {
+	var from, to string
+	var remove bool
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/kdbCp/"):
+		from = strings.TrimPrefix(r.URL.Path, "/kdbCp/")
+	case strings.HasPrefix(r.URL.Path, "/kdbMv/"):
+		from = strings.TrimPrefix(r.URL.Path, "/kdbMv/")
+		remove = true
+	default:
+		t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		return
+	}
+
+	json.NewDecoder(r.Body).Decode(&to)
+	recursive := r.URL.Query().Get("recursive") != "false"
+
+	for k, value := range keys {
+		if k != from && !(recursive && strings.HasPrefix(k, from+"/")) {
+			continue
+		}
+
+		keys[to+strings.TrimPrefix(k, from)] = value
+
+		if remove {
+			delete(keys, k)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func runCLI(t *testing.T, serverURL string, args ...string) (int, string, string) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+
+	code := run(append([]string{"-url", serverURL}, args...), strings.NewReader(""), &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestGetCommand(t *testing.T) {
+	server := fakeServer(t, map[string]string{"user:/tests/hello": "world"})
+	defer server.Close()
+
+	code, stdout, _ := runCLI(t, server.URL, "get", "user:/tests/hello")
+
+	if code != exitOK {
+		t.Errorf("wrong exit code %d", code)
+	}
+
+	if stdout != "world\n" {
+		t.Errorf("wrong output %q", stdout)
+	}
+
+	_, stdout, _ = runCLI(t, server.URL, "get", "-n", "user:/tests/hello")
+
+	if stdout != "world" {
+		t.Errorf("wrong output %q", stdout)
+	}
+
+	code, _, stderr := runCLI(t, server.URL, "get", "user:/tests/missing")
+
+	if code != exitCommandError {
+		t.Errorf("wrong exit code %d", code)
+	}
+
+	if !strings.Contains(stderr, "Did not find key 'user:/tests/missing'") {
+		t.Errorf("wrong error %q", stderr)
+	}
+
+	code, _, _ = runCLI(t, server.URL, "get")
+
+	if code != exitInvalidArgs {
+		t.Errorf("wrong exit code %d", code)
+	}
+}
+
+func TestSetCommand(t *testing.T) {
+	keys := map[string]string{"user:/tests/hello": "world"}
+	server := fakeServer(t, keys)
+	defer server.Close()
+
+	code, stdout, _ := runCLI(t, server.URL, "set", "user:/tests/new", "value")
+
+	if code != exitOK {
+		t.Errorf("wrong exit code %d", code)
+	}
+
+	if stdout != "Create a new key user:/tests/new with string \"value\"\n" {
+		t.Errorf("wrong output %q", stdout)
+	}
+
+	if keys["user:/tests/new"] != "value" {
+		t.Errorf("key was not set")
+	}
+
+	_, stdout, _ = runCLI(t, server.URL, "set", "user:/tests/hello", "there")
+
+	if stdout != "Set string to \"there\"\n" {
+		t.Errorf("wrong output %q", stdout)
+	}
+
+	code, _, _ = runCLI(t, server.URL, "set", "/tests/cascading", "value")
+
+	if code != exitInvalidArgs {
+		t.Errorf("wrong exit code %d", code)
+	}
+
+	if keys["/tests/cascading"] != "" {
+		t.Errorf("cascading key was set")
+	}
+}
+
+func TestRmCommand(t *testing.T) {
+	keys := map[string]string{"user:/tests/hello": "world"}
+	server := fakeServer(t, keys)
+	defer server.Close()
+
+	code, _, _ := runCLI(t, server.URL, "rm", "user:/tests/hello")
+
+	if code != exitOK {
+		t.Errorf("wrong exit code %d", code)
+	}
+
+	if len(keys) != 0 {
+		t.Errorf("key was not removed")
+	}
+
+	code, _, stderr := runCLI(t, server.URL, "rm", "user:/tests/hello")
+
+	if code != exitCommandError {
+		t.Errorf("wrong exit code %d", code)
+	}
+
+	if !strings.Contains(stderr, "Did not find the key") {
+		t.Errorf("wrong error %q", stderr)
+	}
+
+	code, _, _ = runCLI(t, server.URL, "rm", "-f", "user:/tests/hello")
+
+	if code != exitOK {
+		t.Errorf("wrong exit code %d", code)
+	}
+}
+
+func TestCpMvCommands(t *testing.T) {
+	keys := map[string]string{
+		"user:/tests/a":       "1",
+		"user:/tests/a/child": "2",
+	}
+	server := fakeServer(t, keys)
+	defer server.Close()
+
+	code, _, _ := runCLI(t, server.URL, "cp", "user:/tests/a", "user:/tests/b")
+
+	if code != exitOK {
+		t.Errorf("wrong exit code %d", code)
+	}
+
+	if keys["user:/tests/b"] != "1" || keys["user:/tests/b/child"] != "" {
+		t.Errorf("wrong keys after cp %v", keys)
+	}
+
+	code, _, _ = runCLI(t, server.URL, "mv", "-r", "user:/tests/a", "user:/tests/c")
+
+	if code != exitOK {
+		t.Errorf("wrong exit code %d", code)
+	}
+
+	if keys["user:/tests/c"] != "1" || keys["user:/tests/c/child"] != "2" || keys["user:/tests/a"] != "" {
+		t.Errorf("wrong keys after mv -r %v", keys)
+	}
+
+	code, _, stderr := runCLI(t, server.URL, "mv", "user:/tests/a", "user:/tests/d")
+
+	if code != exitCommandError {
+		t.Errorf("wrong exit code %d", code)
+	}
+
+	if !strings.Contains(stderr, "Did not find the key") {
+		t.Errorf("wrong error %q", stderr)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	code, _, _ := runCLI(t, "http://localhost:0", "unknown")
+
+	if code != exitUnknownCmd {
+		t.Errorf("wrong exit code %d", code)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	var authorization string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		json.NewEncoder(w).Encode(map[string]interface{}{"exists": true, "value": "1"})
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "elektrad-cli-")
+
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "profiles.json")
+	profiles := `{"remote": {"url": "` + server.URL + `", "user": "alice", "password": "secret"}}`
+
+	if err = ioutil.WriteFile(filename, []byte(profiles), 0600); err != nil {
+		t.Fatalf("could not write profiles: %v", err)
+	}
+
+	os.Setenv("ELEKTRAD_PROFILES", filename)
+	defer os.Unsetenv("ELEKTRAD_PROFILES")
+
+	var stdout, stderr bytes.Buffer
+
+	code := run([]string{"-profile", "remote", "get", "user:/tests/hello"}, nil, &stdout, &stderr)
+
+	if code != exitOK {
+		t.Errorf("wrong exit code %d: %s", code, stderr.String())
+	}
+
+	if authorization != "Basic YWxpY2U6c2VjcmV0" {
+		t.Errorf("wrong authorization %q", authorization)
+	}
+
+	code = run([]string{"-profile", "missing", "get", "user:/tests/hello"}, nil, &stdout, &stderr)
+
+	if code != exitInvalidArgs {
+		t.Errorf("wrong exit code %d", code)
+	}
+}
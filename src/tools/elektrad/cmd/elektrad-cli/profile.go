@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ElektraInitiative/libelektra/elektrad/client"
+)
+
+const defaultURL = "http://localhost:33333"
+
+// profile contains the server and credentials used to connect to elektrad.
+type profile struct {
+	URL string `json:"url"`
+	// User and Password are sent with basic authentication
+	User     string `json:"user"`
+	Password string `json:"password"`
+	// Token is sent as bearer token
+	Token string `json:"token"`
+	// Header contains additional request headers
+	Header map[string]string `json:"header"`
+}
+
+// profilesFile returns the path of the profiles file, it can be overridden
+// with `ELEKTRAD_PROFILES`.
+func profilesFile() (string, error) {
+	if filename := os.Getenv("ELEKTRAD_PROFILES"); filename != "" {
+		return filename, nil
+	}
+
+	dir, err := os.UserConfigDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "elektrad-cli", "profiles.json"), nil
+}
+
+// loadProfile reads the profile `name` from the profiles file, a JSON object
+// with a profile per name. A missing file or profile is only an error if
+// the profile was requested explicitly.
+func loadProfile(filename, name string, explicit bool) (*profile, error) {
+	data, err := ioutil.ReadFile(filename)
+
+	if os.IsNotExist(err) && !explicit {
+		return &profile{URL: defaultURL}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles map[string]*profile
+
+	if err = json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	p, ok := profiles[name]
+
+	if !ok {
+		if explicit {
+			return nil, fmt.Errorf("%s: profile %q not found", filename, name)
+		}
+
+		p = &profile{}
+	}
+
+	if p.URL == "" {
+		p.URL = defaultURL
+	}
+
+	return p, nil
+}
+
+// clientOptions returns the options that add the credentials of the profile
+// to requests.
+func (p *profile) clientOptions() []client.Option {
+	var opts []client.Option
+
+	switch {
+	case p.Token != "":
+		opts = append(opts, client.WithHeader("Authorization", "Bearer "+p.Token))
+	case p.User != "":
+		credentials := base64.StdEncoding.EncodeToString([]byte(p.User + ":" + p.Password))
+		opts = append(opts, client.WithHeader("Authorization", "Basic "+credentials))
+	}
+
+	for name, value := range p.Header {
+		opts = append(opts, client.WithHeader(name, value))
+	}
+
+	return opts
+}
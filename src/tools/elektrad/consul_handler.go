@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	consulDefaultWait = 5 * time.Minute
+	consulMaxWait     = 10 * time.Minute
+)
+
+// consulEntry is a key of the Consul KV API. The value is base64 encoded.
+type consulEntry struct {
+	LockIndex   int64
+	Key         string
+	Flags       uint64
+	Value       []byte
+	CreateIndex int64
+	ModifyIndex int64
+}
+
+// getConsulKVHandler returns keys in the format of the Consul KV API. The
+// keys are served by an etcd gateway, the revisions are the Consul indexes.
+//
+// Arguments:
+//		key			the Consul key, below the `-consul-root` key. URL path param.
+//		recurse		return all keys with the prefix `key`. URL query param.
+//		keys		only return the names of the keys with the prefix `key`. URL query param.
+//		separator	with `keys`, only return the names up to the first separator after the prefix. URL query param.
+//		raw			return the value of the key. URL query param.
+//		index		block until the index is greater than `index`. URL query param.
+//		wait		the maximum time to block, e.g. `30s`, default `5m`. URL query param.
+//
+// Response Code:
+//		200 OK with the keys, the current index is in the `X-Consul-Index` header.
+//		400 Bad Request if `index` or `wait` are invalid.
+//		404 Not Found if no key matches.
+//
+// Example: `curl localhost:33333/v1/kv/app?recurse`
+func (s *server) getConsulKVHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["path"]
+	query := r.URL.Query()
+
+	index, wait, err := parseConsulBlocking(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if index > 0 {
+		if err = s.consul.waitForRevision(r.Context(), index, wait); err != nil {
+			writeGatewayError(w, err)
+			return
+		}
+	}
+
+	_, recurse := query["recurse"]
+	_, keysOnly := query["keys"]
+
+	req := &etcdserverpb.RangeRequest{
+		Key:      []byte("/" + key),
+		KeysOnly: keysOnly,
+	}
+
+	if recurse || keysOnly {
+		req.RangeEnd = prefixRangeEnd(req.Key)
+	}
+
+	resp, err := s.consul.Range(r.Context(), req)
+
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+
+	w.Header().Set("X-Consul-Index", strconv.FormatInt(resp.Header.Revision, 10))
+	w.Header().Set("X-Consul-KnownLeader", "true")
+	w.Header().Set("X-Consul-LastContact", "0")
+
+	if len(resp.Kvs) == 0 {
+		notFound(w)
+		return
+	}
+
+	if keysOnly {
+		writeResponse(w, consulKeys(resp.Kvs, key, query.Get("separator")))
+		return
+	}
+
+	if _, raw := query["raw"]; raw && !recurse {
+		w.Write(resp.Kvs[0].Value)
+		return
+	}
+
+	entries := make([]consulEntry, 0, len(resp.Kvs))
+
+	for _, kv := range resp.Kvs {
+		entries = append(entries, consulEntry{
+			Key:         strings.TrimPrefix(string(kv.Key), "/"),
+			Value:       kv.Value,
+			CreateIndex: kv.CreateRevision,
+			ModifyIndex: kv.ModRevision,
+		})
+	}
+
+	writeResponse(w, entries)
+}
+
+// putConsulKVHandler sets a key in the format of the Consul KV API.
+//
+// Arguments:
+//		key		the Consul key, below the `-consul-root` key. URL path param.
+//		value	the value of the key. Raw request body.
+//		cas		only set the key if its `ModifyIndex` is `cas`, `0` only creates the key. URL query param.
+//
+// Response Code:
+//		200 OK with `true` if the key was set, `false` if the `cas` check failed.
+//		400 Bad Request if `cas` is invalid or locks are used.
+//
+// Example: `curl -X PUT -d '8080' localhost:33333/v1/kv/app/port`
+func (s *server) putConsulKVHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["path"]
+	query := r.URL.Query()
+
+	if query.Get("acquire") != "" || query.Get("release") != "" {
+		writeError(w, errors.New("locks are not supported"))
+		return
+	}
+
+	value, err := ioutil.ReadAll(r.Body)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	put := &etcdserverpb.PutRequest{Key: []byte("/" + key), Value: value}
+
+	if _, ok := query["cas"]; !ok {
+		if _, err = s.consul.Put(r.Context(), put); err != nil {
+			writeGatewayError(w, err)
+			return
+		}
+
+		writeResponse(w, true)
+		return
+	}
+
+	compare, err := consulCompare(put.Key, query.Get("cas"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp, err := s.consul.Txn(r.Context(), &etcdserverpb.TxnRequest{
+		Compare: []*etcdserverpb.Compare{compare},
+		Success: []*etcdserverpb.RequestOp{
+			{Request: &etcdserverpb.RequestOp_RequestPut{RequestPut: put}},
+		},
+	})
+
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+
+	writeResponse(w, resp.Succeeded)
+}
+
+// deleteConsulKVHandler deletes keys in the format of the Consul KV API.
+//
+// Arguments:
+//		key		the Consul key, below the `-consul-root` key. URL path param.
+//		recurse	delete all keys with the prefix `key`. URL query param.
+//		cas		only delete the key if its `ModifyIndex` is `cas`. URL query param.
+//
+// Response Code:
+//		200 OK with `true` if the keys were deleted, `false` if the `cas` check failed.
+//		400 Bad Request if `cas` is invalid.
+//
+// Example: `curl -X DELETE localhost:33333/v1/kv/app?recurse`
+func (s *server) deleteConsulKVHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["path"]
+	query := r.URL.Query()
+
+	del := &etcdserverpb.DeleteRangeRequest{Key: []byte("/" + key)}
+
+	if _, recurse := query["recurse"]; recurse {
+		del.RangeEnd = prefixRangeEnd(del.Key)
+	}
+
+	if _, ok := query["cas"]; !ok || del.RangeEnd != nil {
+		if _, err := s.consul.DeleteRange(r.Context(), del); err != nil {
+			writeGatewayError(w, err)
+			return
+		}
+
+		writeResponse(w, true)
+		return
+	}
+
+	compare, err := consulCompare(del.Key, query.Get("cas"))
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	resp, err := s.consul.Txn(r.Context(), &etcdserverpb.TxnRequest{
+		Compare: []*etcdserverpb.Compare{compare},
+		Success: []*etcdserverpb.RequestOp{
+			{Request: &etcdserverpb.RequestOp_RequestDeleteRange{RequestDeleteRange: del}},
+		},
+	})
+
+	if err != nil {
+		writeGatewayError(w, err)
+		return
+	}
+
+	writeResponse(w, resp.Succeeded)
+}
+
+func parseConsulBlocking(r *http.Request) (int64, time.Duration, error) {
+	query := r.URL.Query()
+
+	var index int64
+
+	if s := query.Get("index"); s != "" {
+		var err error
+
+		if index, err = strconv.ParseInt(s, 10, 64); err != nil || index < 0 {
+			return 0, 0, errors.New("invalid index")
+		}
+	}
+
+	wait := consulDefaultWait
+
+	if s := query.Get("wait"); s != "" {
+		var err error
+
+		if wait, err = time.ParseDuration(s); err != nil || wait < 0 {
+			return 0, 0, errors.New("invalid wait")
+		}
+	}
+
+	if wait > consulMaxWait {
+		wait = consulMaxWait
+	}
+
+	return index, wait, nil
+}
+
+// consulCompare returns the comparison of a `cas` check.
+func consulCompare(key []byte, cas string) (*etcdserverpb.Compare, error) {
+	index, err := strconv.ParseInt(cas, 10, 64)
+
+	if err != nil || index < 0 {
+		return nil, errors.New("invalid cas")
+	}
+
+	if index == 0 {
+		return &etcdserverpb.Compare{
+			Key:         key,
+			Target:      etcdserverpb.Compare_CREATE,
+			Result:      etcdserverpb.Compare_EQUAL,
+			TargetUnion: &etcdserverpb.Compare_CreateRevision{CreateRevision: 0},
+		}, nil
+	}
+
+	return &etcdserverpb.Compare{
+		Key:         key,
+		Target:      etcdserverpb.Compare_MOD,
+		Result:      etcdserverpb.Compare_EQUAL,
+		TargetUnion: &etcdserverpb.Compare_ModRevision{ModRevision: index},
+	}, nil
+}
+
+// consulKeys returns the names of the keys, with a separator the names are
+// cut after the first separator following the prefix.
+func consulKeys(kvs []*mvccpb.KeyValue, prefix, separator string) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+
+	for _, kv := range kvs {
+		key := strings.TrimPrefix(string(kv.Key), "/")
+
+		if separator != "" {
+			if i := strings.Index(key[len(prefix):], separator); i >= 0 {
+				key = key[:len(prefix)+i+len(separator)]
+			}
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// prefixRangeEnd returns the end of the etcd range of all keys with the
+// prefix.
+func prefixRangeEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	// all keys
+	return []byte{0}
+}
+
+// waitForRevision blocks until the revision is greater than `revision`, the
+// timeout expires or the context is canceled. It returns immediately if
+// `revision` is greater than the current revision, e.g. after a restart.
+func (g *etcdGateway) waitForRevision(ctx context.Context, revision int64, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		g.mut.Lock()
+
+		if err := g.refresh(nil); err != nil {
+			g.mut.Unlock()
+			return status.Error(codes.Unavailable, err.Error())
+		}
+
+		current := g.revision
+		changed := g.changed
+
+		g.mut.Unlock()
+
+		if current != revision {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func writeGatewayError(w http.ResponseWriter, err error) {
+	if status.Code(err) == codes.InvalidArgument {
+		writeError(w, err)
+		return
+	}
+
+	writeErrorCode(w, http.StatusInternalServerError, err)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const consulTestRoot = "user:/tests/elektrad/consul"
+
+func testConsulRequest(t *testing.T, app *server, verb, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := setupRouter(app)
+
+	w := httptest.NewRecorder()
+
+	req, err := http.NewRequest(verb, path, bytes.NewReader([]byte(body)))
+	Checkf(t, err, "could not create %s request: %v", verb, err)
+
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func testConsulServer(t *testing.T) *server {
+	t.Helper()
+
+	removeTree(t, consulTestRoot)
+
+	g, err := newEtcdGateway(consulTestRoot)
+	Check(t, err, "could not create gateway")
+
+	return &server{pool: initPool(10), consul: g}
+}
+
+func TestConsulKV(t *testing.T) {
+	app := testConsulServer(t)
+	defer removeTree(t, consulTestRoot)
+
+	for _, key := range []string{"app/a", "app/b", "app/sub/c"} {
+		w := testConsulRequest(t, app, "PUT", "/v1/kv/"+key, "value "+key)
+		Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+		Assertf(t, w.Body.String() == "true", "wrong response %s", w.Body.String())
+	}
+
+	k := getKey(t, consulTestRoot+"/app/a")
+	Assert(t, k != nil, "the key was not created")
+	Assertf(t, k.String() == "value app/a", "wrong value %q", k.String())
+
+	w := testConsulRequest(t, app, "GET", "/v1/kv/app/a", "")
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+
+	var entries []consulEntry
+	parseBody(t, w, &entries)
+	Assertf(t, len(entries) == 1, "expected 1 key, got %d", len(entries))
+	Assertf(t, entries[0].Key == "app/a", "wrong key %s", entries[0].Key)
+	Assertf(t, string(entries[0].Value) == "value app/a", "wrong value %q", entries[0].Value)
+
+	w = testConsulRequest(t, app, "GET", "/v1/kv/app/a?raw", "")
+	Assertf(t, w.Body.String() == "value app/a", "wrong raw value %q", w.Body.String())
+
+	w = testConsulRequest(t, app, "GET", "/v1/kv/app?recurse", "")
+	entries = nil
+	parseBody(t, w, &entries)
+	Assertf(t, len(entries) == 3, "expected 3 keys, got %d", len(entries))
+
+	w = testConsulRequest(t, app, "GET", "/v1/kv/app/?keys&separator=/", "")
+
+	var keys []string
+	parseBody(t, w, &keys)
+	Assertf(t, len(keys) == 3 && keys[2] == "app/sub/", "wrong keys %v", keys)
+
+	w = testConsulRequest(t, app, "GET", "/v1/kv/missing", "")
+	Assertf(t, w.Code == http.StatusNotFound, "wrong status code: %v", w.Code)
+
+	w = testConsulRequest(t, app, "DELETE", "/v1/kv/app?recurse", "")
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+	Assert(t, getKey(t, consulTestRoot+"/app/sub/c") == nil, "the keys were not deleted")
+}
+
+func TestConsulCAS(t *testing.T) {
+	app := testConsulServer(t)
+	defer removeTree(t, consulTestRoot)
+
+	w := testConsulRequest(t, app, "PUT", "/v1/kv/cas?cas=0", "first")
+	Assertf(t, w.Body.String() == "true", "the key was not created: %s", w.Body.String())
+
+	w = testConsulRequest(t, app, "PUT", "/v1/kv/cas?cas=0", "second")
+	Assertf(t, w.Body.String() == "false", "the key was created twice: %s", w.Body.String())
+
+	w = testConsulRequest(t, app, "GET", "/v1/kv/cas", "")
+
+	var entries []consulEntry
+	parseBody(t, w, &entries)
+
+	index := strconv.FormatInt(entries[0].ModifyIndex, 10)
+
+	w = testConsulRequest(t, app, "PUT", "/v1/kv/cas?cas="+index, "second")
+	Assertf(t, w.Body.String() == "true", "the key was not updated: %s", w.Body.String())
+
+	w = testConsulRequest(t, app, "DELETE", "/v1/kv/cas?cas="+index, "")
+	Assertf(t, w.Body.String() == "false", "the key was deleted with an old index: %s", w.Body.String())
+
+	w = testConsulRequest(t, app, "PUT", "/v1/kv/cas?cas=invalid", "")
+	Assertf(t, w.Code == http.StatusBadRequest, "wrong status code: %v", w.Code)
+}
+
+func TestConsulBlockingQuery(t *testing.T) {
+	app := testConsulServer(t)
+	defer removeTree(t, consulTestRoot)
+
+	w := testConsulRequest(t, app, "PUT", "/v1/kv/blocking", "first")
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+
+	w = testConsulRequest(t, app, "GET", "/v1/kv/blocking", "")
+	index := w.Header().Get("X-Consul-Index")
+	Assert(t, index != "", "no index returned")
+
+	w = testConsulRequest(t, app, "GET", "/v1/kv/blocking?index="+index+"&wait=10ms", "")
+	Assertf(t, w.Header().Get("X-Consul-Index") == index, "the index changed without changes")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		testConsulRequest(t, app, "PUT", "/v1/kv/blocking", "second")
+	}()
+
+	w = testConsulRequest(t, app, "GET", "/v1/kv/blocking?raw&index="+index+"&wait=5s", "")
+	Assertf(t, w.Header().Get("X-Consul-Index") != index, "the index did not change")
+	Assertf(t, w.Body.String() == "second", "wrong value %q", w.Body.String())
+}
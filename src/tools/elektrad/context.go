@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// maxSessionContexts is the count of resolver contexts a session may use
+// besides the default one, every context keeps its own handle open.
+const maxSessionContexts = 8
+
+var errTooManyContexts = fmt.Errorf("a session can not use more than %d resolver contexts", maxSessionContexts)
+
+// resolverContext is the environment used to resolve the configuration
+// files of the `dir:/` and `user:/` namespaces. The resolver determines the
+// files when a handle is opened, so every context needs its own handle.
+type resolverContext struct {
+	// cwd is the working directory used for `dir:/`
+	cwd string
+	// home is the home directory used for `user:/`
+	home string
+}
+
+// environmentMutex serializes the opening of handles, because the working
+// directory and environment are shared by the whole process.
+var environmentMutex sync.Mutex
+
+// serverEnvironment and serverDir are the environment and working directory
+// elektrad was started with. Child processes use them, so that they never
+// see the context of a handle that is opened at the same time.
+var (
+	serverEnvironment = os.Environ()
+	serverDir, _      = os.Getwd()
+)
+
+// contextDirs are the directories configured with `-context-dirs`, the
+// directories of a context must be inside of one of them. Without them only
+// the default context can be used.
+var contextDirs []string
+
+// parseResolverContext parses the `cwd` and `home` query parameters.
+func parseResolverContext(r *http.Request) (resolverContext, error) {
+	query := r.URL.Query()
+
+	var ctx resolverContext
+	var err error
+
+	if ctx.cwd, err = contextDirectory("cwd", query.Get("cwd")); err != nil {
+		return ctx, err
+	}
+
+	if ctx.home, err = contextDirectory("home", query.Get("home")); err != nil {
+		return ctx, err
+	}
+
+	return ctx, nil
+}
+
+// contextDirectory checks that `dir` is inside of one of the `contextDirs`,
+// otherwise clients could access the configuration of any directory the
+// server can read. It returns the directory with all symbolic links resolved,
+// so that links can not point outside of the allowed directories.
+func contextDirectory(name, dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+
+	if len(contextDirs) == 0 {
+		return "", fmt.Errorf("%s is not allowed, the server has no -context-dirs", name)
+	}
+
+	if !filepath.IsAbs(dir) {
+		return "", fmt.Errorf("%s must be an absolute path", name)
+	}
+
+	resolved, err := filepath.EvalSymlinks(dir)
+
+	if err != nil {
+		return "", fmt.Errorf("%s %s is not a directory", name, dir)
+	}
+
+	info, err := os.Stat(resolved)
+
+	if err != nil || !info.IsDir() {
+		return "", fmt.Errorf("%s %s is not a directory", name, dir)
+	}
+
+	for _, allowed := range contextDirs {
+		allowed, err := filepath.EvalSymlinks(allowed)
+
+		if err != nil {
+			continue
+		}
+
+		if isBelowOrSamePath(resolved, allowed) {
+			return resolved, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s %s is not inside of the -context-dirs", name, dir)
+}
+
+func (ctx resolverContext) isDefault() bool {
+	return ctx.cwd == "" && ctx.home == ""
+}
+
+// inContext calls `f` with the working directory and the `HOME` environment
+// variable of the context. Both are shared by the whole process, so nothing
+// but the opening of handles may depend on them: child processes are started
+// with `serverDir` and `serverEnvironment`.
+func (ctx resolverContext) inContext(f func() error) error {
+	environmentMutex.Lock()
+	defer environmentMutex.Unlock()
+
+	if ctx.cwd != "" {
+		oldCwd, err := os.Getwd()
+
+		if err != nil {
+			return err
+		}
+
+		if err = os.Chdir(ctx.cwd); err != nil {
+			return err
+		}
+
+		defer os.Chdir(oldCwd)
+	}
+
+	if ctx.home != "" {
+		defer restoreEnv("HOME")()
+		defer restoreEnv("XDG_CONFIG_HOME")()
+
+		os.Setenv("HOME", ctx.home)
+		os.Unsetenv("XDG_CONFIG_HOME")
+	}
+
+	return f()
+}
+
+// restoreEnv returns a function that restores the current value of the
+// environment variable `name`.
+func restoreEnv(name string) func() {
+	value, ok := os.LookupEnv(name)
+
+	return func() {
+		if ok {
+			os.Setenv(name, value)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+// contextHandle returns the handle of the session for the context. It is
+// opened on first use.
+func (s *session) contextHandle(ctx resolverContext) (*handle, error) {
+	if ctx.isDefault() {
+		return s.handle, nil
+	}
+
+	if h, ok := s.contexts[ctx]; ok {
+		return h, nil
+	}
+
+	if len(s.contexts) >= maxSessionContexts {
+		return nil, errTooManyContexts
+	}
+
+	var h *handle
+
+	err := ctx.inContext(func() (err error) {
+		h, err = openHandle()
+		return
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if s.contexts == nil {
+		s.contexts = map[resolverContext]*handle{}
+	}
+
+	s.contexts[ctx] = h
+
+	return h, nil
+}
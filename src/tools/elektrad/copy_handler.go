@@ -1 +1,134 @@
 package main
+
+import (
+	"net/http"
+	"strconv"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+// postCopyHandler copies all keys below the `source` key to the target key.
+//
+// Arguments:
+// 		source	the source key. URL path param.
+//		target	the target key. JSON string POST body.
+//		recursive	copy only the source key itself if `false`. Query param.
+//
+// Response Code:
+//		204 No Content if succesfull.
+//		400 Bad Request if either the source or target keys are invalid.
+//
+// Example: `curl -X POST -d '"user/test/world"' localhost:33333/kdbCp/user/test/hello`
+func (s *server) postCopyHandler(w http.ResponseWriter, r *http.Request) {
+	from := parseKeyNameFromURL(r)
+	to, err := stringBody(r)
+
+	if err != nil || from == "" || to == "" {
+		badRequest(w)
+		return
+	}
+
+	recursive, err := parseRecursive(r)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	fromKey, err := elektra.NewKey(from)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer fromKey.Close()
+
+	toKey, err := elektra.NewKey(to)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer toKey.Close()
+
+	handle, conf := getHandle(r)
+
+	if _, err = copyKeys(handle, conf, fromKey, toKey, recursive); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	noContent(w)
+}
+
+// copyKeys copies the key `fromKey` and, if `recursive` is set, all keys
+// below it to `toKey` and returns the count of copied keys. Existing keys
+// below `toKey` are overwritten.
+func copyKeys(handle elektra.KDB, conf elektra.KeySet, fromKey, toKey elektra.Key, recursive bool) (int, error) {
+	root := elektra.CommonKeyName(fromKey, toKey)
+
+	rootKey, err := elektra.NewKey(root)
+
+	if err != nil {
+		return 0, err // this should not happen
+	}
+
+	defer rootKey.Close()
+
+	_, err = handle.Get(conf, rootKey)
+
+	if err != nil {
+		return 0, err
+	}
+
+	copies := elektra.NewKeySet()
+	defer copies.Close()
+
+	for _, k := range conf.ToSlice() {
+		if transferred(k, fromKey, recursive) {
+			copies.AppendKey(renameKey(k, fromKey.Name(), toKey.Name()))
+		}
+	}
+
+	if copies.Len() == 0 {
+		return 0, nil
+	}
+
+	// the session KeySet only gets the copies if they are stored, otherwise
+	// the next write would commit them
+	newConf := conf.Duplicate()
+	defer newConf.Close()
+
+	newConf.Append(copies)
+
+	if err = set(handle, newConf, rootKey); err != nil {
+		return 0, err
+	}
+
+	conf.Append(copies)
+
+	return copies.Len(), nil
+}
+
+// parseRecursive parses the `recursive` query parameter of a copy or move,
+// which defaults to true.
+func parseRecursive(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get("recursive")
+
+	if value == "" {
+		return true, nil
+	}
+
+	return strconv.ParseBool(value)
+}
+
+// transferred checks if the key `k` is copied or moved from `fromKey`.
+func transferred(k, fromKey elektra.Key, recursive bool) bool {
+	if recursive {
+		return k.IsBelowOrSame(fromKey)
+	}
+
+	return k.Name() == fromKey.Name()
+}
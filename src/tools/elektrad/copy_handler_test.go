@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+func TestPostCopy(t *testing.T) {
+	keyNameFrom := "user:/tests/elektrad/kdbcp/post/from"
+	keyNameFromChild := keyNameFrom + "/child"
+	keyNameTo := "user:/tests/elektrad/kdbcp/post/to"
+
+	setupKey(t, keyNameFrom, keyNameFromChild)
+	removeTree(t, keyNameTo)
+
+	w := testPost(t, "/kdbCp/"+keyNameFrom, keyNameTo)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	from := getKey(t, keyNameFrom)
+	to := getKey(t, keyNameTo)
+	toChild := getKey(t, keyNameTo+"/child")
+
+	removeTree(t, "user:/tests/elektrad/kdbcp")
+
+	Assert(t, from != nil, "the source key was removed")
+	Assert(t, to != nil, "key has not been copied")
+	Assert(t, toChild != nil, "child key has not been copied")
+}
+
+func TestPostCopySingleBinaryKey(t *testing.T) {
+	root := "user:/tests/elektrad/kdbcp/single"
+
+	removeTree(t, root)
+	defer removeTree(t, root)
+
+	w := testPut(t, "/kdb/"+root+"/from?binary=true", "/wAB")
+	Assertf(t, w.Code == http.StatusCreated, "could not create binary key: %v", w.Code)
+
+	setupKey(t, root+"/from/child")
+
+	w = testPost(t, "/kdbCp/"+root+"/from?recursive=false", root+"/to")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	to := getKey(t, root+"/to")
+	Assert(t, to != nil, "key has not been copied")
+	Assert(t, isBinary(to), "the copy is not binary")
+	Assertf(t, bytes.Equal(to.Bytes(), []byte{0xff, 0x00, 0x01}), "wrong binary value %v", to.Bytes())
+	Assert(t, getKey(t, root+"/to/child") == nil, "child key has been copied")
+}
+
+// failingKDB fails to store any KeySet.
+type failingKDB struct {
+	elektra.KDB
+}
+
+func (failingKDB) Set(ks elektra.KeySet, parentKey elektra.Key) (bool, error) {
+	return false, errors.New("could not store the keys")
+}
+
+func TestCopyKeysFailure(t *testing.T) {
+	keyNameFrom := "user:/tests/elektrad/kdbcp/failure/from"
+	keyNameTo := "user:/tests/elektrad/kdbcp/failure/to"
+
+	setupKey(t, keyNameFrom)
+	defer removeTree(t, "user:/tests/elektrad/kdbcp/failure")
+
+	h, err := newHandle()
+	Check(t, err, "could not open handle")
+	defer closeHandle(h)
+
+	fromKey, err := elektra.NewKey(keyNameFrom)
+	Check(t, err, "could not create key")
+	defer fromKey.Close()
+
+	toKey, err := elektra.NewKey(keyNameTo)
+	Check(t, err, "could not create key")
+	defer toKey.Close()
+
+	_, err = copyKeys(failingKDB{h.kdb}, h.keySet, fromKey, toKey, true)
+	Assert(t, err != nil, "the failure was not reported")
+
+	Assert(t, h.keySet.LookupByName(keyNameTo) == nil, "the copy was left in the session KeySet")
+}
@@ -0,0 +1,361 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package elektradpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// KDBClient is the client API for KDB service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type KDBClient interface {
+	// Get returns the key and, if `recursive` is set, all keys below it.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	// Set sets the value and metadata of a key, the key is created if it
+	// does not exist.
+	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error)
+	// Delete deletes a key and, if `recursive` is set, all keys below it.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Move moves a key and all keys below it.
+	Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*MoveResponse, error)
+	// Copy copies a key and all keys below it.
+	Copy(ctx context.Context, in *CopyRequest, opts ...grpc.CallOption) (*CopyResponse, error)
+	// Find returns the keys whose names match a regular expression.
+	Find(ctx context.Context, in *FindRequest, opts ...grpc.CallOption) (*FindResponse, error)
+	// Watch streams the changes of a key and the keys below it.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (KDB_WatchClient, error)
+}
+
+type kDBClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKDBClient(cc grpc.ClientConnInterface) KDBClient {
+	return &kDBClient{cc}
+}
+
+func (c *kDBClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, "/elektrad.v1.KDB/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kDBClient) Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*SetResponse, error) {
+	out := new(SetResponse)
+	err := c.cc.Invoke(ctx, "/elektrad.v1.KDB/Set", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kDBClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/elektrad.v1.KDB/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kDBClient) Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*MoveResponse, error) {
+	out := new(MoveResponse)
+	err := c.cc.Invoke(ctx, "/elektrad.v1.KDB/Move", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kDBClient) Copy(ctx context.Context, in *CopyRequest, opts ...grpc.CallOption) (*CopyResponse, error) {
+	out := new(CopyResponse)
+	err := c.cc.Invoke(ctx, "/elektrad.v1.KDB/Copy", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kDBClient) Find(ctx context.Context, in *FindRequest, opts ...grpc.CallOption) (*FindResponse, error) {
+	out := new(FindResponse)
+	err := c.cc.Invoke(ctx, "/elektrad.v1.KDB/Find", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kDBClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (KDB_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &KDB_ServiceDesc.Streams[0], "/elektrad.v1.KDB/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kDBWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KDB_WatchClient interface {
+	Recv() (*WatchEvent, error)
+	grpc.ClientStream
+}
+
+type kDBWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *kDBWatchClient) Recv() (*WatchEvent, error) {
+	m := new(WatchEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// KDBServer is the server API for KDB service.
+// All implementations must embed UnimplementedKDBServer
+// for forward compatibility
+type KDBServer interface {
+	// Get returns the key and, if `recursive` is set, all keys below it.
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	// Set sets the value and metadata of a key, the key is created if it
+	// does not exist.
+	Set(context.Context, *SetRequest) (*SetResponse, error)
+	// Delete deletes a key and, if `recursive` is set, all keys below it.
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Move moves a key and all keys below it.
+	Move(context.Context, *MoveRequest) (*MoveResponse, error)
+	// Copy copies a key and all keys below it.
+	Copy(context.Context, *CopyRequest) (*CopyResponse, error)
+	// Find returns the keys whose names match a regular expression.
+	Find(context.Context, *FindRequest) (*FindResponse, error)
+	// Watch streams the changes of a key and the keys below it.
+	Watch(*WatchRequest, KDB_WatchServer) error
+	mustEmbedUnimplementedKDBServer()
+}
+
+// UnimplementedKDBServer must be embedded to have forward compatible implementations.
+type UnimplementedKDBServer struct {
+}
+
+func (UnimplementedKDBServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedKDBServer) Set(context.Context, *SetRequest) (*SetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedKDBServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedKDBServer) Move(context.Context, *MoveRequest) (*MoveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Move not implemented")
+}
+func (UnimplementedKDBServer) Copy(context.Context, *CopyRequest) (*CopyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Copy not implemented")
+}
+func (UnimplementedKDBServer) Find(context.Context, *FindRequest) (*FindResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Find not implemented")
+}
+func (UnimplementedKDBServer) Watch(*WatchRequest, KDB_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedKDBServer) mustEmbedUnimplementedKDBServer() {}
+
+// UnsafeKDBServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KDBServer will
+// result in compilation errors.
+type UnsafeKDBServer interface {
+	mustEmbedUnimplementedKDBServer()
+}
+
+func RegisterKDBServer(s grpc.ServiceRegistrar, srv KDBServer) {
+	s.RegisterService(&KDB_ServiceDesc, srv)
+}
+
+func _KDB_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDBServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/elektrad.v1.KDB/Get",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDBServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KDB_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDBServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/elektrad.v1.KDB/Set",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDBServer).Set(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KDB_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDBServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/elektrad.v1.KDB/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDBServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KDB_Move_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDBServer).Move(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/elektrad.v1.KDB/Move",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDBServer).Move(ctx, req.(*MoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KDB_Copy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CopyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDBServer).Copy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/elektrad.v1.KDB/Copy",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDBServer).Copy(ctx, req.(*CopyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KDB_Find_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDBServer).Find(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/elektrad.v1.KDB/Find",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDBServer).Find(ctx, req.(*FindRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KDB_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KDBServer).Watch(m, &kDBWatchServer{stream})
+}
+
+type KDB_WatchServer interface {
+	Send(*WatchEvent) error
+	grpc.ServerStream
+}
+
+type kDBWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *kDBWatchServer) Send(m *WatchEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// KDB_ServiceDesc is the grpc.ServiceDesc for KDB service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var KDB_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "elektrad.v1.KDB",
+	HandlerType: (*KDBServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Get",
+			Handler:    _KDB_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _KDB_Set_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _KDB_Delete_Handler,
+		},
+		{
+			MethodName: "Move",
+			Handler:    _KDB_Move_Handler,
+		},
+		{
+			MethodName: "Copy",
+			Handler:    _KDB_Copy_Handler,
+		},
+		{
+			MethodName: "Find",
+			Handler:    _KDB_Find_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _KDB_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "elektrad.proto",
+}
@@ -0,0 +1,5 @@
+// Package elektradpb contains the protobuf messages and the gRPC service of
+// the gRPC API of elektrad.
+package elektradpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative elektrad.proto
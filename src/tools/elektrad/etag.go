@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+// maxTrackedSubtrees is the count of subtrees whose modification time is
+// tracked, older entries are forgotten when it is exceeded.
+const maxTrackedSubtrees = 10000
+
+// modificationTimes tracks the `Last-Modified` time of subtrees. Elektra does
+// not store modification times, so the time elektrad first saw the current
+// state of a subtree is used.
+var modificationTimes = &modificationTracker{
+	states: map[string]subtreeState{},
+}
+
+type subtreeState struct {
+	etag  string
+	since time.Time
+}
+
+type modificationTracker struct {
+	mut    sync.Mutex
+	states map[string]subtreeState
+}
+
+// lastModified returns the time the subtree `id` was first seen with the
+// ETag `etag`.
+func (t *modificationTracker) lastModified(id, etag string) time.Time {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	state, ok := t.states[id]
+
+	if ok && state.etag == etag {
+		return state.since
+	}
+
+	if !ok && len(t.states) >= maxTrackedSubtrees {
+		t.states = map[string]subtreeState{}
+	}
+
+	// Last-Modified only has a precision of seconds
+	state = subtreeState{etag: etag, since: time.Now().UTC().Truncate(time.Second)}
+	t.states[id] = state
+
+	return state.since
+}
+
+// writeCacheHeaders sets the `ETag` and `Last-Modified` headers of the
+// subtree below `root`. If the conditional headers of the request match, it
+// writes `304 Not Modified` and returns true.
+func writeCacheHeaders(w http.ResponseWriter, r *http.Request, ks elektra.KeySet, root elektra.Key) bool {
+	variant := requestVariant(r)
+	etag := subtreeETag(ks, root, variant)
+	modified := modificationTimes.lastModified(root.Name()+"\x00"+variant, etag)
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+
+	// If-Modified-Since is ignored if If-None-Match is present (RFC 7232)
+	if r.Header.Get("If-None-Match") != "" {
+		if etagMatches(r, etag) {
+			notModified(w)
+			return true
+		}
+
+		return false
+	}
+
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !modified.After(since) {
+		notModified(w)
+		return true
+	}
+
+	return false
+}
+
+// requestVariant identifies the representation requested by `r`: its query
+// parameters in a canonical order and the streaming format.
+func requestVariant(r *http.Request) string {
+	variant := r.URL.Query().Encode()
+
+	if isNDJSONRequest(r) {
+		variant += "\x00ndjson"
+	}
+
+	return variant
+}
+
+// subtreeETag returns an ETag for the keys below and including `root`. It
+// changes if any name, value or metakey of these keys changes. `variant`
+// distinguishes different representations of the same keys, e.g. the query
+// parameters of the request.
+func subtreeETag(ks elektra.KeySet, root elektra.Key, variant string) string {
+	hash := sha256.New()
+
+	writeField := func(s string) {
+		_, _ = io.WriteString(hash, s)
+		_, _ = hash.Write([]byte{0})
+	}
+
+	writeField(variant)
+
+	for _, k := range ks.ToSlice() {
+		if !k.IsBelowOrSame(root) {
+			continue
+		}
+
+		writeField(k.Name())
+		writeField(string(k.Bytes()))
+
+		meta := metaMap(k)
+		names := make([]string, 0, len(meta))
+
+		for name := range meta {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			writeField(name)
+			writeField(meta[name])
+		}
+
+		writeField("")
+	}
+
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches checks if the `If-None-Match` header of the request matches
+// `etag`, using the weak comparison of RFC 7232.
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,952 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	elektra "go.libelektra.org/kdb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// etcdHistorySize is the count of events kept for watches that start at
+	// an earlier revision.
+	etcdHistorySize = 1000
+	// etcdClusterID and etcdMemberID identify the gateway in response
+	// headers.
+	etcdClusterID = 0x656c656b74726164
+	etcdMemberID  = 1
+)
+
+// etcdGateway implements the KV and Watch services of the etcd v3 API for the
+// keys below a root key. The etcd keys are the paths of the keys below the
+// root, e.g. the etcd key `/app/port` is the key `user:/etcd/app/port` for
+// the root `user:/etcd`.
+//
+// Elektra has no revisions, so the gateway numbers the changes it observes.
+// The revisions start at 1 when elektrad starts. Changes made outside of the
+// gateway get a revision when the gateway refreshes its view of the keys,
+// which happens on every request and in the refresh interval.
+type etcdGateway struct {
+	etcdserverpb.UnimplementedKVServer
+	etcdserverpb.UnimplementedWatchServer
+
+	// root is the name of the key that contains the etcd keys
+	root   string
+	handle *handle
+
+	mut      sync.Mutex
+	revision int64
+	keys     map[string]*mvccpb.KeyValue
+	// history contains the latest events
+	history []*mvccpb.Event
+	// compacted is the latest revision that is not in the history
+	compacted int64
+	// changed is closed and replaced when there are new events
+	changed chan struct{}
+}
+
+// etcdWatcher is a watch of an etcd Watch stream.
+type etcdWatcher struct {
+	id       int64
+	key      []byte
+	rangeEnd []byte
+	prevKv   bool
+	noPut    bool
+	noDelete bool
+	// next is the revision of the next event sent to the watcher
+	next int64
+}
+
+func newEtcdGateway(root string) (*etcdGateway, error) {
+	rootKey, err := elektra.NewKey(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rootKey.Close()
+
+	h, err := newHandle()
+
+	if err != nil {
+		return nil, err
+	}
+
+	g := &etcdGateway{
+		root:      rootKey.Name(),
+		handle:    h,
+		revision:  1,
+		keys:      map[string]*mvccpb.KeyValue{},
+		compacted: 1,
+		changed:   make(chan struct{}),
+	}
+
+	current, err := g.read()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range current {
+		g.keys[key] = &mvccpb.KeyValue{
+			Key:            []byte(key),
+			Value:          value,
+			CreateRevision: 1,
+			ModRevision:    1,
+			Version:        1,
+		}
+	}
+
+	return g, nil
+}
+
+func serveEtcd(port int, g *etcdGateway, refreshInterval time.Duration) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+
+	if err != nil {
+		return err
+	}
+
+	go g.refreshLoop(refreshInterval)
+
+	s := grpc.NewServer()
+	etcdserverpb.RegisterKVServer(s, g)
+	etcdserverpb.RegisterWatchServer(s, g)
+
+	return s.Serve(listener)
+}
+
+// refreshLoop notices changes made outside of the gateway.
+func (g *etcdGateway) refreshLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		g.mut.Lock()
+		_ = g.refresh(nil)
+		g.mut.Unlock()
+	}
+}
+
+// invalidate refreshes the view of the keys after a change notification.
+func (g *etcdGateway) invalidate(keyName string) {
+	g.mut.Lock()
+	_ = g.refresh(nil)
+	g.mut.Unlock()
+}
+
+// elektraName returns the name of the key of an etcd key. The mapping is
+// reversible: the etcd key `/a/b` is the key `a/b` below the root, etcd keys
+// without a leading `/` start with an empty part, e.g. `a/b` is `%/a/b`.
+// Empty segments are escaped with `escapeEtcdSegment`.
+func (g *etcdGateway) elektraName(key string) string {
+	name := strings.TrimSuffix(g.root, "/")
+
+	if strings.HasPrefix(key, "/") {
+		key = key[1:]
+	} else {
+		name += "/" + escapeKeyNamePart("")
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		name += "/" + escapeKeyNamePart(escapeEtcdSegment(segment))
+	}
+
+	return name
+}
+
+// etcdKey returns the etcd key of a key below the root, it reverses
+// `elektraName`.
+func (g *etcdGateway) etcdKey(name string) string {
+	parts := splitKeyName(relativeKeyName(g.root, name))
+	key := "/"
+
+	if len(parts) > 0 && parts[0] == "" {
+		key = ""
+		parts = parts[1:]
+	}
+
+	for i, part := range parts {
+		parts[i] = unescapeEtcdSegment(part)
+	}
+
+	return key + strings.Join(parts, "/")
+}
+
+// escapeEtcdSegment escapes a segment of an etcd key, so that it is never
+// empty: empty segments become `%` and segments starting with `%` get
+// another `%`.
+func escapeEtcdSegment(segment string) string {
+	if segment == "" || strings.HasPrefix(segment, "%") {
+		return "%" + segment
+	}
+
+	return segment
+}
+
+func unescapeEtcdSegment(part string) string {
+	if strings.HasPrefix(part, "%") {
+		return part[1:]
+	}
+
+	return part
+}
+
+// read returns the values of all keys below the root by etcd key.
+func (g *etcdGateway) read() (map[string][]byte, error) {
+	rootKey, err := elektra.NewKey(g.root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rootKey.Close()
+
+	if _, err = g.handle.kdb.Get(g.handle.keySet, rootKey); err != nil {
+		return nil, err
+	}
+
+	values := map[string][]byte{}
+
+	for _, k := range g.handle.keySet.ToSlice() {
+		if !k.IsBelow(rootKey) {
+			continue
+		}
+
+		if isBinary(k) {
+			values[g.etcdKey(k.Name())] = k.Bytes()
+		} else {
+			values[g.etcdKey(k.Name())] = []byte(k.String())
+		}
+	}
+
+	return values, nil
+}
+
+// refresh reads the keys and records the changes as a new revision. The
+// `touched` keys are recorded as changed even if their value is unchanged.
+// It must be called with the mutex locked.
+func (g *etcdGateway) refresh(touched map[string]bool) error {
+	current, err := g.read()
+
+	if err != nil {
+		return err
+	}
+
+	var events []*mvccpb.Event
+
+	revision := g.revision + 1
+
+	for key, value := range current {
+		prev, ok := g.keys[key]
+
+		if ok && !touched[key] && bytes.Equal(prev.Value, value) {
+			continue
+		}
+
+		kv := &mvccpb.KeyValue{
+			Key:            []byte(key),
+			Value:          value,
+			CreateRevision: revision,
+			ModRevision:    revision,
+			Version:        1,
+		}
+
+		if ok {
+			kv.CreateRevision = prev.CreateRevision
+			kv.Version = prev.Version + 1
+		}
+
+		events = append(events, &mvccpb.Event{Type: mvccpb.PUT, Kv: kv, PrevKv: prev})
+	}
+
+	for key, prev := range g.keys {
+		if _, ok := current[key]; !ok {
+			kv := &mvccpb.KeyValue{Key: prev.Key, ModRevision: revision}
+			events = append(events, &mvccpb.Event{Type: mvccpb.DELETE, Kv: kv, PrevKv: prev})
+		}
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return bytes.Compare(events[i].Kv.Key, events[j].Kv.Key) < 0
+	})
+
+	g.revision = revision
+
+	for _, event := range events {
+		if event.Type == mvccpb.DELETE {
+			delete(g.keys, string(event.Kv.Key))
+		} else {
+			g.keys[string(event.Kv.Key)] = event.Kv
+		}
+	}
+
+	g.history = append(g.history, events...)
+
+	if drop := len(g.history) - etcdHistorySize; drop > 0 {
+		g.compacted = g.history[drop-1].Kv.ModRevision
+		g.history = append([]*mvccpb.Event(nil), g.history[drop:]...)
+	}
+
+	close(g.changed)
+	g.changed = make(chan struct{})
+
+	return nil
+}
+
+func (g *etcdGateway) header() *etcdserverpb.ResponseHeader {
+	return &etcdserverpb.ResponseHeader{
+		ClusterId: etcdClusterID,
+		MemberId:  etcdMemberID,
+		Revision:  g.revision,
+		RaftTerm:  1,
+	}
+}
+
+// inRange checks if `key` is in the etcd range `[start, end)`.
+func inRange(key, start, end []byte) bool {
+	switch {
+	case len(end) == 0:
+		return bytes.Equal(key, start)
+	case len(end) == 1 && end[0] == 0:
+		return bytes.Compare(key, start) >= 0
+	}
+
+	return bytes.Compare(key, start) >= 0 && bytes.Compare(key, end) < 0
+}
+
+// keysInRange returns the keys in the range sorted by key.
+func (g *etcdGateway) keysInRange(start, end []byte) []*mvccpb.KeyValue {
+	var kvs []*mvccpb.KeyValue
+
+	for _, kv := range g.keys {
+		if inRange(kv.Key, start, end) {
+			kvs = append(kvs, kv)
+		}
+	}
+
+	sort.Slice(kvs, func(i, j int) bool {
+		return bytes.Compare(kvs[i].Key, kvs[j].Key) < 0
+	})
+
+	return kvs
+}
+
+func (g *etcdGateway) Range(ctx context.Context, req *etcdserverpb.RangeRequest) (*etcdserverpb.RangeResponse, error) {
+	g.mut.Lock()
+	defer g.mut.Unlock()
+
+	if err := g.refresh(nil); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	return g.rangeKeys(req)
+}
+
+// rangeKeys reads the keys of the current revision, older revisions are not
+// available.
+func (g *etcdGateway) rangeKeys(req *etcdserverpb.RangeRequest) (*etcdserverpb.RangeResponse, error) {
+	switch {
+	case req.Revision > g.revision:
+		return nil, rpctypes.ErrGRPCFutureRev
+	case req.Revision > 0 && req.Revision < g.revision:
+		return nil, rpctypes.ErrGRPCCompacted
+	}
+
+	var kvs []*mvccpb.KeyValue
+
+	for _, kv := range g.keysInRange(req.Key, req.RangeEnd) {
+		switch {
+		case req.MinModRevision > 0 && kv.ModRevision < req.MinModRevision,
+			req.MaxModRevision > 0 && kv.ModRevision > req.MaxModRevision,
+			req.MinCreateRevision > 0 && kv.CreateRevision < req.MinCreateRevision,
+			req.MaxCreateRevision > 0 && kv.CreateRevision > req.MaxCreateRevision:
+			continue
+		}
+
+		kvs = append(kvs, kv)
+	}
+
+	sortKeyValues(kvs, req.SortTarget, req.SortOrder)
+
+	resp := &etcdserverpb.RangeResponse{
+		Header: g.header(),
+		Count:  int64(len(kvs)),
+	}
+
+	if req.CountOnly {
+		return resp, nil
+	}
+
+	if req.Limit > 0 && int64(len(kvs)) > req.Limit {
+		kvs = kvs[:req.Limit]
+		resp.More = true
+	}
+
+	for _, kv := range kvs {
+		if req.KeysOnly {
+			kv = &mvccpb.KeyValue{
+				Key:            kv.Key,
+				CreateRevision: kv.CreateRevision,
+				ModRevision:    kv.ModRevision,
+				Version:        kv.Version,
+			}
+		}
+
+		resp.Kvs = append(resp.Kvs, kv)
+	}
+
+	return resp, nil
+}
+
+func sortKeyValues(kvs []*mvccpb.KeyValue, target etcdserverpb.RangeRequest_SortTarget, order etcdserverpb.RangeRequest_SortOrder) {
+	if order == etcdserverpb.RangeRequest_NONE {
+		// the keys are sorted by key
+		return
+	}
+
+	less := func(a, b *mvccpb.KeyValue) bool {
+		switch target {
+		case etcdserverpb.RangeRequest_VERSION:
+			return a.Version < b.Version
+		case etcdserverpb.RangeRequest_CREATE:
+			return a.CreateRevision < b.CreateRevision
+		case etcdserverpb.RangeRequest_MOD:
+			return a.ModRevision < b.ModRevision
+		case etcdserverpb.RangeRequest_VALUE:
+			return bytes.Compare(a.Value, b.Value) < 0
+		}
+
+		return bytes.Compare(a.Key, b.Key) < 0
+	}
+
+	sort.SliceStable(kvs, func(i, j int) bool {
+		if order == etcdserverpb.RangeRequest_DESCEND {
+			return less(kvs[j], kvs[i])
+		}
+
+		return less(kvs[i], kvs[j])
+	})
+}
+
+// etcdTxn collects the changes of a request, they are written in a single
+// commit. The changes are made to a copy of the keys of the gateway, which
+// replaces them only if the commit succeeds.
+type etcdTxn struct {
+	g       *etcdGateway
+	ks      elektra.KeySet
+	touched map[string]bool
+}
+
+func (g *etcdGateway) newTxn() *etcdTxn {
+	return &etcdTxn{
+		g:       g,
+		ks:      g.handle.keySet.Duplicate(),
+		touched: map[string]bool{},
+	}
+}
+
+// close discards the changes if they were not committed.
+func (txn *etcdTxn) close() {
+	if txn.ks != nil {
+		txn.ks.Close()
+		txn.ks = nil
+	}
+}
+
+func (txn *etcdTxn) put(req *etcdserverpb.PutRequest) (*etcdserverpb.PutResponse, error) {
+	if req.Lease != 0 || req.IgnoreLease {
+		return nil, status.Error(codes.Unimplemented, "leases are not supported")
+	}
+
+	if len(req.Key) == 0 {
+		return nil, rpctypes.ErrGRPCEmptyKey
+	}
+
+	name := txn.g.elektraName(string(req.Key))
+	// the key as it is read back by `refresh`
+	key := txn.g.etcdKey(name)
+	prev := txn.g.keys[key]
+
+	if txn.touched[key] {
+		return nil, rpctypes.ErrGRPCDuplicateKey
+	}
+
+	value := req.Value
+
+	if req.IgnoreValue {
+		if prev == nil {
+			return nil, rpctypes.ErrGRPCKeyNotFound
+		}
+
+		value = prev.Value
+	}
+
+	k := txn.ks.LookupByName(name)
+
+	if k == nil {
+		var err error
+
+		if k, err = elektra.NewKey(name); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid key %q", key)
+		}
+
+		txn.ks.AppendKey(k)
+	}
+
+	var err error
+
+	if utf8.Valid(value) {
+		err = k.SetString(string(value))
+	} else {
+		err = k.SetBytes(value)
+	}
+
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	txn.touched[key] = true
+
+	resp := &etcdserverpb.PutResponse{}
+
+	if req.PrevKv {
+		resp.PrevKv = prev
+	}
+
+	return resp, nil
+}
+
+func (txn *etcdTxn) deleteRange(req *etcdserverpb.DeleteRangeRequest) (*etcdserverpb.DeleteRangeResponse, error) {
+	resp := &etcdserverpb.DeleteRangeResponse{}
+
+	for _, kv := range txn.g.keysInRange(req.Key, req.RangeEnd) {
+		if txn.touched[string(kv.Key)] {
+			return nil, rpctypes.ErrGRPCDuplicateKey
+		}
+
+		txn.ks.RemoveByName(txn.g.elektraName(string(kv.Key)))
+		txn.touched[string(kv.Key)] = true
+		resp.Deleted++
+
+		if req.PrevKv {
+			resp.PrevKvs = append(resp.PrevKvs, kv)
+		}
+	}
+
+	return resp, nil
+}
+
+// commit writes the changes and returns the header of the new revision.
+func (txn *etcdTxn) commit() (*etcdserverpb.ResponseHeader, error) {
+	if len(txn.touched) > 0 {
+		rootKey, err := elektra.NewKey(txn.g.root)
+
+		if err != nil {
+			return nil, err
+		}
+
+		defer rootKey.Close()
+
+		if err = set(txn.g.handle.kdb, txn.ks, rootKey); err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+
+		txn.g.handle.keySet.Close()
+		txn.g.handle.keySet = txn.ks
+		txn.ks = nil
+	}
+
+	if err := txn.g.refresh(txn.touched); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	return txn.g.header(), nil
+}
+
+// begin locks the gateway and reads the current keys.
+func (g *etcdGateway) begin() (*etcdTxn, error) {
+	g.mut.Lock()
+
+	if err := g.refresh(nil); err != nil {
+		g.mut.Unlock()
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+
+	return g.newTxn(), nil
+}
+
+func (g *etcdGateway) Put(ctx context.Context, req *etcdserverpb.PutRequest) (*etcdserverpb.PutResponse, error) {
+	txn, err := g.begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer g.mut.Unlock()
+	defer txn.close()
+
+	resp, err := txn.put(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Header, err = txn.commit(); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (g *etcdGateway) DeleteRange(ctx context.Context, req *etcdserverpb.DeleteRangeRequest) (*etcdserverpb.DeleteRangeResponse, error) {
+	txn, err := g.begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer g.mut.Unlock()
+	defer txn.close()
+
+	resp, err := txn.deleteRange(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Header, err = txn.commit(); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Txn applies the operations of the chosen branch in a single commit. Range
+// operations return the keys as they were before the transaction.
+func (g *etcdGateway) Txn(ctx context.Context, req *etcdserverpb.TxnRequest) (*etcdserverpb.TxnResponse, error) {
+	txn, err := g.begin()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer g.mut.Unlock()
+	defer txn.close()
+
+	resp := &etcdserverpb.TxnResponse{
+		Succeeded: true,
+	}
+
+	for _, c := range req.Compare {
+		if !g.compare(c) {
+			resp.Succeeded = false
+			break
+		}
+	}
+
+	ops := req.Success
+
+	if !resp.Succeeded {
+		ops = req.Failure
+	}
+
+	for _, op := range ops {
+		var result *etcdserverpb.ResponseOp
+
+		switch r := op.Request.(type) {
+		case *etcdserverpb.RequestOp_RequestRange:
+			rangeResp, err := g.rangeKeys(r.RequestRange)
+
+			if err != nil {
+				return nil, err
+			}
+
+			result = &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponseRange{ResponseRange: rangeResp}}
+		case *etcdserverpb.RequestOp_RequestPut:
+			putResp, err := txn.put(r.RequestPut)
+
+			if err != nil {
+				return nil, err
+			}
+
+			result = &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponsePut{ResponsePut: putResp}}
+		case *etcdserverpb.RequestOp_RequestDeleteRange:
+			deleteResp, err := txn.deleteRange(r.RequestDeleteRange)
+
+			if err != nil {
+				return nil, err
+			}
+
+			result = &etcdserverpb.ResponseOp{Response: &etcdserverpb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: deleteResp}}
+		default:
+			return nil, status.Error(codes.Unimplemented, "nested transactions are not supported")
+		}
+
+		resp.Responses = append(resp.Responses, result)
+	}
+
+	if resp.Header, err = txn.commit(); err != nil {
+		return nil, err
+	}
+
+	// the writes get the revision of the transaction
+	for _, result := range resp.Responses {
+		switch r := result.Response.(type) {
+		case *etcdserverpb.ResponseOp_ResponsePut:
+			r.ResponsePut.Header = resp.Header
+		case *etcdserverpb.ResponseOp_ResponseDeleteRange:
+			r.ResponseDeleteRange.Header = resp.Header
+		}
+	}
+
+	return resp, nil
+}
+
+// compare evaluates a comparison of a transaction, all keys of its range
+// must satisfy it.
+func (g *etcdGateway) compare(c *etcdserverpb.Compare) bool {
+	kvs := g.keysInRange(c.Key, c.RangeEnd)
+
+	if len(kvs) == 0 {
+		if c.Target == etcdserverpb.Compare_VALUE {
+			return false
+		}
+
+		// missing keys have version and revisions 0
+		kvs = []*mvccpb.KeyValue{{Key: c.Key}}
+	}
+
+	for _, kv := range kvs {
+		var result int
+
+		switch c.Target {
+		case etcdserverpb.Compare_VERSION:
+			result = compareInt(kv.Version, c.GetVersion())
+		case etcdserverpb.Compare_CREATE:
+			result = compareInt(kv.CreateRevision, c.GetCreateRevision())
+		case etcdserverpb.Compare_MOD:
+			result = compareInt(kv.ModRevision, c.GetModRevision())
+		case etcdserverpb.Compare_VALUE:
+			result = bytes.Compare(kv.Value, c.GetValue())
+		case etcdserverpb.Compare_LEASE:
+			result = compareInt(0, c.GetLease())
+		}
+
+		var ok bool
+
+		switch c.Result {
+		case etcdserverpb.Compare_EQUAL:
+			ok = result == 0
+		case etcdserverpb.Compare_GREATER:
+			ok = result > 0
+		case etcdserverpb.Compare_LESS:
+			ok = result < 0
+		case etcdserverpb.Compare_NOT_EQUAL:
+			ok = result != 0
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
+
+func (g *etcdGateway) Watch(stream etcdserverpb.Watch_WatchServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	var sendMut sync.Mutex
+
+	send := func(resp *etcdserverpb.WatchResponse) error {
+		sendMut.Lock()
+		defer sendMut.Unlock()
+
+		return stream.Send(resp)
+	}
+
+	cancels := map[int64]context.CancelFunc{}
+	nextID := int64(0)
+
+	for {
+		req, err := stream.Recv()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		switch r := req.RequestUnion.(type) {
+		case *etcdserverpb.WatchRequest_CreateRequest:
+			w := newEtcdWatcher(r.CreateRequest)
+
+			if w.id == 0 {
+				w.id = nextID
+			}
+
+			if _, ok := cancels[w.id]; ok {
+				return rpctypes.ErrGRPCDuplicateKey
+			}
+
+			for nextID <= w.id {
+				nextID++
+			}
+
+			g.mut.Lock()
+
+			if w.next == 0 {
+				w.next = g.revision + 1
+			}
+
+			header := g.header()
+			g.mut.Unlock()
+
+			if err = send(&etcdserverpb.WatchResponse{Header: header, WatchId: w.id, Created: true}); err != nil {
+				return err
+			}
+
+			watchCtx, cancelWatch := context.WithCancel(ctx)
+			cancels[w.id] = cancelWatch
+
+			go g.runWatcher(watchCtx, w, send)
+		case *etcdserverpb.WatchRequest_CancelRequest:
+			id := r.CancelRequest.WatchId
+
+			if cancelWatch, ok := cancels[id]; ok {
+				cancelWatch()
+				delete(cancels, id)
+			}
+
+			g.mut.Lock()
+			header := g.header()
+			g.mut.Unlock()
+
+			if err = send(&etcdserverpb.WatchResponse{Header: header, WatchId: id, Canceled: true}); err != nil {
+				return err
+			}
+		case *etcdserverpb.WatchRequest_ProgressRequest:
+			g.mut.Lock()
+			header := g.header()
+			g.mut.Unlock()
+
+			if err = send(&etcdserverpb.WatchResponse{Header: header, WatchId: -1}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func newEtcdWatcher(req *etcdserverpb.WatchCreateRequest) *etcdWatcher {
+	w := &etcdWatcher{
+		id:       req.WatchId,
+		key:      req.Key,
+		rangeEnd: req.RangeEnd,
+		prevKv:   req.PrevKv,
+		next:     req.StartRevision,
+	}
+
+	for _, filter := range req.Filters {
+		switch filter {
+		case etcdserverpb.WatchCreateRequest_NOPUT:
+			w.noPut = true
+		case etcdserverpb.WatchCreateRequest_NODELETE:
+			w.noDelete = true
+		}
+	}
+
+	return w
+}
+
+// runWatcher sends the events of the watcher until the context is canceled.
+func (g *etcdGateway) runWatcher(ctx context.Context, w *etcdWatcher, send func(*etcdserverpb.WatchResponse) error) {
+	for {
+		g.mut.Lock()
+
+		if w.next <= g.compacted {
+			resp := &etcdserverpb.WatchResponse{
+				Header:          g.header(),
+				WatchId:         w.id,
+				Canceled:        true,
+				CompactRevision: g.compacted + 1,
+				CancelReason:    rpctypes.ErrCompacted.Error(),
+			}
+			g.mut.Unlock()
+
+			_ = send(resp)
+			return
+		}
+
+		var events []*mvccpb.Event
+
+		for _, event := range g.history {
+			if event.Kv.ModRevision >= w.next && w.matches(event) {
+				events = append(events, w.event(event))
+			}
+		}
+
+		w.next = g.revision + 1
+		header := g.header()
+		changed := g.changed
+
+		g.mut.Unlock()
+
+		if len(events) > 0 {
+			if err := send(&etcdserverpb.WatchResponse{Header: header, WatchId: w.id, Events: events}); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+func (w *etcdWatcher) matches(event *mvccpb.Event) bool {
+	if event.Type == mvccpb.PUT && w.noPut || event.Type == mvccpb.DELETE && w.noDelete {
+		return false
+	}
+
+	return inRange(event.Kv.Key, w.key, w.rangeEnd)
+}
+
+func (w *etcdWatcher) event(event *mvccpb.Event) *mvccpb.Event {
+	if w.prevKv {
+		return event
+	}
+
+	return &mvccpb.Event{Type: event.Type, Kv: event.Kv}
+}
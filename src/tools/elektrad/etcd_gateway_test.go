@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const etcdTestRoot = "user:/tests/elektrad/etcd"
+
+func testEtcdGateway(t *testing.T) (*etcdGateway, *grpc.ClientConn, func()) {
+	t.Helper()
+
+	removeTree(t, etcdTestRoot)
+
+	g, err := newEtcdGateway(etcdTestRoot)
+	Check(t, err, "could not create gateway")
+
+	listener := bufconn.Listen(1024 * 1024)
+
+	s := grpc.NewServer()
+	etcdserverpb.RegisterKVServer(s, g)
+	etcdserverpb.RegisterWatchServer(s, g)
+
+	go s.Serve(listener)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	Check(t, err, "could not connect")
+
+	return g, conn, func() {
+		conn.Close()
+		s.Stop()
+		removeTree(t, etcdTestRoot)
+	}
+}
+
+func TestEtcdPutAndRange(t *testing.T) {
+	_, conn, closeGateway := testEtcdGateway(t)
+	defer closeGateway()
+
+	kv := etcdserverpb.NewKVClient(conn)
+	ctx := context.Background()
+
+	for _, key := range []string{"/app/a", "/app/b", "/app/c", "/other"} {
+		_, err := kv.Put(ctx, &etcdserverpb.PutRequest{Key: []byte(key), Value: []byte("value " + key)})
+		Check(t, err, "could not put key")
+	}
+
+	k := getKey(t, etcdTestRoot+"/app/b")
+	Assert(t, k != nil, "the key was not created")
+	Assertf(t, k.String() == "value /app/b", "wrong value %q", k.String())
+
+	resp, err := kv.Range(ctx, &etcdserverpb.RangeRequest{Key: []byte("/app/a")})
+	Check(t, err, "could not get key")
+	Assertf(t, len(resp.Kvs) == 1, "expected 1 key, got %d", len(resp.Kvs))
+	Assertf(t, string(resp.Kvs[0].Value) == "value /app/a", "wrong value %q", resp.Kvs[0].Value)
+	Assertf(t, resp.Kvs[0].Version == 1, "wrong version %d", resp.Kvs[0].Version)
+
+	resp, err = kv.Range(ctx, &etcdserverpb.RangeRequest{
+		Key:       []byte("/app/"),
+		RangeEnd:  []byte("/app0"),
+		Limit:     2,
+		SortOrder: etcdserverpb.RangeRequest_DESCEND,
+	})
+	Check(t, err, "could not get keys")
+	Assertf(t, resp.Count == 3, "expected count 3, got %d", resp.Count)
+	Assert(t, resp.More, "more keys are expected")
+	Assertf(t, len(resp.Kvs) == 2, "expected 2 keys, got %d", len(resp.Kvs))
+	Assertf(t, string(resp.Kvs[0].Key) == "/app/c", "wrong key %q", resp.Kvs[0].Key)
+
+	put, err := kv.Put(ctx, &etcdserverpb.PutRequest{Key: []byte("/app/a"), Value: []byte("new"), PrevKv: true})
+	Check(t, err, "could not put key")
+	Assertf(t, string(put.PrevKv.Value) == "value /app/a", "wrong previous value %q", put.PrevKv.Value)
+
+	resp, err = kv.Range(ctx, &etcdserverpb.RangeRequest{Key: []byte("/app/a")})
+	Check(t, err, "could not get key")
+	Assertf(t, resp.Kvs[0].Version == 2, "wrong version %d", resp.Kvs[0].Version)
+	Assertf(t, resp.Kvs[0].ModRevision == put.Header.Revision, "wrong mod revision %d", resp.Kvs[0].ModRevision)
+
+	deleted, err := kv.DeleteRange(ctx, &etcdserverpb.DeleteRangeRequest{Key: []byte("/app/"), RangeEnd: []byte("/app0")})
+	Check(t, err, "could not delete keys")
+	Assertf(t, deleted.Deleted == 3, "expected 3 deleted keys, got %d", deleted.Deleted)
+	Assert(t, getKey(t, etcdTestRoot+"/app/a") == nil, "the key was not deleted")
+
+	resp, err = kv.Range(ctx, &etcdserverpb.RangeRequest{Key: []byte{0}, RangeEnd: []byte{0}, CountOnly: true})
+	Check(t, err, "could not get keys")
+	Assertf(t, resp.Count == 1, "expected count 1, got %d", resp.Count)
+}
+
+func TestEtcdKeyMapping(t *testing.T) {
+	g, conn, closeGateway := testEtcdGateway(t)
+	defer closeGateway()
+
+	kv := etcdserverpb.NewKVClient(conn)
+	ctx := context.Background()
+
+	keys := []string{"foo", "/foo", "a/", "a//b", "a/b", "/a/b", "//a", "%", "/%a"}
+
+	for _, key := range keys {
+		Assertf(t, g.etcdKey(g.elektraName(key)) == key, "the key %q does not round-trip: %q", key, g.etcdKey(g.elektraName(key)))
+
+		_, err := kv.Put(ctx, &etcdserverpb.PutRequest{Key: []byte(key), Value: []byte("value " + key)})
+		Checkf(t, err, "could not put key %q", key)
+	}
+
+	for _, key := range keys {
+		resp, err := kv.Range(ctx, &etcdserverpb.RangeRequest{Key: []byte(key)})
+		Checkf(t, err, "could not get key %q", key)
+		Assertf(t, len(resp.Kvs) == 1, "expected 1 key for %q, got %d", key, len(resp.Kvs))
+		Assertf(t, string(resp.Kvs[0].Value) == "value "+key, "wrong value of %q: %q", key, resp.Kvs[0].Value)
+		Assertf(t, resp.Kvs[0].Version == 1, "wrong version of %q: %d", key, resp.Kvs[0].Version)
+	}
+
+	k := getKey(t, etcdTestRoot+"/foo")
+	Assert(t, k != nil && k.String() == "value /foo", "keys with a leading slash are not stored below the root")
+
+	// putting the same value is a new version
+	_, err := kv.Put(ctx, &etcdserverpb.PutRequest{Key: []byte("foo"), Value: []byte("value foo")})
+	Check(t, err, "could not put key")
+
+	resp, err := kv.Range(ctx, &etcdserverpb.RangeRequest{Key: []byte("foo")})
+	Check(t, err, "could not get key")
+	Assertf(t, len(resp.Kvs) == 1 && resp.Kvs[0].Version == 2, "wrong version %v", resp.Kvs)
+
+	_, err = kv.Put(ctx, &etcdserverpb.PutRequest{Key: []byte(""), Value: []byte("value")})
+	Assert(t, err != nil, "empty keys must be rejected")
+}
+
+func TestEtcdFailedCommit(t *testing.T) {
+	g, conn, closeGateway := testEtcdGateway(t)
+	defer closeGateway()
+
+	kv := etcdserverpb.NewKVClient(conn)
+	ctx := context.Background()
+
+	_, err := kv.Put(ctx, &etcdserverpb.PutRequest{Key: []byte("/kept"), Value: []byte("1")})
+	Check(t, err, "could not put key")
+
+	kdb := g.handle.kdb
+	g.handle.kdb = failingKDB{kdb}
+
+	_, err = kv.Txn(ctx, &etcdserverpb.TxnRequest{
+		Success: []*etcdserverpb.RequestOp{
+			{Request: &etcdserverpb.RequestOp_RequestPut{RequestPut: &etcdserverpb.PutRequest{Key: []byte("/new"), Value: []byte("2")}}},
+			{Request: &etcdserverpb.RequestOp_RequestDeleteRange{RequestDeleteRange: &etcdserverpb.DeleteRangeRequest{Key: []byte("/kept")}}},
+		},
+	})
+	Assert(t, err != nil, "the failed commit was not reported")
+
+	// the keys are checked without reading them again
+	Assert(t, g.handle.keySet.LookupByName(etcdTestRoot+"/new") == nil, "the put of the failed transaction was applied")
+	Assert(t, g.handle.keySet.LookupByName(etcdTestRoot+"/kept") != nil, "the delete of the failed transaction was applied")
+
+	g.handle.kdb = kdb
+
+	_, err = kv.Txn(ctx, &etcdserverpb.TxnRequest{
+		Success: []*etcdserverpb.RequestOp{
+			{Request: &etcdserverpb.RequestOp_RequestPut{RequestPut: &etcdserverpb.PutRequest{Key: []byte("/other"), Value: []byte("3")}}},
+			{Request: &etcdserverpb.RequestOp_RequestPut{RequestPut: &etcdserverpb.PutRequest{Key: []byte("/other"), Value: []byte("4")}}},
+		},
+	})
+	Assert(t, err != nil, "the duplicate key was not reported")
+	Assert(t, g.handle.keySet.LookupByName(etcdTestRoot+"/other") == nil, "the put of the invalid transaction was applied")
+}
+
+func TestEtcdTxn(t *testing.T) {
+	_, conn, closeGateway := testEtcdGateway(t)
+	defer closeGateway()
+
+	kv := etcdserverpb.NewKVClient(conn)
+	ctx := context.Background()
+
+	put := func(key, value string) *etcdserverpb.RequestOp {
+		return &etcdserverpb.RequestOp{Request: &etcdserverpb.RequestOp_RequestPut{
+			RequestPut: &etcdserverpb.PutRequest{Key: []byte(key), Value: []byte(value)},
+		}}
+	}
+
+	// create the key if it does not exist
+	notExists := &etcdserverpb.Compare{
+		Key:         []byte("/lock"),
+		Target:      etcdserverpb.Compare_CREATE,
+		Result:      etcdserverpb.Compare_EQUAL,
+		TargetUnion: &etcdserverpb.Compare_CreateRevision{CreateRevision: 0},
+	}
+
+	txn := &etcdserverpb.TxnRequest{
+		Compare: []*etcdserverpb.Compare{notExists},
+		Success: []*etcdserverpb.RequestOp{put("/lock", "owner"), put("/owner", "me")},
+	}
+
+	resp, err := kv.Txn(ctx, txn)
+	Check(t, err, "could not commit transaction")
+	Assert(t, resp.Succeeded, "the transaction failed")
+	Assertf(t, len(resp.Responses) == 2, "expected 2 responses, got %d", len(resp.Responses))
+
+	resp, err = kv.Txn(ctx, txn)
+	Check(t, err, "could not commit transaction")
+	Assert(t, !resp.Succeeded, "the transaction succeeded twice")
+
+	lock, err := kv.Range(ctx, &etcdserverpb.RangeRequest{Key: []byte("/lock")})
+	Check(t, err, "could not get key")
+	Assertf(t, lock.Kvs[0].CreateRevision == lock.Kvs[0].ModRevision, "wrong revisions %v", lock.Kvs[0])
+
+	owner, err := kv.Range(ctx, &etcdserverpb.RangeRequest{Key: []byte("/owner")})
+	Check(t, err, "could not get key")
+	Assert(t, owner.Kvs[0].ModRevision == lock.Kvs[0].ModRevision, "the transaction has more than one revision")
+
+	// compare and swap
+	resp, err = kv.Txn(ctx, &etcdserverpb.TxnRequest{
+		Compare: []*etcdserverpb.Compare{{
+			Key:         []byte("/owner"),
+			Target:      etcdserverpb.Compare_VALUE,
+			Result:      etcdserverpb.Compare_EQUAL,
+			TargetUnion: &etcdserverpb.Compare_Value{Value: []byte("me")},
+		}},
+		Success: []*etcdserverpb.RequestOp{put("/owner", "you")},
+	})
+	Check(t, err, "could not commit transaction")
+	Assert(t, resp.Succeeded, "the transaction failed")
+
+	k := getKey(t, etcdTestRoot+"/owner")
+	Assertf(t, k.String() == "you", "wrong value %q", k.String())
+}
+
+func TestEtcdWatch(t *testing.T) {
+	g, conn, closeGateway := testEtcdGateway(t)
+	defer closeGateway()
+
+	kv := etcdserverpb.NewKVClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first, err := kv.Put(ctx, &etcdserverpb.PutRequest{Key: []byte("/watch/a"), Value: []byte("1")})
+	Check(t, err, "could not put key")
+
+	stream, err := etcdserverpb.NewWatchClient(conn).Watch(ctx)
+	Check(t, err, "could not watch keys")
+
+	err = stream.Send(&etcdserverpb.WatchRequest{RequestUnion: &etcdserverpb.WatchRequest_CreateRequest{
+		CreateRequest: &etcdserverpb.WatchCreateRequest{
+			Key:           []byte("/watch/"),
+			RangeEnd:      []byte("/watch0"),
+			StartRevision: first.Header.Revision,
+		},
+	}})
+	Check(t, err, "could not create watch")
+
+	resp, err := stream.Recv()
+	Check(t, err, "could not receive response")
+	Assert(t, resp.Created, "the watch was not created")
+
+	// the events since the start revision are sent first
+	resp, err = stream.Recv()
+	Check(t, err, "could not receive events")
+	Assertf(t, len(resp.Events) == 1, "expected 1 event, got %d", len(resp.Events))
+	Assertf(t, string(resp.Events[0].Kv.Key) == "/watch/a", "wrong key %q", resp.Events[0].Kv.Key)
+
+	// changes made outside of the gateway are noticed on refresh
+	setupKey(t, etcdTestRoot+"/watch/b")
+
+	g.mut.Lock()
+	err = g.refresh(nil)
+	g.mut.Unlock()
+	Check(t, err, "could not refresh")
+
+	resp, err = stream.Recv()
+	Check(t, err, "could not receive events")
+	Assertf(t, len(resp.Events) == 1, "expected 1 event, got %d", len(resp.Events))
+	Assertf(t, string(resp.Events[0].Kv.Key) == "/watch/b", "wrong key %q", resp.Events[0].Kv.Key)
+
+	_, err = kv.DeleteRange(ctx, &etcdserverpb.DeleteRangeRequest{Key: []byte("/watch/a")})
+	Check(t, err, "could not delete key")
+
+	resp, err = stream.Recv()
+	Check(t, err, "could not receive events")
+	Assertf(t, len(resp.Events) == 1, "expected 1 event, got %d", len(resp.Events))
+	Assertf(t, resp.Events[0].Type == mvccpb.DELETE, "wrong event type %v", resp.Events[0].Type)
+}
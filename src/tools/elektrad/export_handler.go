@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+var (
+	envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	// resourceNamePattern matches valid names of Kubernetes resources.
+	resourceNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?$`)
+)
+
+// exportVariable is a key exported as environment variable.
+type exportVariable struct {
+	name   string
+	value  []byte
+	binary bool
+}
+
+// exportFormats maps the names of the export formats to their content type
+// and writer.
+var exportFormats = map[string]struct {
+	contentType string
+	write       func(vars []exportVariable, opts exportOptions) (string, error)
+}{
+	"dotenv":    {"text/plain; charset=utf-8", writeDotenv},
+	"shell":     {"text/x-shellscript; charset=utf-8", writeShellExports},
+	"configmap": {"application/yaml", writeConfigMap},
+	"secret":    {"application/yaml", writeSecret},
+}
+
+type exportOptions struct {
+	// name and namespace of Kubernetes resources
+	name      string
+	namespace string
+}
+
+// getExportHandler exports a subtree in formats used for deployments:
+// environment variables in `.env` files or as shell `export` statements and
+// Kubernetes ConfigMap or Secret manifests.
+//
+// The name of a variable is the name of the key relative to the `strip` key
+// in UPPER_SNAKE_CASE, e.g. `APP_PORT` for `user:/sw/org/app/port` and the
+// `strip` key `user:/sw/org`. Array indices are used without `#` and
+// characters other than letters and digits are replaced with `_`. Keys
+// without value that have keys below them are not exported. The keys of a
+// cascading key (a name without namespace) are resolved by cascading lookup,
+// the `spec` namespace only provides their defaults.
+//
+// Arguments:
+//		keyName		the name of the exported key. URL path param.
+//		format		`dotenv`, `shell`, `configmap` or `secret`. Query parameter.
+//		strip		the key the variable names are relative to, defaults
+//					to the exported key. Optional query parameter.
+//		prefix		prepended to all variable names. Optional query parameter.
+//		name		the name of the ConfigMap or Secret, defaults to the base
+//					name of the exported key. Optional query parameter.
+//		kubeNamespace	the Kubernetes namespace of the ConfigMap or Secret.
+//					Optional query parameter.
+//
+// Response Code:
+//		200 OK with the exported keys.
+//		400 Bad Request if a parameter is invalid, keys map to the same
+//			variable name or binary keys are exported as variables.
+//
+// Example: `curl 'localhost:33333/kdbExport/user/sw/org/app?format=dotenv&prefix=APP_'`
+func (s *server) getExportHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format, ok := exportFormats[query.Get("format")]
+
+	if !ok {
+		writeError(w, errors.New("unknown format"))
+		return
+	}
+
+	keyName := parseKeyNameFromURL(r)
+
+	if cascadingName(keyName) == keyName && !strings.HasPrefix(keyName, "/") {
+		// the leading slash of cascading names is lost in the URL
+		keyName = "/" + keyName
+	}
+
+	root, err := elektra.NewKey(keyName)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer root.Close()
+
+	strip := root.Name()
+
+	if name := query.Get("strip"); name != "" {
+		stripKey, err := elektra.NewKey(name)
+
+		if err != nil || !root.IsBelowOrSame(stripKey) {
+			writeError(w, errors.New("strip must be the exported key or above it"))
+			return
+		}
+
+		strip = stripKey.Name()
+		stripKey.Close()
+	}
+
+	prefix := query.Get("prefix")
+
+	if prefix != "" && !envNamePattern.MatchString(prefix) {
+		writeError(w, errors.New("invalid prefix"))
+		return
+	}
+
+	opts := exportOptions{
+		name:      query.Get("name"),
+		namespace: query.Get("kubeNamespace"),
+	}
+
+	if opts.name == "" {
+		opts.name = resourceName(root.BaseName())
+	}
+
+	if !resourceNamePattern.MatchString(opts.name) || opts.namespace != "" && !resourceNamePattern.MatchString(opts.namespace) {
+		writeError(w, errors.New("invalid name or namespace"))
+		return
+	}
+
+	handle, ks := getHandle(r)
+
+	if _, err = handle.Get(ks, root); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var subtree elektra.KeySet
+
+	if cascadingName(root.Name()) == root.Name() {
+		subtree = resolveCascading(ks, root)
+	} else {
+		dup := ks.Duplicate()
+		defer dup.Close()
+
+		subtree = dup.Cut(root)
+	}
+
+	defer subtree.Close()
+
+	vars, err := exportVariables(subtree, strip, prefix)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	out, err := format.write(vars, opts)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Write([]byte(out))
+}
+
+// resolveCascading returns the keys below the cascading key `root` resolved
+// by cascading lookup and named by their cascading names, so that every key
+// is exported once. Keys of the `spec` namespace only provide defaults.
+func resolveCascading(ks elektra.KeySet, root elektra.Key) elektra.KeySet {
+	resolved := elektra.NewKeySet()
+	seen := map[string]bool{}
+
+	for _, k := range ks.ToSlice() {
+		name := cascadingName(k.Name())
+
+		if seen[name] || !k.IsBelowOrSame(root) {
+			continue
+		}
+
+		seen[name] = true
+
+		resolvedKey := lookupCascading(ks, name)
+
+		if resolvedKey == nil {
+			continue
+		}
+
+		cascadingKey := resolvedKey.Duplicate(elektra.KEY_CP_ALL)
+		cascadingKey.SetName(name)
+		resolved.AppendKey(cascadingKey)
+
+		// the key of a `default` value is not part of the KeySet
+		if ks.Lookup(resolvedKey) == nil {
+			resolvedKey.Close()
+		}
+	}
+
+	return resolved
+}
+
+// exportVariables returns the variables of the keys sorted by name.
+func exportVariables(ks elektra.KeySet, strip, prefix string) ([]exportVariable, error) {
+	keys := ks.ToSlice()
+	sources := map[string]string{}
+
+	var vars []exportVariable
+
+	for i, k := range keys {
+		hasChildren := i+1 < len(keys) && keys[i+1].IsBelow(k)
+
+		if hasChildren && len(k.Bytes()) == 0 {
+			continue
+		}
+
+		relativeName := relativeKeyName(strip, k.Name())
+
+		if relativeName == "" {
+			continue
+		}
+
+		name := prefix + envName(relativeName)
+
+		if other, ok := sources[name]; ok {
+			return nil, fmt.Errorf("the keys %s and %s have the same name %s", other, k.Name(), name)
+		}
+
+		sources[name] = k.Name()
+
+		v := exportVariable{name: name, binary: isBinary(k)}
+
+		if v.binary {
+			v.value = k.Bytes()
+		} else {
+			v.value = []byte(k.String())
+		}
+
+		vars = append(vars, v)
+	}
+
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].name < vars[j].name
+	})
+
+	return vars, nil
+}
+
+// envName converts a relative key name to an environment variable name in
+// UPPER_SNAKE_CASE.
+func envName(relativeName string) string {
+	var parts []string
+
+	for _, part := range splitKeyName(relativeName) {
+		if i, ok := parseArrayIndex(part); ok {
+			part = strconv.Itoa(i)
+		}
+
+		parts = append(parts, strings.Map(func(c rune) rune {
+			switch {
+			case c >= 'a' && c <= 'z':
+				return c - 'a' + 'A'
+			case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+				return c
+			}
+
+			return '_'
+		}, part))
+	}
+
+	name := strings.Join(parts, "_")
+
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// resourceName converts a base name to a Kubernetes resource name.
+func resourceName(baseName string) string {
+	name := strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			return c - 'A' + 'a'
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '.':
+			return c
+		}
+
+		return '-'
+	}, baseName)
+
+	return strings.Trim(name, "-.")
+}
+
+func textVariables(vars []exportVariable) error {
+	for _, v := range vars {
+		if v.binary {
+			return fmt.Errorf("the binary variable %s can not be exported", v.name)
+		}
+	}
+
+	return nil
+}
+
+// writeDotenv writes the variables as `.env` file with double quoted values.
+func writeDotenv(vars []exportVariable, _ exportOptions) (string, error) {
+	if err := textVariables(vars); err != nil {
+		return "", err
+	}
+
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+
+	var b strings.Builder
+
+	for _, v := range vars {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", v.name, replacer.Replace(string(v.value)))
+	}
+
+	return b.String(), nil
+}
+
+// writeShellExports writes the variables as POSIX shell `export` statements
+// with single quoted values.
+func writeShellExports(vars []exportVariable, _ exportOptions) (string, error) {
+	if err := textVariables(vars); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	for _, v := range vars {
+		fmt.Fprintf(&b, "export %s='%s'\n", v.name, strings.Replace(string(v.value), "'", `'\''`, -1))
+	}
+
+	return b.String(), nil
+}
+
+// writeConfigMap writes the variables as Kubernetes ConfigMap, binary values
+// are part of `binaryData`.
+func writeConfigMap(vars []exportVariable, opts exportOptions) (string, error) {
+	var data, binaryData []exportVariable
+
+	for _, v := range vars {
+		if v.binary {
+			binaryData = append(binaryData, v)
+		} else {
+			data = append(data, v)
+		}
+	}
+
+	var b strings.Builder
+
+	writeManifestHeader(&b, "ConfigMap", opts)
+	writeYAMLMap(&b, "data", data, false)
+	writeYAMLMap(&b, "binaryData", binaryData, true)
+
+	return b.String(), nil
+}
+
+// writeSecret writes the variables as opaque Kubernetes Secret.
+func writeSecret(vars []exportVariable, opts exportOptions) (string, error) {
+	var b strings.Builder
+
+	writeManifestHeader(&b, "Secret", opts)
+	b.WriteString("type: Opaque\n")
+	writeYAMLMap(&b, "data", vars, true)
+
+	return b.String(), nil
+}
+
+func writeManifestHeader(b *strings.Builder, kind string, opts exportOptions) {
+	fmt.Fprintf(b, "apiVersion: v1\nkind: %s\nmetadata:\n  name: %s\n", kind, opts.name)
+
+	if opts.namespace != "" {
+		fmt.Fprintf(b, "  namespace: %s\n", opts.namespace)
+	}
+}
+
+// writeYAMLMap writes the variables as YAML map, the values are quoted JSON
+// strings, which are valid YAML.
+func writeYAMLMap(b *strings.Builder, field string, vars []exportVariable, encode bool) {
+	if len(vars) == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "%s:\n", field)
+
+	for _, v := range vars {
+		value := string(v.value)
+
+		if encode {
+			value = base64.StdEncoding.EncodeToString(v.value)
+		}
+
+		quoted, _ := json.Marshal(value)
+
+		fmt.Fprintf(b, "  %s: %s\n", v.name, quoted)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetExport(t *testing.T) {
+	root := "user:/tests/elektrad/export/my-app"
+
+	w := testPut(t, "/kdbTree/"+root, map[string]interface{}{
+		"port":  8080,
+		"hosts": []string{"a", "b"},
+		"db": map[string]interface{}{
+			"user-name": "it's \"me\"",
+		},
+	})
+	Assertf(t, w.Code == http.StatusNoContent, "could not write tree: %v", w.Code)
+
+	defer removeTree(t, "user:/tests/elektrad/export")
+
+	w = testGet(t, "/kdbExport/"+root+"?format=dotenv&prefix=APP_")
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+
+	expected := "APP_DB_USER_NAME=\"it's \\\"me\\\"\"\nAPP_HOSTS_0=\"a\"\nAPP_HOSTS_1=\"b\"\nAPP_PORT=\"8080\"\n"
+	Assertf(t, w.Body.String() == expected, "wrong dotenv file %q", w.Body.String())
+
+	w = testGet(t, "/kdbExport/"+root+"/db?format=shell&strip=user:/tests/elektrad/export")
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+
+	expected = "export MY_APP_DB_USER_NAME='it'\\''s \"me\"'\n"
+	Assertf(t, w.Body.String() == expected, "wrong shell exports %q", w.Body.String())
+
+	w = testGet(t, "/kdbExport/"+root+"?format=configmap&kubeNamespace=prod")
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+
+	expected = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: my-app
+  namespace: prod
+data:
+  DB_USER_NAME: "it's \"me\""
+  HOSTS_0: "a"
+  HOSTS_1: "b"
+  PORT: "8080"
+`
+	Assertf(t, w.Body.String() == expected, "wrong config map %q", w.Body.String())
+
+	w = testGet(t, "/kdbExport/"+root+"/port?format=secret&name=port&strip="+root)
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+
+	expected = "apiVersion: v1\nkind: Secret\nmetadata:\n  name: port\ntype: Opaque\ndata:\n  PORT: \"ODA4MA==\"\n"
+	Assertf(t, w.Body.String() == expected, "wrong secret %q", w.Body.String())
+
+	w = testGet(t, "/kdbExport/"+root+"?format=yaml")
+	Assertf(t, w.Code == http.StatusBadRequest, "wrong status code: %v", w.Code)
+
+	w = testGet(t, "/kdbExport/"+root+"?format=dotenv&strip=user:/other")
+	Assertf(t, w.Code == http.StatusBadRequest, "wrong status code: %v", w.Code)
+}
+
+func TestEnvName(t *testing.T) {
+	for relativeName, expected := range map[string]string{
+		"port":           "PORT",
+		"db/user-name":   "DB_USER_NAME",
+		"hosts/#_10":     "HOSTS_10",
+		"#0/host":        "_0_HOST",
+		`a\/b/Camel.Key`: "A_B_CAMEL_KEY",
+	} {
+		name := envName(relativeName)
+		Assertf(t, name == expected, "wrong name %s for %s, expected %s", name, relativeName, expected)
+	}
+}
+
+func TestGetExportCascading(t *testing.T) {
+	root := "/tests/elektrad/export/cascading"
+
+	removeTree(t, "spec:"+root)
+	removeTree(t, "user:"+root)
+
+	defer removeTree(t, "spec:"+root)
+	defer removeTree(t, "user:"+root)
+
+	portDefault := "80"
+	hostDefault := "localhost"
+
+	setupKeyWithMeta(t, "spec:"+root+"/port", keyValueBody{Key: "default", Value: &portDefault})
+	setupKeyWithMeta(t, "spec:"+root+"/host", keyValueBody{Key: "default", Value: &hostDefault})
+	w := testPut(t, "/kdb/user:"+root+"/port", "8080")
+	Assertf(t, w.Code == http.StatusCreated, "could not set port: %v", w.Code)
+
+	w = testGet(t, "/kdbExport"+root+"?format=dotenv")
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v %s", w.Code, w.Body.String())
+
+	expected := "HOST=\"localhost\"\nPORT=\"8080\"\n"
+	Assertf(t, w.Body.String() == expected, "wrong dotenv file %q", w.Body.String())
+}
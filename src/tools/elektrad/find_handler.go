@@ -1,37 +1,104 @@
 package main
 
 import (
+	"encoding/base64"
+	"fmt"
 	"net/http"
+	"path"
 	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/gorilla/mux"
 	elektra "go.libelektra.org/kdb"
 )
 
+type findFilter struct {
+	// field is `name`, `value` or `meta:<name>`
+	field string
+	match func(s string) bool
+}
+
+type findOptions struct {
+	filters   []*findFilter
+	namespace string
+	values    bool
+	meta      bool
+	limit     int
+	after     string
+}
+
+type findResult struct {
+	Name     string            `json:"name,omitempty"`
+	BaseName string            `json:"basename,omitempty"`
+	Value    *string           `json:"value,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+}
+
+type findResponse struct {
+	Keys []*findResult `json:"keys"`
+	Next string        `json:"next,omitempty"`
+}
+
 // getFindHandler searches for Keys via a Regex expression.
 //
+// If any of `values`, `meta`, `limit` or `cursor` is passed the response is
+// a JSON marshaled `findResponse` struct instead of a string array.
+//
 // Arguments:
 // 		regex	the regex expression to find keys, URL path param.
+//		match	how patterns are matched: `regex` (default), `glob` or
+//				`substring`. Optional query parameter.
+//		filter	additional filters `<field>=<value>` or `<field>~=<pattern>`
+//				where field is `name`, `value` or `meta:<name>`, e.g.
+//				`meta:type=boolean`. Optional repeatable query parameter.
+//		below	only search keys below this key. Optional query parameter.
+//		namespace	only search keys of this namespace. Optional query parameter.
+//		values	if `true` the values are returned. Optional query parameter (bool).
+//		meta	if `true` the metadata is returned. Optional query parameter (bool).
+//		limit	the maximum count of returned keys. Optional query parameter (int).
+//		cursor	continue after the page that returned this `next` cursor.
+//				Optional query parameter.
 //
 // Response Code:
 //		200 OK if the request was successfull.
-// 		400 Bad Request if the REGEX is invalid.
+// 		400 Bad Request if the REGEX or any other argument is invalid.
 //
 // Returns: String array with found keys.
 //
 // Example: `curl localhost:33333/kdbFind/versi*`
 func (s *server) getFindHandler(w http.ResponseWriter, r *http.Request) {
-	query := parseKeyNameFromURL(r)
-	regex, err := regexp.Compile(query)
+	query := r.URL.Query()
+	mode := query.Get("match")
+
+	opts, err := parseFindOptions(r, mode)
 
 	if err != nil {
-		badRequest(w)
+		writeError(w, err)
 		return
 	}
 
-	root, err := elektra.NewKey("/")
+	if pattern := mux.Vars(r)["path"]; pattern != "" {
+		nameFilter, err := newFindFilter("name", mode, pattern)
+
+		if err != nil {
+			badRequest(w)
+			return
+		}
+
+		opts.filters = append([]*findFilter{nameFilter}, opts.filters...)
+	}
+
+	rootName := query.Get("below")
+
+	if rootName == "" {
+		rootName = "/"
+	}
+
+	root, err := elektra.NewKey(rootName)
 
 	if err != nil {
-		writeError(w, err) // this should not happen
+		writeError(w, err)
 		return
 	}
 
@@ -46,14 +113,263 @@ func (s *server) getFindHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results := []string{}
+	results, next := find(ks, root, opts)
 
-	ks.ForEach(func(key elektra.Key, _ int) {
-		name := key.Name()
-		if regex.MatchString(name) {
-			results = append(results, name)
+	_, hasLimit := query["limit"]
+	_, hasCursor := query["cursor"]
+
+	if !opts.values && !opts.meta && !hasLimit && !hasCursor {
+		names := []string{}
+
+		for _, result := range results {
+			names = append(names, result.Name)
 		}
+
+		writeResponse(w, names)
+		return
+	}
+
+	writeResponse(w, findResponse{
+		Keys: results,
+		Next: next,
 	})
+}
+
+// find returns the keys below `root` that match all filters. If the limit
+// is reached the cursor for the next page is returned too.
+func find(ks elektra.KeySet, root elektra.Key, opts *findOptions) (results []*findResult, next string) {
+	results = []*findResult{}
+
+	var last elektra.Key
+	var afterKey elektra.Key
+
+	if opts.after != "" {
+		var err error
+
+		// the cursor is validated by parseFindOptions
+		if afterKey, err = elektra.NewKey(opts.after); err == nil {
+			defer afterKey.Close()
+		}
+	}
+
+	for _, key := range ks.ToSlice() {
+		if !key.IsBelowOrSame(root) {
+			continue
+		}
+
+		if afterKey != nil && key.Compare(afterKey) <= 0 {
+			continue
+		}
+
+		if opts.namespace != "" && !strings.HasPrefix(key.Name(), opts.namespace+":/") {
+			continue
+		}
+
+		if !opts.matches(key) {
+			continue
+		}
+
+		if opts.limit > 0 && len(results) == opts.limit {
+			next = encodeCursor(last.Name())
+			break
+		}
+
+		result := &findResult{
+			Name: key.Name(),
+		}
+
+		if opts.values {
+			value := key.String()
+
+			if isBinary(key) {
+				value = base64.StdEncoding.EncodeToString(key.Bytes())
+			}
+
+			result.Value = &value
+		}
+
+		if opts.meta {
+			result.Meta = key.MetaMap()
+		}
+
+		results = append(results, result)
+		last = key
+	}
+
+	return
+}
+
+func (opts *findOptions) matches(key elektra.Key) bool {
+	for _, filter := range opts.filters {
+		switch {
+		case filter.field == "name":
+			if !filter.match(key.Name()) {
+				return false
+			}
+		case filter.field == "value":
+			if isBinary(key) || !filter.match(key.String()) {
+				return false
+			}
+		default:
+			metaName := strings.TrimPrefix(filter.field, "meta:")
+
+			if !hasMeta(key, metaName) || !filter.match(key.Meta(metaName)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func parseFindOptions(r *http.Request, mode string) (*findOptions, error) {
+	query := r.URL.Query()
+
+	opts := &findOptions{
+		namespace: query.Get("namespace"),
+	}
+
+	var err error
+
+	for _, filter := range query["filter"] {
+		f, err := parseFindFilter(filter, mode)
+
+		if err != nil {
+			return nil, err
+		}
+
+		opts.filters = append(opts.filters, f)
+	}
+
+	if opts.values, err = parseOptionalBool(query.Get("values")); err != nil {
+		return nil, err
+	}
+
+	if opts.meta, err = parseOptionalBool(query.Get("meta")); err != nil {
+		return nil, err
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		if opts.limit, err = strconv.Atoi(limit); err != nil || opts.limit < 1 {
+			return nil, fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		if opts.after, err = decodeCursor(cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
+
+// parseFindFilter parses a filter `<field>=<value>` (exact match) or
+// `<field>~=<pattern>` (matched according to `mode`).
+func parseFindFilter(filter, mode string) (*findFilter, error) {
+	i := strings.Index(filter, "=")
+
+	if i < 1 {
+		return nil, fmt.Errorf("invalid filter %q", filter)
+	}
+
+	field, value := filter[:i], filter[i+1:]
+
+	if strings.HasSuffix(field, "~") {
+		return newFindFilter(strings.TrimSuffix(field, "~"), mode, value)
+	}
+
+	if err := checkFindField(field); err != nil {
+		return nil, err
+	}
+
+	return &findFilter{
+		field: field,
+		match: func(s string) bool {
+			return s == value
+		},
+	}, nil
+}
+
+func newFindFilter(field, mode, pattern string) (*findFilter, error) {
+	if err := checkFindField(field); err != nil {
+		return nil, err
+	}
+
+	match, err := newMatcher(mode, pattern)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &findFilter{
+		field: field,
+		match: match,
+	}, nil
+}
+
+func checkFindField(field string) error {
+	if field == "name" || field == "value" || (strings.HasPrefix(field, "meta:") && len(field) > len("meta:")) {
+		return nil
+	}
+
+	return fmt.Errorf("invalid filter field %q", field)
+}
+
+func newMatcher(mode, pattern string) (func(s string) bool, error) {
+	switch mode {
+	case "", "regex":
+		regex, err := regexp.Compile(pattern)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return regex.MatchString, nil
+	case "glob":
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, err
+		}
+
+		return func(s string) bool {
+			matched, _ := path.Match(pattern, s)
+			return matched
+		}, nil
+	case "substring":
+		return func(s string) bool {
+			return strings.Contains(s, pattern)
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid match mode %q", mode)
+	}
+}
+
+func parseOptionalBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+
+	return strconv.ParseBool(value)
+}
+
+func encodeCursor(keyName string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(keyName))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	keyName, err := base64.RawURLEncoding.DecodeString(cursor)
+
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor %q", cursor)
+	}
+
+	key, err := elektra.NewKey(string(keyName))
+
+	if err != nil {
+		return "", fmt.Errorf("invalid cursor %q", cursor)
+	}
+
+	key.Close()
 
-	writeResponse(w, results)
+	return string(keyName), nil
 }
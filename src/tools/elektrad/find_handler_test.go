@@ -29,3 +29,82 @@ func TestGetFind(t *testing.T) {
 		removeKey(t, keyName)
 	}
 }
+
+func TestGetFindFilter(t *testing.T) {
+	value := "boolean"
+
+	setupKey(t, "user:/tests/elektrad/kdbfind/filter/a")
+	setupKeyWithMeta(t, "user:/tests/elektrad/kdbfind/filter/b", keyValueBody{Key: "type", Value: &value})
+	setupKey(t, "user:/tests/elektrad/kdbfind/filter/c")
+
+	w := testGet(t, "/kdbFind?below=user:/tests/elektrad/kdbfind/filter&filter=meta:type=boolean&values=true&meta=true")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	result := findResponse{}
+	parseBody(t, w, &result)
+	Assertf(t, len(result.Keys) == 1, "result should have len() 1 but has %d", len(result.Keys))
+	Assertf(t, result.Keys[0].Name == "user:/tests/elektrad/kdbfind/filter/b", "wrong key %s", result.Keys[0].Name)
+	Assertf(t, result.Keys[0].Value != nil, "the value should be returned")
+	Assertf(t, result.Keys[0].Meta["type"] == "boolean" || result.Keys[0].Meta["meta:/type"] == "boolean", "the meta should be returned")
+
+	w = testGet(t, "/kdbFind/user:/tests/elektrad/*/filter/[ac]?match=glob")
+
+	names := []string{}
+	parseBody(t, w, &names)
+	Assertf(t, len(names) == 2, "glob result should have len() 2 but has %d", len(names))
+
+	w = testGet(t, "/kdbFind?filter=name")
+	Assertf(t, w.Result().StatusCode == http.StatusBadRequest, "wrong status code for invalid filter: %v", w.Result().StatusCode)
+
+	w = testGet(t, "/kdbFind?filter=foo~=x")
+	Assertf(t, w.Result().StatusCode == http.StatusBadRequest, "wrong status code for invalid field: %v", w.Result().StatusCode)
+
+	removeTree(t, "user:/tests/elektrad/kdbfind/filter")
+}
+
+func TestGetFindPagination(t *testing.T) {
+	keyNames := []string{
+		"user:/tests/elektrad/kdbfind/page/a",
+		"user:/tests/elektrad/kdbfind/page/b",
+		"user:/tests/elektrad/kdbfind/page/c",
+	}
+
+	setupKey(t, keyNames...)
+
+	var found []string
+	path := "/kdbFind/kdbfind/page/?limit=2"
+
+	for i := 0; i < 3; i++ {
+		w := testGet(t, path)
+
+		code := w.Result().StatusCode
+		Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+		result := findResponse{}
+		parseBody(t, w, &result)
+
+		for _, k := range result.Keys {
+			found = append(found, k.Name)
+		}
+
+		if result.Next == "" {
+			break
+		}
+
+		path = "/kdbFind/kdbfind/page/?limit=2&cursor=" + result.Next
+	}
+
+	Assertf(t, len(found) == 3, "paginated result should have len() 3 but has %d", len(found))
+
+	for i := range keyNames {
+		Assertf(t, found[i] == keyNames[i], "unexpected key %s at position %d", found[i], i)
+	}
+
+	// a cursor that is not a key name must not restart the search
+	w := testGet(t, "/kdbFind/kdbfind/page/?limit=2&cursor="+encodeCursor("invalid"))
+	Assertf(t, w.Code == http.StatusBadRequest, "wrong status code for invalid cursor: %v", w.Code)
+
+	removeTree(t, "user:/tests/elektrad/kdbfind/page")
+}
@@ -3,7 +3,14 @@ module github.com/ElektraInitiative/libelektra/elektrad
 go 1.13
 
 require (
+	github.com/fsnotify/fsnotify v1.5.1
+	github.com/go-zeromq/zmq4 v0.13.0
+	github.com/godbus/dbus/v5 v5.0.4
+	github.com/golang/protobuf v1.5.2
 	github.com/google/uuid v1.3.0
 	github.com/gorilla/mux v1.8.0
+	go.etcd.io/etcd/api/v3 v3.5.0
 	go.libelektra.org v0.0.0-20210713160219-0462a716b697
+	google.golang.org/grpc v1.40.0
+	google.golang.org/protobuf v1.26.0
 )
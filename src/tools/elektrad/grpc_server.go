@@ -0,0 +1,555 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ElektraInitiative/libelektra/elektrad/elektradpb"
+	"github.com/google/uuid"
+	elektra "go.libelektra.org/kdb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// sessionMetadata is the gRPC metadata key of the session id.
+const sessionMetadata = "session"
+
+// minWatchInterval is the shortest interval in which `Watch` checks the keys.
+const minWatchInterval = 100 * time.Millisecond
+
+// grpcServer implements the gRPC API. It shares the sessions and the handle
+// pool with the HTTP API.
+type grpcServer struct {
+	elektradpb.UnimplementedKDBServer
+	*server
+}
+
+func serveGRPC(port int, app *server) error {
+	listener, err := net.Listen("tcp", ":"+strconv.Itoa(port))
+
+	if err != nil {
+		return err
+	}
+
+	s := grpc.NewServer()
+	elektradpb.RegisterKDBServer(s, &grpcServer{server: app})
+
+	return s.Serve(listener)
+}
+
+// session returns the session of the call. If the call has no session id or
+// the session expired, a new session is created and its id is sent in the
+// response header.
+func (g *grpcServer) session(ctx context.Context) (*session, error) {
+	var id string
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(sessionMetadata); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+
+	if s, ok := loadSession(id); ok {
+		return s, nil
+	}
+
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs(sessionMetadata, id)); err != nil {
+		return nil, err
+	}
+
+	return storeSession(g.pool, id), nil
+}
+
+// withHandle calls `f` with the handle of the session of the call.
+func (g *grpcServer) withHandle(ctx context.Context, f func(handle elektra.KDB, ks elektra.KeySet) error) error {
+	s, err := g.session(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	// prevent the handle from being used in parallel
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if err = f(s.handle.kdb, s.handle.keySet); err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return nil
+}
+
+func newKeyArgument(name string) (elektra.Key, error) {
+	key, err := elektra.NewKey(name)
+
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid key name %q", name)
+	}
+
+	return key, nil
+}
+
+func (g *grpcServer) Get(ctx context.Context, req *elektradpb.GetRequest) (*elektradpb.GetResponse, error) {
+	key, err := newKeyArgument(req.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer key.Close()
+
+	resp := &elektradpb.GetResponse{
+		Keys: &elektradpb.KeySet{},
+	}
+
+	err = g.withHandle(ctx, func(handle elektra.KDB, ks elektra.KeySet) error {
+		if _, err := handle.Get(ks, key); err != nil {
+			return err
+		}
+
+		foundKey := ks.Lookup(key)
+		resp.Exists = foundKey != nil
+
+		if !req.Recursive {
+			if foundKey != nil {
+				resp.Keys.Keys = append(resp.Keys.Keys, toProtoKey(foundKey))
+			}
+
+			return nil
+		}
+
+		for _, k := range ks.ToSlice() {
+			if k.IsBelowOrSame(key) {
+				resp.Keys.Keys = append(resp.Keys.Keys, toProtoKey(k))
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (g *grpcServer) Set(ctx context.Context, req *elektradpb.SetRequest) (*elektradpb.SetResponse, error) {
+	if req.Key == nil {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+
+	key, err := newKeyArgument(req.Key.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer key.Close()
+
+	errKey, err := newKeyArgument(req.Key.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer errKey.Close()
+
+	resp := &elektradpb.SetResponse{}
+
+	err = g.withHandle(ctx, func(handle elektra.KDB, ks elektra.KeySet) error {
+		if _, err := handle.Get(ks, errKey); err != nil {
+			return err
+		}
+
+		// modify a copy, so that the KeySet is unchanged if a metakey is invalid
+		k := key
+		resp.Created = true
+
+		if existingKey := ks.Lookup(key); existingKey != nil {
+			k = existingKey.Duplicate(elektra.KEY_CP_ALL)
+			resp.Created = false
+		}
+
+		if err := setProtoKey(k, req.Key, req.ReplaceMeta); err != nil {
+			return err
+		}
+
+		ks.AppendKey(k)
+
+		return set(handle, ks, errKey)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (g *grpcServer) Delete(ctx context.Context, req *elektradpb.DeleteRequest) (*elektradpb.DeleteResponse, error) {
+	key, err := newKeyArgument(req.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer key.Close()
+
+	errKey, err := newKeyArgument(req.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer errKey.Close()
+
+	resp := &elektradpb.DeleteResponse{}
+
+	err = g.withHandle(ctx, func(handle elektra.KDB, ks elektra.KeySet) error {
+		if _, err := handle.Get(ks, errKey); err != nil {
+			return err
+		}
+
+		removed := removeKeys(ks, key, req.Recursive)
+		defer removed.Close()
+
+		count := removed.Len()
+
+		if count == 0 {
+			return status.Errorf(codes.NotFound, "the key %s does not exist", req.Name)
+		}
+
+		resp.Deleted = removed.KeyNames()
+
+		if req.DryRun || (g.deleteLimit > 0 && count > g.deleteLimit && !req.Confirm) {
+			// restore the session KeySet
+			ks.Append(removed)
+
+			if req.DryRun {
+				return nil
+			}
+
+			return status.Errorf(codes.FailedPrecondition, "deleting %d keys requires confirm", count)
+		}
+
+		if err := set(handle, ks, errKey); err != nil {
+			ks.Append(removed)
+			return err
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// transfer calls `f` with the keys of a move or copy request.
+func (g *grpcServer) transfer(ctx context.Context, from, to string, f func(handle elektra.KDB, ks elektra.KeySet, fromKey, toKey elektra.Key) (int, error)) (int, error) {
+	fromKey, err := newKeyArgument(from)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer fromKey.Close()
+
+	toKey, err := newKeyArgument(to)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer toKey.Close()
+
+	var count int
+
+	err = g.withHandle(ctx, func(handle elektra.KDB, ks elektra.KeySet) (err error) {
+		count, err = f(handle, ks, fromKey, toKey)
+
+		if err == nil && count == 0 {
+			err = status.Errorf(codes.NotFound, "no key found below %s", from)
+		}
+
+		return err
+	})
+
+	return count, err
+}
+
+func (g *grpcServer) Move(ctx context.Context, req *elektradpb.MoveRequest) (*elektradpb.MoveResponse, error) {
+	count, err := g.transfer(ctx, req.From, req.To, func(handle elektra.KDB, ks elektra.KeySet, fromKey, toKey elektra.Key) (int, error) {
+		return move(handle, ks, fromKey, toKey, true)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &elektradpb.MoveResponse{Count: int32(count)}, nil
+}
+
+func (g *grpcServer) Copy(ctx context.Context, req *elektradpb.CopyRequest) (*elektradpb.CopyResponse, error) {
+	count, err := g.transfer(ctx, req.From, req.To, func(handle elektra.KDB, ks elektra.KeySet, fromKey, toKey elektra.Key) (int, error) {
+		return copyKeys(handle, ks, fromKey, toKey, true)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &elektradpb.CopyResponse{Count: int32(count)}, nil
+}
+
+func (g *grpcServer) Find(ctx context.Context, req *elektradpb.FindRequest) (*elektradpb.FindResponse, error) {
+	opts := &findOptions{}
+
+	if req.Regex != "" {
+		nameFilter, err := newFindFilter("name", "regex", req.Regex)
+
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		opts.filters = append(opts.filters, nameFilter)
+	}
+
+	rootName := req.Below
+
+	if rootName == "" {
+		rootName = "/"
+	}
+
+	root, err := newKeyArgument(rootName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer root.Close()
+
+	resp := &elektradpb.FindResponse{
+		Keys: &elektradpb.KeySet{},
+	}
+
+	err = g.withHandle(ctx, func(handle elektra.KDB, ks elektra.KeySet) error {
+		if _, err := handle.Get(ks, root); err != nil {
+			return err
+		}
+
+		results, _ := find(ks, root, opts)
+
+		for _, result := range results {
+			k := toProtoKey(ks.LookupByName(result.Name))
+
+			if !req.Values {
+				k.Value = nil
+				k.Binary = false
+			}
+
+			if !req.Meta {
+				k.Meta = nil
+			}
+
+			resp.Keys.Keys = append(resp.Keys.Keys, k)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// watchInterval returns the interval of `Watch` requests in milliseconds,
+// at least `minWatchInterval` because every check fetches all keys.
+func watchInterval(ms int32) time.Duration {
+	if ms <= 0 {
+		return time.Second
+	}
+
+	interval := time.Duration(ms) * time.Millisecond
+
+	if interval < minWatchInterval {
+		return minWatchInterval
+	}
+
+	return interval
+}
+
+// Watch checks the keys for changes in an interval and sends an event for
+// every created, updated and deleted key. It uses a handle of its own, so
+// that it does not block the session.
+func (g *grpcServer) Watch(req *elektradpb.WatchRequest, stream elektradpb.KDB_WatchServer) error {
+	key, err := newKeyArgument(req.Name)
+
+	if err != nil {
+		return err
+	}
+
+	defer key.Close()
+
+	interval := watchInterval(req.IntervalMs)
+
+	h, err := newHandle()
+
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	defer h.kdb.Close()
+	defer h.keySet.Close()
+
+	var known map[string]*elektradpb.Key
+
+	for {
+		current, err := snapshot(h, key)
+
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		if known != nil {
+			for _, event := range changes(known, current) {
+				if err = stream.Send(event); err != nil {
+					return err
+				}
+			}
+		}
+
+		known = current
+
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// snapshot gets the key and all keys below it and returns them by name.
+func snapshot(h *handle, key elektra.Key) (map[string]*elektradpb.Key, error) {
+	if _, err := h.kdb.Get(h.keySet, key); err != nil {
+		return nil, err
+	}
+
+	return keysBelow(h.keySet, key), nil
+}
+
+// keysBelow returns the key and all keys below it in `ks` by name.
+func keysBelow(ks elektra.KeySet, key elektra.Key) map[string]*elektradpb.Key {
+	keys := map[string]*elektradpb.Key{}
+
+	for _, k := range ks.ToSlice() {
+		if k.IsBelowOrSame(key) {
+			keys[k.Name()] = toProtoKey(k)
+		}
+	}
+
+	return keys
+}
+
+// changes returns the events that turn the keys `before` into `after`,
+// ordered by key name.
+func changes(before, after map[string]*elektradpb.Key) []*elektradpb.WatchEvent {
+	var events []*elektradpb.WatchEvent
+
+	for name, k := range after {
+		old, ok := before[name]
+
+		switch {
+		case !ok:
+			events = append(events, &elektradpb.WatchEvent{Type: elektradpb.WatchEvent_CREATED, Key: k})
+		case !proto.Equal(old, k):
+			events = append(events, &elektradpb.WatchEvent{Type: elektradpb.WatchEvent_UPDATED, Key: k})
+		}
+	}
+
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			events = append(events, &elektradpb.WatchEvent{
+				Type: elektradpb.WatchEvent_DELETED,
+				Key:  &elektradpb.Key{Name: name},
+			})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key.Name < events[j].Key.Name
+	})
+
+	return events
+}
+
+func toProtoKey(k elektra.Key) *elektradpb.Key {
+	result := &elektradpb.Key{
+		Name:   k.Name(),
+		Binary: isBinary(k),
+		Meta:   metaMap(k),
+	}
+
+	if result.Binary {
+		result.Value = k.Bytes()
+	} else {
+		result.Value = []byte(k.String())
+	}
+
+	return result
+}
+
+// setProtoKey sets the value and metadata of `k` to the ones of `from`.
+func setProtoKey(k elektra.Key, from *elektradpb.Key, replaceMeta bool) error {
+	var err error
+
+	if from.Binary {
+		err = k.SetBytes(from.Value)
+	} else {
+		err = k.SetString(string(from.Value))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if replaceMeta {
+		for name := range metaMap(k) {
+			if name == "binary" && from.Binary {
+				continue
+			}
+
+			if err = k.RemoveMeta(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, value := range from.Meta {
+		if err = k.SetMeta(name, value); err != nil {
+			return fmt.Errorf("could not set metakey %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ElektraInitiative/libelektra/elektrad/elektradpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func testGRPCClient(t *testing.T) (elektradpb.KDBClient, func()) {
+	t.Helper()
+
+	listener := bufconn.Listen(1024 * 1024)
+
+	s := grpc.NewServer()
+	elektradpb.RegisterKDBServer(s, &grpcServer{server: &server{pool: initPool(10), deleteLimit: 2}})
+
+	go s.Serve(listener)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	Check(t, err, "could not connect")
+
+	return elektradpb.NewKDBClient(conn), func() {
+		conn.Close()
+		s.Stop()
+	}
+}
+
+func TestGRPCSetAndGet(t *testing.T) {
+	keyName := "user:/tests/elektrad/grpc/set"
+
+	client, closeClient := testGRPCClient(t)
+	defer closeClient()
+
+	ctx := context.Background()
+
+	var header metadata.MD
+
+	resp, err := client.Set(ctx, &elektradpb.SetRequest{
+		Key: &elektradpb.Key{
+			Name:  keyName,
+			Value: []byte("hello"),
+			Meta:  map[string]string{"type": "string"},
+		},
+	}, grpc.Header(&header))
+	Check(t, err, "could not set key")
+	Assert(t, resp.Created, "key was not created")
+
+	sessions := header.Get(sessionMetadata)
+	Assert(t, len(sessions) == 1, "no session id returned")
+
+	// use the session of the first call
+	ctx = metadata.AppendToOutgoingContext(ctx, sessionMetadata, sessions[0])
+
+	header = nil
+
+	get, err := client.Get(ctx, &elektradpb.GetRequest{Name: keyName}, grpc.Header(&header))
+	Check(t, err, "could not get key")
+	Assert(t, len(header.Get(sessionMetadata)) == 0, "a new session was created")
+
+	removeKey(t, keyName)
+
+	Assert(t, get.Exists, "key does not exist")
+	Assertf(t, len(get.Keys.Keys) == 1, "expected 1 key, got %d", len(get.Keys.Keys))
+
+	k := get.Keys.Keys[0]
+	Assertf(t, string(k.Value) == "hello", "wrong value %q", k.Value)
+	Assertf(t, k.Meta["type"] == "string", "wrong meta %v", k.Meta)
+
+	_, err = client.Set(ctx, &elektradpb.SetRequest{Key: &elektradpb.Key{Name: "invalid"}})
+	Assertf(t, status.Code(err) == codes.InvalidArgument, "wrong error %v", err)
+}
+
+func TestGRPCDeleteMoveCopy(t *testing.T) {
+	root := "user:/tests/elektrad/grpc/tree"
+
+	setupKey(t, root+"/from/a", root+"/from/b", root+"/from/c")
+
+	client, closeClient := testGRPCClient(t)
+	defer closeClient()
+	defer removeTree(t, root)
+
+	ctx := context.Background()
+
+	copied, err := client.Copy(ctx, &elektradpb.CopyRequest{From: root + "/from", To: root + "/copy"})
+	Check(t, err, "could not copy keys")
+	Assertf(t, copied.Count == 3, "expected 3 copied keys, got %d", copied.Count)
+
+	moved, err := client.Move(ctx, &elektradpb.MoveRequest{From: root + "/from", To: root + "/to"})
+	Check(t, err, "could not move keys")
+	Assertf(t, moved.Count == 3, "expected 3 moved keys, got %d", moved.Count)
+
+	Assert(t, getKey(t, root+"/from/a") == nil, "key was not moved")
+	Assert(t, getKey(t, root+"/to/a") != nil, "key was not moved")
+	Assert(t, getKey(t, root+"/copy/a") != nil, "key was not copied")
+
+	_, err = client.Move(ctx, &elektradpb.MoveRequest{From: root + "/from", To: root + "/to"})
+	Assertf(t, status.Code(err) == codes.NotFound, "wrong error %v", err)
+
+	_, err = client.Delete(ctx, &elektradpb.DeleteRequest{Name: root + "/to", Recursive: true})
+	Assertf(t, status.Code(err) == codes.FailedPrecondition, "wrong error %v", err)
+
+	deleted, err := client.Delete(ctx, &elektradpb.DeleteRequest{Name: root + "/to", Recursive: true, Confirm: true})
+	Check(t, err, "could not delete keys")
+	Assertf(t, len(deleted.Deleted) == 3, "expected 3 deleted keys, got %d", len(deleted.Deleted))
+
+	found, err := client.Find(ctx, &elektradpb.FindRequest{Regex: "grpc/tree/copy/[ab]$", Values: true})
+	Check(t, err, "could not find keys")
+	Assertf(t, len(found.Keys.Keys) == 2, "expected 2 keys, got %d", len(found.Keys.Keys))
+}
+
+func TestGRPCWatch(t *testing.T) {
+	keyName := "user:/tests/elektrad/grpc/watch/key"
+
+	removeTree(t, "user:/tests/elektrad/grpc/watch")
+
+	client, closeClient := testGRPCClient(t)
+	defer closeClient()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &elektradpb.WatchRequest{
+		Name:       "user:/tests/elektrad/grpc/watch",
+		IntervalMs: 10,
+	})
+	Check(t, err, "could not watch keys")
+
+	// the first snapshot is taken when the stream is established
+	time.Sleep(50 * time.Millisecond)
+
+	setupKey(t, keyName)
+
+	event, err := stream.Recv()
+	Check(t, err, "could not receive event")
+	Assertf(t, event.Type == elektradpb.WatchEvent_CREATED, "wrong event type %v", event.Type)
+	Assertf(t, event.Key.Name == keyName, "wrong key %s", event.Key.Name)
+
+	removeKey(t, keyName)
+
+	event, err = stream.Recv()
+	Check(t, err, "could not receive event")
+	Assertf(t, event.Type == elektradpb.WatchEvent_DELETED, "wrong event type %v", event.Type)
+}
+
+func TestWatchInterval(t *testing.T) {
+	tests := map[int32]time.Duration{
+		0:    time.Second,
+		-5:   time.Second,
+		1:    minWatchInterval,
+		250:  250 * time.Millisecond,
+		5000: 5 * time.Second,
+	}
+
+	for ms, expected := range tests {
+		interval := watchInterval(ms)
+		Assertf(t, interval == expected, "interval of %d ms: expected %v, got %v", ms, expected, interval)
+	}
+}
+
+func TestChangesOrder(t *testing.T) {
+	before := map[string]*elektradpb.Key{
+		"user:/c": {Name: "user:/c"},
+		"user:/a": {Name: "user:/a", Value: []byte("1")},
+	}
+
+	after := map[string]*elektradpb.Key{
+		"user:/d": {Name: "user:/d"},
+		"user:/a": {Name: "user:/a", Value: []byte("2")},
+		"user:/b": {Name: "user:/b"},
+	}
+
+	events := changes(before, after)
+
+	var names []string
+
+	for _, event := range events {
+		names = append(names, event.Key.Name)
+	}
+
+	CompareStrings(t, names, []string{"user:/a", "user:/b", "user:/c", "user:/d"}, "wrong order of the events")
+}
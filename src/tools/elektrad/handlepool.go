@@ -1,12 +1,17 @@
 package main
 
 import (
+	"log"
+	"time"
+
 	elektra "go.libelektra.org/kdb"
 )
 
 type handle struct {
 	kdb    elektra.KDB
 	keySet elektra.KeySet
+	// refreshed is the time `keySet` was last fetched from the storage
+	refreshed time.Time
 }
 
 type handlePool struct {
@@ -30,14 +35,30 @@ func initPool(size int) *handlePool {
 }
 
 func newHandle() (*handle, error) {
-	kdb := elektra.New()
+	var h *handle
+
+	err := resolverContext{}.inContext(func() (err error) {
+		h, err = openHandle()
+		return
+	})
+
+	return h, err
+}
 
-	err := kdb.Open()
+// openHandle opens a new handle, the files are resolved in the current
+// working directory and environment. The secrets of the webhooks are hidden.
+func openHandle() (*handle, error) {
+	kdb, err := backend.open()
 
 	if err != nil {
 		return nil, err
 	}
 
+	return openHandleWith(hideWebhookSecrets(kdb))
+}
+
+// openHandleWith fetches all keys with the opened `kdb`.
+func openHandleWith(kdb elektra.KDB) (*handle, error) {
 	parentKey, err := elektra.NewKey("/")
 
 	if err != nil {
@@ -53,11 +74,32 @@ func newHandle() (*handle, error) {
 	}
 
 	return &handle{
-		kdb:    kdb,
-		keySet: ks,
+		kdb:       kdb,
+		keySet:    ks,
+		refreshed: time.Now(),
 	}, nil
 }
 
+// refresh fetches all keys of the handle again, so that the changes of other
+// processes are visible in its KeySet.
+func (h *handle) refresh() error {
+	parentKey, err := elektra.NewKey("/")
+
+	if err != nil {
+		return err
+	}
+
+	defer parentKey.Close()
+
+	if _, err = h.kdb.Get(h.keySet, parentKey); err != nil {
+		return err
+	}
+
+	h.refreshed = time.Now()
+
+	return nil
+}
+
 func (p *handlePool) refill() {
 	select {
 	case p.doRefill <- 1:
@@ -71,7 +113,7 @@ func (p *handlePool) pop() *handle {
 
 func (p *handlePool) refillLoop() {
 	for range p.doRefill {
-		for l := len(p.handles); l < p.size; {
+		for len(p.handles) < p.size {
 			h, err := newHandle()
 
 			if err != nil {
@@ -88,3 +130,39 @@ func (p *handlePool) Get() *handle {
 
 	return p.pop()
 }
+
+// refreshAll refreshes the handles waiting in the pool. Handles that can not
+// be refreshed are closed, the pool is refilled with new ones.
+func (p *handlePool) refreshAll() {
+	for n := len(p.handles); n > 0; n-- {
+		var h *handle
+
+		select {
+		case h = <-p.handles:
+		default:
+			return
+		}
+
+		if err := h.refresh(); err != nil {
+			log.Printf("could not refresh handle: %v", err)
+			closeHandle(h)
+			p.refill()
+			continue
+		}
+
+		select {
+		case p.handles <- h:
+		default:
+			// the pool was refilled in the meantime
+			closeHandle(h)
+		}
+	}
+}
+
+func closeHandle(h *handle) {
+	if err := h.kdb.Close(); err != nil {
+		log.Printf("error closing handle: %v", err)
+	}
+
+	h.keySet.Close()
+}
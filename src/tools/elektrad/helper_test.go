@@ -3,14 +3,34 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 
 	elektra "go.libelektra.org/kdb"
 )
 
+var testStorage = flag.String("storage", "memory", "the storage used by the tests, `elektra` tests against the key database")
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	s, err := newStorage(*testStorage)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	backend = s
+
+	os.Exit(m.Run())
+}
+
 func testGet(t *testing.T, path string) *httptest.ResponseRecorder {
 	t.Helper()
 
@@ -50,8 +70,7 @@ func setupKey(t *testing.T, keyNames ...string) {
 	rootKey, err := elektra.NewKey("/")
 	Checkf(t, err, "could not create key: %v", err)
 
-	kdb := elektra.New()
-	err = kdb.Open()
+	kdb, err := backend.open()
 	Checkf(t, err, "could not open kdb: %v", err)
 
 	ks := elektra.NewKeySet()
@@ -84,8 +103,7 @@ func removeKey(t *testing.T, keyName string) {
 	parentKey, err := elektra.NewKey(keyName)
 	Checkf(t, err, "could not create key: %v", err)
 
-	kdb := elektra.New()
-	err = kdb.Open()
+	kdb, err := backend.open()
 	Checkf(t, err, "could not open kdb: %v", err)
 
 	ks := elektra.NewKeySet()
@@ -106,6 +124,25 @@ func removeKey(t *testing.T, keyName string) {
 	Checkf(t, err, "could not save removal of key %s: %v", keyName, err)
 }
 
+func removeTree(t *testing.T, keyName string) {
+	t.Helper()
+
+	parentKey, err := elektra.NewKey(keyName)
+	Checkf(t, err, "could not create key: %v", err)
+
+	kdb, err := backend.open()
+	Checkf(t, err, "could not open kdb: %v", err)
+
+	ks := elektra.NewKeySet()
+	_, err = kdb.Get(ks, parentKey)
+	Checkf(t, err, "could not get KeySet: %v", err)
+
+	ks.Cut(parentKey)
+
+	_, err = kdb.Set(ks, parentKey)
+	Checkf(t, err, "could not save removal of %s: %v", keyName, err)
+}
+
 func setupKeyWithMeta(t *testing.T, keyName string, meta ...keyValueBody) {
 	t.Helper()
 
@@ -115,8 +152,7 @@ func setupKeyWithMeta(t *testing.T, keyName string, meta ...keyValueBody) {
 	parentKey, err := elektra.NewKey(keyName)
 	Checkf(t, err, "could not create key: %v", err)
 
-	kdb := elektra.New()
-	err = kdb.Open()
+	kdb, err := backend.open()
 	Checkf(t, err, "could not open kdb: %v", err)
 
 	ks := elektra.NewKeySet()
@@ -167,14 +203,49 @@ func testRequest(t *testing.T, verb, path string, body interface{}) *httptest.Re
 	return w
 }
 
+func testRawRequest(t *testing.T, verb, path, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := setupRouter(&server{pool: initPool(10)})
+
+	w := httptest.NewRecorder()
+
+	req, err := http.NewRequest(verb, path, bytes.NewReader(body))
+
+	Checkf(t, err, "could not create %s request: %v", verb, err)
+
+	req.Header.Set("Content-Type", contentType)
+
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func testHeaderRequest(t *testing.T, verb, path string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := setupRouter(&server{pool: initPool(10)})
+
+	w := httptest.NewRecorder()
+
+	req, err := http.NewRequest(verb, path, nil)
+
+	Checkf(t, err, "could not create %s request: %v", verb, err)
+
+	req.Header = header
+
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
 func getKey(t *testing.T, keyName string) elektra.Key {
 	t.Helper()
 
 	parentKey, err := elektra.NewKey(keyName)
 	Checkf(t, err, "could not create key %s: %v", keyName, err)
 
-	kdb := elektra.New()
-	err = kdb.Open()
+	kdb, err := backend.open()
 	Checkf(t, err, "could not open kdb: %v", err)
 
 	ks := elektra.NewKeySet()
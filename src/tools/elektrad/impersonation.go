@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var errNoPrincipal = errors.New("the request is not authenticated")
+
+// impersonator serves every authenticated principal from a separate
+// elektrad process that runs as the Unix user of the principal, so that
+// `user:/` keys are resolved to the configuration files of that user.
+//
+// The principal is taken from a request header that must be set by a
+// trusted authenticating reverse proxy.
+type impersonator struct {
+	// header is the request header that contains the principal
+	header string
+	// userMap maps principals to Unix user names. If it is nil principals
+	// are used as user names.
+	userMap map[string]string
+	// groupID is the ID of the Unix group whose members may be impersonated,
+	// empty if every mapped user may be impersonated
+	groupID string
+	// idleTimeout is the time after which child processes without requests
+	// are stopped
+	idleTimeout time.Duration
+	// args are passed to the child processes
+	args []string
+	// files are passed to the child processes, starting with the file
+	// descriptor 3
+	files []*os.File
+
+	mut      sync.Mutex
+	children map[string]*childServer
+}
+
+// childServer is an elektrad process serving a single Unix user.
+type childServer struct {
+	cmd    *exec.Cmd
+	proxy  *httputil.ReverseProxy
+	dir    string
+	exited chan struct{}
+
+	// active is the count of requests being served, lastUsed the time the
+	// last request finished
+	active   int
+	lastUsed time.Time
+}
+
+func (i *impersonator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username, err := i.username(r)
+
+	if errors.Is(err, errNoPrincipal) {
+		writeErrorCode(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	if err != nil {
+		writeErrorCode(w, http.StatusForbidden, err)
+		return
+	}
+
+	child, err := i.child(username)
+
+	if err != nil {
+		log.Printf("could not start elektrad for user %s: %v", username, err)
+		internalServerError(w)
+		return
+	}
+
+	defer i.release(child)
+
+	// the child must not trust the header
+	r.Header.Del(i.header)
+
+	child.proxy.ServeHTTP(w, r)
+}
+
+// username returns the Unix user name of the principal of the request.
+func (i *impersonator) username(r *http.Request) (string, error) {
+	principal := r.Header.Get(i.header)
+
+	if principal == "" {
+		return "", errNoPrincipal
+	}
+
+	username := principal
+
+	if i.userMap != nil {
+		var ok bool
+
+		if username, ok = i.userMap[principal]; !ok {
+			return "", fmt.Errorf("the principal %s is not mapped to a user", principal)
+		}
+	}
+
+	if i.groupID != "" && !i.inGroup(username) {
+		return "", fmt.Errorf("the user %s may not be impersonated", username)
+	}
+
+	return username, nil
+}
+
+// inGroup checks if the Unix user is a member of the group of the
+// impersonator.
+func (i *impersonator) inGroup(username string) bool {
+	u, err := user.Lookup(username)
+
+	if err != nil {
+		return false
+	}
+
+	if u.Gid == i.groupID {
+		return true
+	}
+
+	ids, _ := u.GroupIds()
+
+	for _, id := range ids {
+		if id == i.groupID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// child returns the running elektrad process of the user and starts it if
+// necessary. The child is not stopped while it is idle until it is released.
+func (i *impersonator) child(username string) (*childServer, error) {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	if child, ok := i.children[username]; ok {
+		select {
+		case <-child.exited:
+			delete(i.children, username)
+		default:
+			child.active++
+			return child, nil
+		}
+	}
+
+	child, err := i.startChild(username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if i.children == nil {
+		i.children = map[string]*childServer{}
+	}
+
+	child.active++
+	i.children[username] = child
+
+	return child, nil
+}
+
+// release marks the end of a request served by `child`.
+func (i *impersonator) release(child *childServer) {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	child.active--
+	child.lastUsed = time.Now()
+}
+
+// stopIdleChildren stops the child processes that did not serve requests
+// within the idle timeout, they are started again by the next request.
+func (i *impersonator) stopIdleChildren() {
+	i.mut.Lock()
+	defer i.mut.Unlock()
+
+	for username, child := range i.children {
+		if child.active > 0 || time.Since(child.lastUsed) < i.idleTimeout {
+			continue
+		}
+
+		delete(i.children, username)
+
+		if err := child.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			child.cmd.Process.Kill()
+		}
+	}
+}
+
+// stopIdleChildrenLoop stops idle child processes until elektrad exits.
+func (i *impersonator) stopIdleChildrenLoop() {
+	if i.idleTimeout <= 0 {
+		return
+	}
+
+	for range time.Tick(i.idleTimeout / 2) {
+		i.stopIdleChildren()
+	}
+}
+
+func (i *impersonator) startChild(username string) (*childServer, error) {
+	u, err := user.Lookup(username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if uid == 0 {
+		return nil, errors.New("impersonating root is not allowed")
+	}
+
+	executable, err := os.Executable()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// the socket directory is only accessible by the user
+	dir, err := ioutil.TempDir("", "elektrad-"+username+"-")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.Chown(dir, int(uid), int(gid)); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	socket := filepath.Join(dir, "elektrad.sock")
+
+	cmd := exec.Command(executable, append([]string{"-socket", socket}, i.args...)...)
+	cmd.Dir = u.HomeDir
+	cmd.Env = []string{
+		"HOME=" + u.HomeDir,
+		"USER=" + u.Username,
+		"LOGNAME=" + u.Username,
+		"PATH=" + os.Getenv("PATH"),
+	}
+
+	if libraryPath, ok := os.LookupEnv("LD_LIBRARY_PATH"); ok {
+		cmd.Env = append(cmd.Env, "LD_LIBRARY_PATH="+libraryPath)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = i.files
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:    uint32(uid),
+			Gid:    uint32(gid),
+			Groups: groupIDs(u),
+		},
+		// the child must not outlive elektrad
+		Pdeathsig: syscall.SIGTERM,
+	}
+
+	if err = cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	child := &childServer{
+		cmd:      cmd,
+		dir:      dir,
+		exited:   make(chan struct{}),
+		proxy:    unixSocketProxy(socket),
+		lastUsed: time.Now(),
+	}
+
+	go func() {
+		if err := cmd.Wait(); err != nil {
+			log.Printf("elektrad for user %s exited: %v", username, err)
+		}
+
+		os.RemoveAll(dir)
+		close(child.exited)
+	}()
+
+	if err = waitForSocket(socket, child.exited, 10*time.Second); err != nil {
+		cmd.Process.Kill()
+		return nil, err
+	}
+
+	return child, nil
+}
+
+func groupIDs(u *user.User) []uint32 {
+	var groups []uint32
+
+	ids, _ := u.GroupIds()
+
+	for _, id := range ids {
+		if gid, err := strconv.ParseUint(id, 10, 32); err == nil {
+			groups = append(groups, uint32(gid))
+		}
+	}
+
+	return groups
+}
+
+func unixSocketProxy(socket string) *httputil.ReverseProxy {
+	proxy := httputil.NewSingleHostReverseProxy(&url.URL{
+		Scheme: "http",
+		Host:   "elektrad",
+	})
+
+	proxy.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}
+
+	return proxy
+}
+
+func waitForSocket(socket string, exited <-chan struct{}, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for time.Now().Before(deadline) {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			return conn.Close()
+		}
+
+		select {
+		case <-exited:
+			return errors.New("elektrad exited during startup")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	return errors.New("timeout while waiting for elektrad")
+}
+
+// parseUserMap parses a file with lines of the form `<principal> <user>`.
+// Empty lines and lines starting with `#` are ignored.
+func parseUserMap(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	userMap := map[string]string{}
+	scanner := bufio.NewScanner(file)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected `<principal> <user>`", filename, line)
+		}
+
+		userMap[fields[0]] = fields[1]
+	}
+
+	return userMap, scanner.Err()
+}
+
+// isLoopbackAddress returns true if the listen address `addr` only accepts
+// connections from the local host, e.g. of an authenticating reverse proxy.
+func isLoopbackAddress(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
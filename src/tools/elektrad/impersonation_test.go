@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"os/user"
+	"testing"
+	"time"
+)
+
+func TestImpersonatorUsername(t *testing.T) {
+	i := &impersonator{
+		header:  "X-Remote-User",
+		userMap: map[string]string{"alice@example.com": "alice"},
+	}
+
+	r := httptest.NewRequest("GET", "/kdb/user:/tests", nil)
+
+	_, err := i.username(r)
+	Assert(t, err == errNoPrincipal, "a request without principal must be rejected")
+
+	r.Header.Set("X-Remote-User", "alice@example.com")
+
+	username, err := i.username(r)
+	Check(t, err, "could not map principal")
+	Assertf(t, username == "alice", "wrong user name %s", username)
+
+	r.Header.Set("X-Remote-User", "bob@example.com")
+
+	_, err = i.username(r)
+	Assert(t, err != nil, "unmapped principals must be rejected")
+
+	w := httptest.NewRecorder()
+	i.ServeHTTP(w, httptest.NewRequest("GET", "/kdb/user:/tests", nil))
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusUnauthorized, "wrong status code: %v", code)
+}
+
+func TestImpersonatorGroup(t *testing.T) {
+	current, err := user.Current()
+	Check(t, err, "could not look up the current user")
+
+	i := &impersonator{
+		header:  "X-Remote-User",
+		groupID: current.Gid,
+	}
+
+	r := httptest.NewRequest("GET", "/kdb/user:/tests", nil)
+	r.Header.Set("X-Remote-User", current.Username)
+
+	username, err := i.username(r)
+	Check(t, err, "a member of the group must be allowed")
+	Assertf(t, username == current.Username, "wrong user name %s", username)
+
+	i.groupID = "4294967294"
+
+	_, err = i.username(r)
+	Assert(t, err != nil, "users outside of the group must be rejected")
+}
+
+func TestStopIdleChildren(t *testing.T) {
+	cmd := exec.Command("sleep", "60")
+	Check(t, cmd.Start(), "could not start process")
+
+	exited := make(chan struct{})
+
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+
+	i := &impersonator{
+		idleTimeout: time.Minute,
+		children: map[string]*childServer{
+			"idle": {cmd: cmd, exited: exited, lastUsed: time.Now().Add(-2 * time.Minute)},
+			"busy": {cmd: cmd, exited: exited, active: 1},
+		},
+	}
+
+	i.stopIdleChildren()
+
+	Assert(t, i.children["idle"] == nil, "the idle child was not removed")
+	Assert(t, i.children["busy"] != nil, "the busy child was removed")
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("the idle child was not stopped")
+	}
+}
+
+func TestIsLoopbackAddress(t *testing.T) {
+	for _, addr := range []string{"localhost:33333", "127.0.0.1:33333", "[::1]:33333"} {
+		Assertf(t, isLoopbackAddress(addr), "%s is a loopback address", addr)
+	}
+
+	for _, addr := range []string{"", ":33333", "0.0.0.0:33333", "[::]:33333", "192.0.2.1:33333", "localhost"} {
+		Assertf(t, !isLoopbackAddress(addr), "%s is not a loopback address", addr)
+	}
+}
+
+func TestParseUserMap(t *testing.T) {
+	file, err := ioutil.TempFile("", "elektrad-user-map")
+	Check(t, err, "could not create file")
+
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString("# principal user\nalice@example.com alice\n\nbob@example.com  bob\n")
+	Check(t, err, "could not write file")
+	file.Close()
+
+	userMap, err := parseUserMap(file.Name())
+	Check(t, err, "could not parse user map")
+	Assertf(t, len(userMap) == 2 && userMap["alice@example.com"] == "alice" && userMap["bob@example.com"] == "bob", "wrong user map %v", userMap)
+
+	Check(t, ioutil.WriteFile(file.Name(), []byte("alice\n"), 0600), "could not write file")
+
+	_, err = parseUserMap(file.Name())
+	Assert(t, err != nil, "invalid lines must be rejected")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"strings"
 
 	elektra "go.libelektra.org/kdb"
 )
@@ -19,5 +20,42 @@ func set(handle elektra.KDB, ks elektra.KeySet, key elektra.Key) error {
 		_, err = handle.Set(ks, key)
 	}
 
+	if err == nil && webhooks != nil {
+		webhooks.changed()
+	}
+
+	if err == nil && notifier != nil {
+		notifier.committed(key.Name())
+	}
+
 	return err
 }
+
+// isBinary checks if a key holds a binary value. Only the presence of the
+// `binary` metakey is significant, not its value.
+func isBinary(key elektra.Key) bool {
+	return hasMeta(key, "binary")
+}
+
+// hasMeta checks if a metakey is present, even if its value is empty.
+func hasMeta(key elektra.Key, name string) bool {
+	for metaName := range key.MetaMap() {
+		if strings.TrimPrefix(metaName, "meta:/") == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// metaMap returns the metadata of a key without the `meta:/` prefix of the
+// metakey names.
+func metaMap(key elektra.Key) map[string]string {
+	meta := map[string]string{}
+
+	for name, value := range key.MetaMap() {
+		meta[strings.TrimPrefix(name, "meta:/")] = value
+	}
+
+	return meta
+}
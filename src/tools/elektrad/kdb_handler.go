@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 
@@ -15,11 +18,33 @@ import (
 //		keyName		the name of the key to lookup, URL path param.
 // 		preload 	determines how many levels of Children are
 // 					loaded. Optional query parameter (int).
-//					Value must be 0-9. Default is 0.
+//					Value must be 0-9. Default is 0. Children are the
+//					existing direct children on the listed page, they only
+//					list their direct children.
+//		typed		if `true` values are returned as JSON booleans,
+//					numbers or null according to their `type` metadata.
+//					Optional query parameter (bool).
+//		limit		the maximum number of keys in `ls`. If there are more
+//					keys `next` is set. Optional query parameter (int).
+//		after		only list keys after this key, e.g. the `next` key of
+//					the previous page. Optional query parameter.
+//		depth		only list keys up to this many levels below the key,
+//					`counts` contains the number of keys below each of them.
+//					Optional query parameter (int).
+//
+// If the `Accept` header is `application/x-ndjson` the listed keys are
+// streamed as newline delimited JSON `listEntry` structs instead.
+//
+// The `ETag` header identifies the state of the subtree, if it matches the
+// `If-None-Match` header of the request nothing is returned. `Last-Modified`
+// is the time elektrad first saw this state, it is compared with
+// `If-Modified-Since` if there is no `If-None-Match` header.
 //
 // Response Code:
 //		200 OK if the request is successfull
-// 		400 Bad Request if the key name or preload is invalid.
+//		304 Not Modified if the `If-None-Match` header matches the ETag or
+//			the subtree was not modified since `If-Modified-Since`.
+// 		400 Bad Request if the key name, preload, limit or depth is invalid.
 //
 // Returns: JSON marshaled `lookupResult` struct.
 //
@@ -34,6 +59,13 @@ func (s *server) getKdbHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	opts, err := parseLookupOptions(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
 	keyName := parseKeyNameFromURL(r)
 
 	key, err := elektra.NewKey(keyName)
@@ -63,10 +95,24 @@ func (s *server) getKdbHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if writeCacheHeaders(w, r, ks, key) {
+		return
+	}
+
+	if isNDJSONRequest(r) {
+		// the session is locked, so the keys can be streamed from its
+		// KeySet
+		if err = writeList(w, ks, key, opts); err != nil {
+			writeError(w, err)
+		}
+
+		return
+	}
+
 	dup := ks.Duplicate()
 	defer dup.Close()
 
-	response, err := lookup(dup, key, preload)
+	response, err := lookup(dup, key, preload, opts)
 
 	if err != nil {
 		writeError(w, err)
@@ -75,21 +121,95 @@ func (s *server) getKdbHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// headKdbHandler checks if a key exists without returning it.
+//
+// Arguments:
+//		keyName		the name of the key, URL path param.
+//
+// The `ETag` and `Last-Modified` headers are the same as the ones of
+// `getKdbHandler` with the same query parameters.
+//
+// Response Code:
+//		200 OK if the key exists.
+//		304 Not Modified if the `If-None-Match` header matches the ETag or
+//			the subtree was not modified since `If-Modified-Since`.
+// 		400 Bad Request if the key name is invalid.
+//		404 Not Found if the key does not exist.
+//
+// Example: `curl -I localhost:33333/kdb/user/test/hello`
+func (s *server) headKdbHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := elektra.NewKey(parseKeyNameFromURL(r))
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer key.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, key)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if ks.Lookup(key) == nil {
+		notFound(w)
+		return
+	}
+
+	if writeCacheHeaders(w, r, ks, key) {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 // putKdbHandler creates a new Key.
 //
 // Arguments:
 //		keyName		the name of the (new) Key. URL path param.
 //		value		the (optional) value of the Key. JSON string POST body.
+//					With `typed` also a JSON boolean, number or null.
+//					With `binary` a base64 encoded JSON string, with the
+//					`application/octet-stream` content type the raw value.
+//		typed		if `true` booleans and numbers are converted according
+//					to the `type` of the key. Optional query parameter (bool).
+//		binary		if `true` the value is stored as binary value. Optional
+//					query parameter (bool).
 //
 // Response Code:
 //		200 OK if the value was set on an existing key.
 //		201 Created if a new key was created.
-// 		400 Bad Request if the key name is invalid or the body is not a JSON
-// string.
+// 		400 Bad Request if the key name is invalid, the body is not a JSON
+// string or its type is incompatible with the type of the key.
 //
 // Example: `curl -X PUT -d '"world"' localhost:33333/kdb/user/test/hello`
 func (s *server) putKdbHandler(w http.ResponseWriter, r *http.Request) {
-	value, err := stringBody(r)
+	var body interface{}
+	var binaryValue []byte
+	var err error
+
+	typed := parseTyped(r)
+	binary := parseBinary(r) || isOctetStreamRequest(r)
+
+	switch {
+	case isOctetStreamRequest(r):
+		binaryValue, err = ioutil.ReadAll(r.Body)
+	case binary:
+		var encoded string
+
+		if encoded, err = stringBody(r); err == nil {
+			binaryValue, err = base64.StdEncoding.DecodeString(encoded)
+		}
+	case typed:
+		body, err = jsonBody(r)
+	default:
+		body, err = stringBody(r)
+	}
 
 	if err != nil {
 		badRequest(w)
@@ -129,11 +249,31 @@ func (s *server) putKdbHandler(w http.ResponseWriter, r *http.Request) {
 
 	if existingKey != nil {
 		key = existingKey
-	} else {
+	}
+
+	value, ok := body.(string)
+
+	if typed && !binary {
+		value, err = typedToString(key, keyType(ks, key), body)
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+	} else if !ok && !binary {
+		badRequest(w)
+		return
+	}
+
+	if existingKey == nil {
 		ks.AppendKey(key)
 	}
 
-	err = key.SetString(value)
+	if binary {
+		err = key.SetBytes(binaryValue)
+	} else {
+		err = key.SetString(value)
+	}
 
 	if err != nil {
 		writeError(w, err)
@@ -161,14 +301,47 @@ func (s *server) putKdbHandler(w http.ResponseWriter, r *http.Request) {
 //
 // Arguments:
 // 		keyName		the name of the key to be deleted. URL path param.
+//		recursive	if `true` all keys below the key are deleted too.
+//					Optional query parameter (bool).
+//		dryRun		if `true` nothing is deleted, the names of the keys
+//					that would be deleted are returned. Optional query
+//					parameter (bool).
+//		confirm		must be `true` to delete more keys than the delete
+//					limit of the server. Optional query parameter (bool).
 //
 // Response Code:
+//		200 OK with the names of the keys if `dryRun` is set.
 //		204 No Content if the key was deleted.
 // 		400 Bad Request if the key name is invalid.
 //      404 Not Found if they key to delete was not found.
+//		409 Conflict if more keys than the delete limit would be deleted
+//		without `confirm`.
 //
 // Example: `curl -X DELETE localhost:33333/kdb/user/test/hello`
 func (s *server) deleteKdbHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	recursive, err := parseOptionalBool(query.Get("recursive"))
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	dryRun, err := parseOptionalBool(query.Get("dryRun"))
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	confirm, err := parseOptionalBool(query.Get("confirm"))
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
 	keyName := parseKeyNameFromURL(r)
 
 	key, err := elektra.NewKey(keyName)
@@ -198,16 +371,33 @@ func (s *server) deleteKdbHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	removedKey := ks.Remove(key)
+	removed := removeKeys(ks, key, recursive)
+	defer removed.Close()
+
+	count := removed.Len()
 
-	if removedKey == nil {
+	if count == 0 {
 		notFound(w)
 		return
 	}
 
+	if dryRun || (s.deleteLimit > 0 && count > s.deleteLimit && !confirm) {
+		// restore the session KeySet
+		ks.Append(removed)
+
+		if dryRun {
+			writeResponse(w, removed.KeyNames())
+		} else {
+			writeErrorCode(w, http.StatusConflict, fmt.Errorf("deleting %d keys requires confirm=true", count))
+		}
+
+		return
+	}
+
 	err = set(handle, ks, errKey)
 
 	if err != nil {
+		ks.Append(removed)
 		writeError(w, err)
 		return
 	}
@@ -215,17 +405,41 @@ func (s *server) deleteKdbHandler(w http.ResponseWriter, r *http.Request) {
 	noContent(w)
 }
 
-func lookup(ks elektra.KeySet, key elektra.Key, depth int) (result *lookupResult, err error) {
+// removeKeys removes the key and, if `recursive` is set, all keys below it
+// from `ks` and returns the removed keys.
+func removeKeys(ks elektra.KeySet, key elektra.Key, recursive bool) elektra.KeySet {
+	if recursive {
+		return ks.Cut(key)
+	}
+
+	removed := elektra.NewKeySet()
+
+	if removedKey := ks.Remove(key); removedKey != nil {
+		removed.AppendKey(removedKey)
+	}
+
+	return removed
+}
+
+func lookup(ks elektra.KeySet, key elektra.Key, depth int, opts lookupOptions) (*lookupResult, error) {
 	childKs := ks.Cut(key)
 	defer childKs.Close()
 
-	result = buildLookupResult(key, childKs)
+	listed, err := list(childKs, key, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer listed.close()
+
+	result := buildLookupResult(key, childKs, listed, opts)
 
 	if depth >= 0 {
-		result.Children, err = lookupChildren(childKs, key, depth)
+		result.Children, err = lookupChildren(childKs, key, listed, depth, opts)
 	}
 
-	return
+	return result, err
 }
 
 type lookupResult struct {
@@ -233,53 +447,116 @@ type lookupResult struct {
 	Name     string            `json:"name"`
 	Path     string            `json:"path"`
 	Ls       []string          `json:"ls"`
-	Value    string            `json:"value,omitempty"`
+	Next     string            `json:"next,omitempty"`
+	Counts   map[string]int    `json:"counts,omitempty"`
+	Value    interface{}       `json:"value,omitempty"`
+	Binary   bool              `json:"binary,omitempty"`
 	Meta     map[string]string `json:"meta,omitempty"`
 	Children []*lookupResult   `json:"children,omitempty"`
 }
 
-func buildLookupResult(key elektra.Key, ks elektra.KeySet) *lookupResult {
+func buildLookupResult(key elektra.Key, ks elektra.KeySet, listed *listResult, opts lookupOptions) *lookupResult {
 	foundKey := ks.Lookup(key)
 
 	var meta map[string]string
+	var value interface{}
 	exists := foundKey != nil
+	binary := false
 	name := key.BaseName()
-	value := ""
 	path := key.Name()
 
 	if exists {
-		value = foundKey.String()
+		binary = isBinary(foundKey)
+		value = lookupValue(foundKey, opts.typed)
 		meta = foundKey.MetaMap()
 	}
 
-	ls := ks.KeyNames()
+	ls := []string{}
+
+	for _, k := range listed.keys {
+		ls = append(ls, k.Name())
+	}
 
 	return &lookupResult{
 		Exists: exists,
 		Name:   name,
 		Path:   path,
 		Ls:     ls,
+		Next:   listed.next,
+		Counts: listed.counts,
 		Value:  value,
+		Binary: binary,
 		Meta:   meta,
 	}
 }
 
-func lookupChildren(ks elektra.KeySet, key elektra.Key, depth int) ([]*lookupResult, error) {
+// lookupValue returns the value of a key for the `lookupResult`. Empty
+// string values are omitted, typed values that are empty are null and
+// binary values are base64 encoded.
+func lookupValue(key elektra.Key, typed bool) interface{} {
+	if isBinary(key) {
+		return base64.StdEncoding.EncodeToString(key.Bytes())
+	}
+
+	if !typed {
+		if value := key.String(); value != "" {
+			return value
+		}
+
+		return nil
+	}
+
+	value, err := typedValue(key, metaType(key))
+
+	if err != nil {
+		// fall back to the raw value if it does not match its type
+		return key.String()
+	}
+
+	if value == nil {
+		return json.RawMessage("null")
+	}
+
+	return value
+}
+
+// lookupChildren looks up the existing direct children of `key` that are
+// part of the listed page. The children only list their direct children with
+// the number of keys below them, so that preloading does not list the whole
+// subtree again on every level.
+func lookupChildren(ks elektra.KeySet, key elektra.Key, listed *listResult, depth int, opts lookupOptions) ([]*lookupResult, error) {
+	var names []string
+
+	for _, k := range listed.keys {
+		if k.IsDirectlyBelow(key) && ks.LookupByName(k.Name()) != nil {
+			names = append(names, k.Name())
+		}
+	}
+
+	// pages only apply to the listing of the requested key
+	opts.after = ""
+	opts.depth = 1
+
 	var children []*lookupResult
 
-	ks.ForEach(func(subKey elektra.Key, _ int) {
-		if !subKey.IsDirectlyBelow(key) {
-			return
+	// the keys of `listed` are cut from `ks` by the lookups, so only their
+	// names are used
+	for _, name := range names {
+		subKey, err := elektra.NewKey(name)
+
+		if err != nil {
+			return nil, err
 		}
 
-		childLookup, err := lookup(ks, subKey, depth-1)
+		child, err := lookup(ks, subKey, depth-1, opts)
+		subKey.Close()
 
 		if err != nil {
-			return
+			return nil, err
 		}
 
-		children = append(children, childLookup)
-	})
+		children = append(children, child)
+	}
 
 	return children, nil
 }
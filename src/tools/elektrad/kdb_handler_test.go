@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestGetKdb(t *testing.T) {
@@ -58,3 +61,313 @@ func TestDeleteKdb(t *testing.T) {
 	removeKey(t, keyName)
 	Assert(t, key == nil, "key was not deleted")
 }
+
+func TestGetKdbTyped(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/typed/get"
+	typeName := "long"
+
+	setupKeyWithMeta(t, keyName, keyValueBody{Key: "type", Value: &typeName})
+	w := testPut(t, "/kdb/"+keyName, "42")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	w = testGet(t, "/kdb/"+keyName+"?typed=true")
+	removeKey(t, keyName)
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var response lookupResult
+
+	parseBody(t, w, &response)
+
+	value, ok := response.Value.(float64)
+	Assertf(t, ok && value == 42, "expected number 42, got %#v", response.Value)
+}
+
+func TestPutKdbTyped(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/typed/put"
+	typeName := "boolean"
+
+	setupKeyWithMeta(t, keyName, keyValueBody{Key: "type", Value: &typeName})
+
+	w := testPut(t, "/kdb/"+keyName+"?typed=true", true)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	w = testPut(t, "/kdb/"+keyName+"?typed=true", 42)
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusBadRequest, "number should not be accepted for a boolean: %v", code)
+
+	key := getKey(t, keyName)
+	removeKey(t, keyName)
+	Assert(t, key != nil, "key was not found")
+	Assertf(t, key.String() == "1", "wrong key value %q, expected 1", key.String())
+}
+
+func TestPutKdbBinary(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/binary"
+	encoded := "AAEC/w=="
+
+	w := testPut(t, "/kdb/"+keyName+"?binary=true", encoded)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusCreated, "wrong status code: %v", code)
+
+	w = testGet(t, "/kdb/"+keyName)
+	removeKey(t, keyName)
+
+	var response lookupResult
+
+	parseBody(t, w, &response)
+
+	Assert(t, response.Binary, "key is not binary")
+	Assertf(t, response.Value == encoded, "wrong value %v, expected %s", response.Value, encoded)
+}
+
+func TestGetKdbPaginated(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/paginated"
+	keyNames := []string{keyName + "/a", keyName + "/b", keyName + "/c"}
+
+	setupKey(t, keyNames...)
+
+	var ls []string
+	path := "/kdb/" + keyName + "?limit=2"
+
+	for i := 0; i < 3; i++ {
+		w := testGet(t, path)
+
+		code := w.Result().StatusCode
+		Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+		var response lookupResult
+		parseBody(t, w, &response)
+
+		Assertf(t, len(response.Ls) <= 2, "page has %d keys", len(response.Ls))
+		ls = append(ls, response.Ls...)
+
+		if response.Next == "" {
+			break
+		}
+
+		path = "/kdb/" + keyName + "?limit=2&after=" + response.Next
+	}
+
+	removeTree(t, keyName)
+
+	CompareStrings(t, keyNames, ls, "paginated ls is wrong")
+}
+
+func TestGetKdbDepth(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/depth"
+
+	setupKey(t, keyName+"/a", keyName+"/a/b", keyName+"/a/c", keyName+"/d/e")
+
+	w := testGet(t, "/kdb/"+keyName+"?depth=1")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var response lookupResult
+	parseBody(t, w, &response)
+
+	removeTree(t, keyName)
+
+	CompareStrings(t, []string{keyName, keyName + "/a", keyName + "/d"}, response.Ls, "ls with depth is wrong")
+	Assertf(t, response.Counts[keyName] == 4, "wrong count %d for %s", response.Counts[keyName], keyName)
+	Assertf(t, response.Counts[keyName+"/a"] == 2, "wrong count %d for /a", response.Counts[keyName+"/a"])
+	Assertf(t, response.Counts[keyName+"/d"] == 1, "wrong count %d for /d", response.Counts[keyName+"/d"])
+}
+
+func TestGetKdbStream(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/stream"
+
+	setupKey(t, keyName+"/a", keyName+"/b")
+
+	w := testHeaderRequest(t, "GET", "/kdb/"+keyName, http.Header{"Accept": {"application/x-ndjson"}})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var names []string
+
+	decoder := json.NewDecoder(w.Body)
+
+	for decoder.More() {
+		var entry listEntry
+		Check(t, decoder.Decode(&entry), "could not decode entry")
+
+		names = append(names, entry.Name)
+	}
+
+	removeTree(t, keyName)
+
+	CompareStrings(t, []string{keyName + "/a", keyName + "/b"}, names, "streamed keys are wrong")
+}
+
+func TestGetKdbStreamPaginated(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/streampaginated"
+
+	setupKey(t, keyName+"/a", keyName+"/b", keyName+"/c")
+	defer removeTree(t, keyName)
+
+	w := testHeaderRequest(t, "GET", "/kdb/"+keyName+"?limit=1&after="+keyName+"/a", http.Header{"Accept": {"application/x-ndjson"}})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var entries []listEntry
+
+	decoder := json.NewDecoder(w.Body)
+
+	for decoder.More() {
+		var entry listEntry
+		Check(t, decoder.Decode(&entry), "could not decode entry")
+
+		entries = append(entries, entry)
+	}
+
+	Assertf(t, len(entries) == 2, "expected a key and the next entry, got %v", entries)
+	Assertf(t, entries[0].Name == keyName+"/b", "wrong key %s", entries[0].Name)
+	Assertf(t, entries[1].Next == keyName+"/b", "wrong next key %s", entries[1].Next)
+}
+
+func TestGetKdbPreload(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/preload"
+
+	setupKey(t, keyName+"/a", keyName+"/a/b", keyName+"/a/b/c", keyName+"/a/b/d", keyName+"/e")
+	defer removeTree(t, keyName)
+
+	w := testGet(t, "/kdb/"+keyName+"?preload=1&limit=4")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var response lookupResult
+	parseBody(t, w, &response)
+
+	// /e is not part of the page
+	Assertf(t, len(response.Children) == 1, "wrong children %v", response.Children)
+
+	child := response.Children[0]
+	Assertf(t, child.Path == keyName+"/a", "wrong child %s", child.Path)
+	CompareStrings(t, []string{keyName + "/a", keyName + "/a/b"}, child.Ls, "children do not list their direct children")
+	Assertf(t, child.Counts[keyName+"/a/b"] == 2, "wrong count %d for /a/b", child.Counts[keyName+"/a/b"])
+	Assertf(t, len(child.Children) == 1 && child.Children[0].Path == keyName+"/a/b", "wrong preloaded children %v", child.Children)
+}
+
+func TestDeleteKdbRecursive(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/deleterecursive"
+	keyNames := []string{keyName, keyName + "/a", keyName + "/a/b"}
+
+	setupKey(t, keyNames...)
+
+	w := testDelete(t, "/kdb/"+keyName+"?recursive=true&dryRun=true", nil)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var names []string
+	parseBody(t, w, &names)
+	CompareStrings(t, keyNames, names, "dry run returned wrong keys")
+	Assert(t, getKey(t, keyName+"/a/b") != nil, "dry run deleted a key")
+
+	r := setupRouter(&server{pool: initPool(10), deleteLimit: 2})
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("DELETE", "/kdb/"+keyName+"?recursive=true", nil))
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusConflict, "wrong status code without confirmation: %v", code)
+	Assert(t, getKey(t, keyName+"/a/b") != nil, "key was deleted without confirmation")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("DELETE", "/kdb/"+keyName+"?recursive=true&confirm=true", nil))
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	for _, k := range keyNames {
+		Assertf(t, getKey(t, k) == nil, "key %s was not deleted", k)
+	}
+}
+
+func TestHeadKdb(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/head"
+
+	setupKey(t, keyName)
+
+	w := testHeaderRequest(t, "HEAD", "/kdb/"+keyName, http.Header{})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+	Assert(t, w.Body.Len() == 0, "HEAD returned a body")
+
+	etag := w.Header().Get("ETag")
+	Assert(t, etag != "", "ETag is missing")
+
+	w = testHeaderRequest(t, "GET", "/kdb/"+keyName, http.Header{"If-None-Match": {etag}})
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusNotModified, "wrong status code for matching ETag: %v", code)
+
+	testPut(t, "/kdb/"+keyName, "changed")
+
+	w = testHeaderRequest(t, "GET", "/kdb/"+keyName, http.Header{"If-None-Match": {etag}})
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code after change: %v", code)
+	Assert(t, w.Header().Get("ETag") != etag, "ETag did not change")
+
+	removeKey(t, keyName)
+
+	w = testHeaderRequest(t, "HEAD", "/kdb/"+keyName, http.Header{})
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusNotFound, "wrong status code for missing key: %v", code)
+}
+
+func TestGetKdbLastModified(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdb/lastmodified"
+
+	setupKey(t, keyName)
+	defer removeKey(t, keyName)
+
+	w := testHeaderRequest(t, "HEAD", "/kdb/"+keyName+"?a=1&b=2", http.Header{})
+
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+
+	_, err := http.ParseTime(lastModified)
+	Checkf(t, err, "invalid Last-Modified header %q", lastModified)
+
+	// the order of the query parameters does not change the representation
+	w = testHeaderRequest(t, "GET", "/kdb/"+keyName+"?b=2&a=1", http.Header{"If-None-Match": {etag}})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNotModified, "wrong status code for reordered query: %v", code)
+
+	w = testHeaderRequest(t, "GET", "/kdb/"+keyName+"?a=1&b=2", http.Header{"If-Modified-Since": {lastModified}})
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusNotModified, "wrong status code for If-Modified-Since: %v", code)
+
+	w = testHeaderRequest(t, "GET", "/kdb/"+keyName+"?a=1&b=2", http.Header{
+		"If-Modified-Since": {lastModified},
+		"If-None-Match":     {`"other"`},
+	})
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "If-Modified-Since was not ignored with If-None-Match: %v", code)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	testPut(t, "/kdb/"+keyName, "changed")
+
+	w = testHeaderRequest(t, "GET", "/kdb/"+keyName+"?a=1&b=2", http.Header{"If-Modified-Since": {past}})
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code after change: %v", code)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// arrayElementName returns the base name of the array element with the
+// index `i`, e.g. `#0`, `#_10` or `#__100`.
+func arrayElementName(i int) string {
+	digits := strconv.Itoa(i)
+
+	return "#" + strings.Repeat("_", len(digits)-1) + digits
+}
+
+// parseArrayIndex returns the index of an array element base name.
+func parseArrayIndex(baseName string) (int, bool) {
+	if !strings.HasPrefix(baseName, "#") {
+		return 0, false
+	}
+
+	digits := strings.TrimLeft(baseName[1:], "_")
+	underscores := len(baseName) - 1 - len(digits)
+
+	if digits == "" || len(digits) != underscores+1 || (len(digits) > 1 && digits[0] == '0') {
+		return 0, false
+	}
+
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+
+	i, err := strconv.Atoi(digits)
+
+	return i, err == nil
+}
+
+// escapeKeyNamePart escapes a single part of a key name, so that it can be
+// appended to a key name.
+func escapeKeyNamePart(part string) string {
+	switch part {
+	case "":
+		return "%"
+	case "%", ".", "..":
+		return `\` + part
+	}
+
+	part = strings.Replace(part, `\`, `\\`, -1)
+
+	return strings.Replace(part, "/", `\/`, -1)
+}
+
+// splitKeyName splits an escaped (relative) key name into its unescaped
+// parts.
+func splitKeyName(name string) []string {
+	var parts []string
+	var part strings.Builder
+
+	escaped := false
+	partEscaped := false
+
+	flush := func() {
+		switch {
+		case !partEscaped && part.String() == "%":
+			parts = append(parts, "")
+		case part.Len() > 0:
+			parts = append(parts, part.String())
+		}
+
+		part.Reset()
+		partEscaped = false
+	}
+
+	for _, c := range name {
+		switch {
+		case escaped:
+			part.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+			partEscaped = true
+		case c == '/':
+			flush()
+		default:
+			part.WriteRune(c)
+		}
+	}
+
+	flush()
+
+	return parts
+}
+
+// relativeKeyName returns the part of the key name below the root key name.
+func relativeKeyName(rootName, name string) string {
+	if !strings.HasPrefix(name, rootName) {
+		rootName = cascadingName(rootName)
+		name = cascadingName(name)
+	}
+
+	return strings.TrimPrefix(strings.TrimPrefix(name, rootName), "/")
+}
+
+// namespaces are the namespaces that can contain keys: `spec` followed by
+// the namespaces in the order of the cascading lookup.
+var namespaces = []string{"spec", "proc", "dir", "user", "system", "default"}
+
+// withNamespace replaces the namespace of a key name. Key names without
+// namespace are treated as cascading names.
+func withNamespace(name, namespace string) string {
+	if i := strings.Index(name, ":/"); i >= 0 && !strings.Contains(name[:i], "/") {
+		name = name[i+1:]
+	} else if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+
+	return namespace + ":" + name
+}
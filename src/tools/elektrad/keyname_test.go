@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestArrayElementName(t *testing.T) {
+	for i, expected := range map[int]string{0: "#0", 9: "#9", 10: "#_10", 123: "#__123"} {
+		name := arrayElementName(i)
+		Assertf(t, name == expected, "expected %s, got %s", expected, name)
+
+		index, ok := parseArrayIndex(name)
+		Assertf(t, ok && index == i, "could not parse %s", name)
+	}
+
+	for _, name := range []string{"#", "#10", "#_1", "#_01", "#a", "0"} {
+		_, ok := parseArrayIndex(name)
+		Assertf(t, !ok, "%s is not an array element", name)
+	}
+}
+
+func TestSplitKeyName(t *testing.T) {
+	parts := splitKeyName(`a/b\/c/%/\%/` + escapeKeyNamePart(`d\e`))
+
+	CompareStrings(t, []string{"a", "b/c", "", "%", `d\e`}, parts, "wrong parts")
+}
+
+func TestWithNamespace(t *testing.T) {
+	tests := []struct {
+		name, namespace, expected string
+	}{
+		{"user:/sw/app", "dir", "dir:/sw/app"},
+		{"/sw/app", "system", "system:/sw/app"},
+		{"sw/app", "user", "user:/sw/app"},
+		{"/", "spec", "spec:/"},
+		{"user:/", "dir", "dir:/"},
+		{"/sw/a:/b", "dir", "dir:/sw/a:/b"},
+	}
+
+	for _, test := range tests {
+		result := withNamespace(test.name, test.namespace)
+		Assertf(t, result == test.expected, "withNamespace(%q, %q) = %q, expected %q", test.name, test.namespace, result, test.expected)
+	}
+}
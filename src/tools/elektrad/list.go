@@ -0,0 +1,313 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+// lookupOptions control which keys of a subtree are returned by `lookup`.
+type lookupOptions struct {
+	typed bool
+	// limit is the maximum number of listed keys, 0 means no limit
+	limit int
+	// after is the name of the last key of the previous page
+	after string
+	// depth is the maximum number of levels below the key that are
+	// listed, 0 means no limit
+	depth int
+}
+
+// listEntry is a single line of the NDJSON listing.
+type listEntry struct {
+	Name  string            `json:"name,omitempty"`
+	Value interface{}       `json:"value,omitempty"`
+	Meta  map[string]string `json:"meta,omitempty"`
+	Count *int              `json:"count,omitempty"`
+	Next  string            `json:"next,omitempty"`
+}
+
+type listResult struct {
+	keys []elektra.Key
+	// counts contains the number of keys below each listed key, only if the
+	// depth is limited
+	counts map[string]int
+	// next is the name of the last listed key if there are more keys
+	next string
+	// virtual are the listed keys that do not exist, they are closed by
+	// `close`
+	virtual []elektra.Key
+}
+
+func (l *listResult) close() {
+	for _, k := range l.virtual {
+		k.Close()
+	}
+}
+
+func parseLookupOptions(r *http.Request) (opts lookupOptions, err error) {
+	query := r.URL.Query()
+
+	opts.typed = parseTyped(r)
+	opts.after = query.Get("after")
+
+	if limit := query.Get("limit"); limit != "" {
+		if opts.limit, err = strconv.Atoi(limit); err != nil || opts.limit < 1 {
+			return opts, fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+
+	if depth := query.Get("depth"); depth != "" {
+		if opts.depth, err = strconv.Atoi(depth); err != nil || opts.depth < 1 {
+			return opts, fmt.Errorf("invalid depth %q", depth)
+		}
+	}
+
+	return opts, nil
+}
+
+// isNDJSONRequest returns true if the client accepts newline delimited JSON.
+func isNDJSONRequest(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType(strings.TrimSpace(accept)) == "application/x-ndjson" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// list returns the keys of `ks` that are listed for `key`. With a limited
+// depth also names of keys that do not exist but have keys below them are
+// listed. The result must be closed.
+func list(ks elektra.KeySet, key elektra.Key, opts lookupOptions) (*listResult, error) {
+	after, err := afterKey(opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if after != nil {
+		defer after.Close()
+	}
+
+	result := &listResult{}
+
+	keys := ks.ToSlice()
+
+	if opts.depth > 0 {
+		if keys, result.counts, result.virtual, err = listDepth(ks, key, opts.depth); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, k := range keys {
+		if !k.IsBelowOrSame(key) || (after != nil && k.Compare(after) <= 0) {
+			continue
+		}
+
+		if opts.limit > 0 && len(result.keys) == opts.limit {
+			result.next = result.keys[len(result.keys)-1].Name()
+			break
+		}
+
+		result.keys = append(result.keys, k)
+	}
+
+	return result, nil
+}
+
+// afterKey returns the key of the `after` option, nil if it is not set.
+func afterKey(opts lookupOptions) (elektra.Key, error) {
+	if opts.after == "" {
+		return nil, nil
+	}
+
+	return elektra.NewKey(opts.after)
+}
+
+// listDepth returns the keys at most `depth` levels below `key` and the
+// number of keys below each of them. The returned virtual keys do not exist
+// in `ks` and must be closed.
+func listDepth(ks elektra.KeySet, key elektra.Key, depth int) ([]elektra.Key, map[string]int, []elektra.Key, error) {
+	var keys, virtual []elektra.Key
+	var err error
+
+	counts := map[string]int{}
+	rootName := strings.TrimSuffix(key.Name(), "/")
+
+	ks.ForEach(func(k elektra.Key, _ int) {
+		if err != nil || !k.IsBelowOrSame(key) {
+			return
+		}
+
+		parts := splitKeyName(relativeKeyName(key.Name(), k.Name()))
+		name := rootName
+
+		for level := 0; level <= len(parts) && level <= depth; level++ {
+			if level > 0 {
+				name += "/" + escapeKeyNamePart(parts[level-1])
+			}
+
+			if _, ok := counts[name]; !ok {
+				entry := k
+
+				if level < len(parts) {
+					// a key that does not exist but has keys below it
+					if existing := ks.LookupByName(name); existing != nil {
+						entry = existing
+					} else {
+						if entry, err = elektra.NewKey(name); err != nil {
+							return
+						}
+
+						virtual = append(virtual, entry)
+					}
+				}
+
+				counts[name] = 0
+				keys = append(keys, entry)
+			}
+
+			if level < len(parts) {
+				counts[name]++
+			}
+		}
+	})
+
+	if err != nil {
+		for _, k := range virtual {
+			k.Close()
+		}
+
+		return nil, nil, nil, err
+	}
+
+	// use the names of the listed keys, they may differ from the constructed
+	// names, e.g. for the root key `user:/`
+	named := map[string]int{}
+
+	for _, k := range keys {
+		named[k.Name()] = counts[strings.TrimSuffix(k.Name(), "/")]
+	}
+
+	return keys, named, virtual, nil
+}
+
+// listWriter writes listed keys as newline delimited JSON.
+type listWriter struct {
+	encoder *json.Encoder
+	flusher http.Flusher
+	typed   bool
+	written int
+	err     error
+}
+
+func newListWriter(w http.ResponseWriter, typed bool) *listWriter {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	flusher, _ := w.(http.Flusher)
+
+	return &listWriter{
+		encoder: json.NewEncoder(w),
+		flusher: flusher,
+		typed:   typed,
+	}
+}
+
+// write writes a key, the value and metadata only if the key exists.
+func (lw *listWriter) write(k elektra.Key, exists bool, count *int) {
+	if lw.err != nil {
+		return
+	}
+
+	entry := &listEntry{
+		Name:  k.Name(),
+		Count: count,
+	}
+
+	if exists {
+		entry.Value = lookupValue(k, lw.typed)
+		entry.Meta = k.MetaMap()
+	}
+
+	lw.err = lw.encoder.Encode(entry)
+	lw.written++
+
+	if lw.flusher != nil && lw.written%1000 == 0 {
+		lw.flusher.Flush()
+	}
+}
+
+// finish writes the name of the last key if there are more keys.
+func (lw *listWriter) finish(next string) {
+	if lw.err == nil && next != "" {
+		lw.err = lw.encoder.Encode(&listEntry{Next: next})
+	}
+}
+
+// writeList streams the keys of `ks` that are listed for `key` as newline
+// delimited JSON. Without a depth limit the keys are written while `ks` is
+// iterated, so the listing is not copied.
+func writeList(w http.ResponseWriter, ks elektra.KeySet, key elektra.Key, opts lookupOptions) error {
+	if opts.depth > 0 {
+		// the counts are only complete after all keys were visited
+		listed, err := list(ks, key, opts)
+
+		if err != nil {
+			return err
+		}
+
+		defer listed.close()
+
+		lw := newListWriter(w, opts.typed)
+
+		for _, k := range listed.keys {
+			count := listed.counts[k.Name()]
+			lw.write(k, ks.LookupByName(k.Name()) != nil, &count)
+		}
+
+		lw.finish(listed.next)
+
+		return nil
+	}
+
+	after, err := afterKey(opts)
+
+	if err != nil {
+		return err
+	}
+
+	if after != nil {
+		defer after.Close()
+	}
+
+	lw := newListWriter(w, opts.typed)
+
+	var last, next string
+	listed := 0
+
+	ks.ForEach(func(k elektra.Key, _ int) {
+		if next != "" || lw.err != nil || !k.IsBelowOrSame(key) || (after != nil && k.Compare(after) <= 0) {
+			return
+		}
+
+		if opts.limit > 0 && listed == opts.limit {
+			next = last
+			return
+		}
+
+		lw.write(k, true, nil)
+
+		last = k.Name()
+		listed++
+	})
+
+	lw.finish(next)
+
+	return nil
+}
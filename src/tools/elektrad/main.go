@@ -2,35 +2,328 @@ package main
 
 import (
 	"flag"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/user"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func main() {
 	port := flag.Int("port", 33333, "the port the server listens on")
 	initHandles := flag.Int("handles", 10, "count of preinitialized handles")
+	kdbTool := flag.String("kdb", "kdb", "the kdb tool used for mounting and importing")
+	deleteLimit := flag.Int("delete-limit", 1000, "count of keys a recursive delete may remove without confirmation, 0 means no limit")
+	socket := flag.String("socket", "", "listen on this unix socket instead of the port")
+	listen := flag.String("listen", "", "the address the server listens on, e.g. localhost:33333, defaults to all interfaces and -port")
+	impersonate := flag.Bool("impersonate", false, "serve every authenticated user from an elektrad process running as this user")
+	userHeader := flag.String("user-header", "X-Remote-User", "the request header containing the authenticated user if impersonating")
+	userMapFile := flag.String("user-map", "", "file mapping authenticated users to unix users if impersonating")
+	userGroup := flag.String("user-group", "", "only impersonate the members of this unix group")
+	idleTimeout := flag.Duration("idle-timeout", 10*time.Minute, "stop the elektrad process of a user without requests for this time if impersonating, 0 disables it")
+	grpcPort := flag.Int("grpc-port", 0, "the port of the gRPC API, 0 disables it")
+	etcdPort := flag.Int("etcd-port", 0, "the port of the etcd v3 compatible gateway, 0 disables it")
+	etcdRoot := flag.String("etcd-root", "user:/etcd", "the key containing the keys of the etcd gateway")
+	consulRoot := flag.String("consul-root", "", "serve the Consul KV API for the keys below this key, empty disables it")
+	refresh := flag.Duration("refresh", time.Second, "the interval the etcd and Consul gateways check for changes made outside of them")
+	webhookRootFlag := flag.String("webhooks", "", "the key containing the webhooks, e.g. system:/elektrad/webhooks, empty disables webhooks")
+	webhookHosts := flag.String("webhook-hosts", "", "comma separated hosts webhooks may be delivered to, empty allows all")
+	webhookRetries := flag.Int("webhook-retries", 5, "count of retries of failed webhook deliveries")
+	webhookBackoff := flag.Duration("webhook-backoff", time.Second, "the delay before the first retry of a webhook delivery, it doubles with every retry")
+	webhookDeadLetter := flag.String("webhook-dead-letter", "", "file the undeliverable webhook deliveries are appended to, defaults to stderr")
+	webhookDeadLetterFD := flag.Int("webhook-dead-letter-fd", 0, "file descriptor the undeliverable webhook deliveries are written to, used by -impersonate")
+	zeroMQPublish := flag.String("zeromq-publish", "", "publish change notifications to this ZeroMQ hub endpoint, e.g. tcp://localhost:6000")
+	zeroMQSubscribe := flag.String("zeromq-subscribe", "", "receive change notifications from this ZeroMQ hub endpoint, e.g. tcp://localhost:6001")
+	dbusBus := flag.String("dbus", "", "publish and receive change notifications on the D-Bus `session` or `system` bus")
+	watchBackends := flag.Bool("watch-backends", true, "refresh the handles when the files of the mounted backends are modified by other processes")
+	contextDirsFlag := flag.String("context-dirs", "", "comma separated directories the cwd and home of resolver contexts must be inside of, empty disables resolver contexts")
+	storageName := flag.String("storage", "elektra", "the storage of the keys: `elektra` or `memory`, memory keys are lost on exit")
 
 	flag.Parse()
 
-	err := loadVersion()
+	if *impersonate {
+		if *grpcPort != 0 {
+			log.Fatal("the gRPC API is not supported with -impersonate")
+		}
 
-	if err != nil {
+		if *etcdPort != 0 {
+			log.Fatal("the etcd gateway is not supported with -impersonate")
+		}
+
+		if *zeroMQPublish != "" || *zeroMQSubscribe != "" || *dbusBus != "" {
+			log.Fatal("notifications are not supported with -impersonate")
+		}
+
+		if *socket == "" && !isLoopbackAddress(*listen) {
+			// the user header is trusted, so only the proxy may connect
+			log.Fatal("-impersonate requires -socket or a loopback -listen address, e.g. localhost:33333")
+		}
+
+		if *userMapFile == "" && *userGroup == "" {
+			// otherwise every principal could use any account, e.g. of a service
+			log.Fatal("-impersonate requires -user-map or -user-group")
+		}
+
+		i := &impersonator{
+			header:      *userHeader,
+			idleTimeout: *idleTimeout,
+			args: []string{
+				"-handles", strconv.Itoa(*initHandles),
+				"-kdb", *kdbTool,
+				"-delete-limit", strconv.Itoa(*deleteLimit),
+				"-storage", *storageName,
+				"-context-dirs", *contextDirsFlag,
+				"-consul-root", *consulRoot,
+				"-refresh", refresh.String(),
+				"-watch-backends=" + strconv.FormatBool(*watchBackends),
+				// every user process delivers the webhooks of its user
+				"-webhooks", *webhookRootFlag,
+				"-webhook-hosts", *webhookHosts,
+				"-webhook-retries", strconv.Itoa(*webhookRetries),
+				"-webhook-backoff", webhookBackoff.String(),
+			},
+		}
+
+		if *webhookRootFlag != "" && !strings.HasPrefix(*webhookRootFlag, "user:/") {
+			// otherwise every user process would deliver the same webhooks
+			log.Fatal("with -impersonate the -webhooks key must be in the user:/ namespace")
+		}
+
+		if *webhookRootFlag != "" && *webhookDeadLetter != "" {
+			f, err := os.OpenFile(*webhookDeadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			// the users can not open the file themselves
+			i.files = []*os.File{f}
+			i.args = append(i.args, "-webhook-dead-letter-fd", "3")
+		}
+
+		if *userMapFile != "" {
+			var err error
+
+			if i.userMap, err = parseUserMap(*userMapFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if *userGroup != "" {
+			group, err := user.LookupGroup(*userGroup)
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			i.groupID = group.Gid
+		}
+
+		go i.stopIdleChildrenLoop()
+
+		serve(listenAddress(*listen, *port), *socket, i)
+
+		return
+	}
+
+	if *contextDirsFlag != "" {
+		contextDirs = strings.Split(*contextDirsFlag, ",")
+	}
+
+	var err error
+
+	if backend, err = newStorage(*storageName); err != nil {
+		log.Fatal(err)
+	}
+
+	if err = loadVersion(); err != nil {
 		log.Fatal(err)
 	}
 
-	app := &server{pool: initPool(*initHandles)}
+	// set before the first handle is opened, the handles hide the secrets
+	webhookRoot = *webhookRootFlag
+
+	app := &server{
+		pool:        initPool(*initHandles),
+		kdbTool:     *kdbTool,
+		deleteLimit: *deleteLimit,
+	}
+
+	// subscriber invalidates cached keys after changes of other processes
+	subscriber := &notificationSubscriber{}
+
+	// refresher keeps the KeySets of the pooled and session handles up to
+	// date after changes of other processes
+	refresher := newHandleRefresher(app.pool)
+
+	subscriber.listen(func(string) {
+		refresher.changed()
+	})
+
+	go refresher.run()
+
+	if *consulRoot != "" {
+		if app.consul, err = newEtcdGateway(*consulRoot); err != nil {
+			log.Fatal(err)
+		}
+
+		subscriber.listen(app.consul.invalidate)
+
+		go app.consul.refreshLoop(*refresh)
+	}
+
+	if webhookRoot != "" {
+		var deadLetter io.Writer = os.Stderr
+
+		if *webhookDeadLetterFD > 0 {
+			deadLetter = os.NewFile(uintptr(*webhookDeadLetterFD), "webhook-dead-letter")
+		} else if *webhookDeadLetter != "" {
+			f, err := os.OpenFile(*webhookDeadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			defer f.Close()
+
+			deadLetter = f
+		}
+
+		var hosts []string
+
+		if *webhookHosts != "" {
+			hosts = strings.Split(*webhookHosts, ",")
+		}
+
+		if webhooks, err = newWebhookDispatcher(webhookRoot, hosts, *webhookRetries, *webhookBackoff, deadLetter); err != nil {
+			log.Fatal(err)
+		}
+
+		subscriber.listen(func(string) {
+			webhooks.changed()
+		})
+
+		go webhooks.run()
+	}
 
 	r := setupRouter(app)
 
-	if err := http.ListenAndServe(":"+strconv.Itoa(*port), r); err != nil {
+	if *grpcPort != 0 {
+		go func() {
+			log.Fatal(serveGRPC(*grpcPort, app))
+		}()
+	}
+
+	if *etcdPort != 0 {
+		gateway, err := newEtcdGateway(*etcdRoot)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		subscriber.listen(gateway.invalidate)
+
+		go func() {
+			log.Fatal(serveEtcd(*etcdPort, gateway, *refresh))
+		}()
+	}
+
+	var transports []notificationTransport
+
+	if *zeroMQPublish != "" || *zeroMQSubscribe != "" {
+		t, err := newZeroMQTransport(*zeroMQPublish, *zeroMQSubscribe)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		transports = append(transports, t)
+	}
+
+	if *dbusBus != "" {
+		t, err := newDBusTransport(*dbusBus)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		transports = append(transports, t)
+	}
+
+	if len(transports) > 0 {
+		if notifier, err = newNotificationPublisher(transports); err != nil {
+			log.Fatal(err)
+		}
+
+		go notifier.run()
+
+		for _, t := range transports {
+			go subscriber.subscribe(t)
+		}
+	}
+
+	// the memory storage is only changed by elektrad itself
+	if *watchBackends && *storageName == "elektra" {
+		detector, err := newChangeDetector(app.backendFile, func(mountpoint string) {
+			subscriber.notify(notificationCommit, mountpoint)
+		}, changeDetectionDelay)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer detector.close()
+
+		go detector.run()
+	}
+
+	serve(listenAddress(*listen, *port), *socket, r)
+}
+
+// listenAddress returns the `-listen` address, or all interfaces and `port`
+// if it is not set.
+func listenAddress(listen string, port int) string {
+	if listen != "" {
+		return listen
+	}
+
+	return ":" + strconv.Itoa(port)
+}
+
+func serve(addr string, socket string, handler http.Handler) {
+	if socket == "" {
+		if err := http.ListenAndServe(addr, handler); err != nil {
+			log.Print(err)
+		}
+
+		return
+	}
+
+	os.Remove(socket)
+
+	listener, err := net.Listen("unix", socket)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := http.Serve(listener, handler); err != nil {
 		log.Print(err)
 	}
 }
 
 type server struct {
-	pool *handlePool
+	pool    *handlePool
+	kdbTool string
+	// deleteLimit is the count of keys above which a recursive delete must
+	// be confirmed, 0 means no limit
+	deleteLimit int
+	// consul serves the Consul KV API, nil if it is disabled
+	consul *etcdGateway
 }
 
 type elektraVersion struct {
@@ -3,15 +3,197 @@ package main
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
+	"github.com/gorilla/mux"
 	elektra "go.libelektra.org/kdb"
 )
 
+// metaSeparator separates the key path from the name of a metakey in the
+// URL, e.g. `/kdbMeta/user/app/port/meta:/check/range`. Metakey names may
+// contain `/`, so they are passed with their `meta:/` namespace.
+const metaSeparator = "/meta:/"
+
 type keyValueBody struct {
 	Key   string  `json:"key"`
 	Value *string `json:"value"`
 }
 
+// parseMetaNameFromURL splits the path of the URL into the key name and the
+// name of a metakey, which is empty if the path does not contain one.
+func parseMetaNameFromURL(r *http.Request) (keyName, metaName string, hasMetaName bool) {
+	path := "/" + mux.Vars(r)["path"]
+
+	i := strings.Index(path, metaSeparator)
+
+	if i < 0 {
+		return parseKeyNameFromURL(r), "", false
+	}
+
+	return keyNameFromPath(r, strings.TrimPrefix(path[:i], "/")), path[i+len(metaSeparator):], true
+}
+
+// getMetaHandler returns all metakeys of a key or the value of a single
+// metakey.
+//
+// Arguments:
+//		keyName 	the name of the key. URL path param.
+//		metaName	the name of the metakey. Optional URL path param,
+//					after `meta:/`.
+//
+// Response Code:
+//		200 OK if the request is successfull.
+//		400 Bad Request if the key name or metakey name is invalid.
+//		404 Not Found if the key or the metakey does not exist.
+//
+// Returns: JSON object with the metakeys or a JSON string with the value
+// of the requested metakey.
+//
+// Example: `curl localhost:33333/kdbMeta/user/test/hello/meta:/type`
+func (s *server) getMetaHandler(w http.ResponseWriter, r *http.Request) {
+	keyName, metaName, hasMetaName := parseMetaNameFromURL(r)
+
+	if hasMetaName && metaName == "" {
+		badRequest(w)
+		return
+	}
+
+	key, err := elektra.NewKey(keyName)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer key.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, key)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	k := ks.Lookup(key)
+
+	if k == nil {
+		notFound(w)
+		return
+	}
+
+	if !hasMetaName {
+		writeResponse(w, metaMap(k))
+		return
+	}
+
+	if !hasMeta(k, metaName) {
+		notFound(w)
+		return
+	}
+
+	writeResponse(w, k.Meta(metaName))
+}
+
+// putMetaHandler replaces all metakeys of a key in one commit. The key is
+// created if it does not exist.
+//
+// Arguments:
+//		keyName the name of the key. URL path param.
+//		meta	the new metakeys. JSON object PUT body.
+//
+// Response Code:
+//		204 No Content if the request is successfull.
+//		400 Bad Request if the key name or the body is invalid.
+//
+// Example: `curl -X PUT -d '{ "type": "long", "default": "1" }' localhost:33333/kdbMeta/user/test/hello`
+func (s *server) putMetaHandler(w http.ResponseWriter, r *http.Request) {
+	var meta map[string]string
+
+	keyName := parseKeyNameFromURL(r)
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&meta); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	errKey, err := elektra.NewKey(keyName)
+
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+
+	defer errKey.Close()
+
+	key, err := elektra.NewKey(keyName)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer key.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, errKey)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// modify a copy, so that the KeySet is unchanged if a metakey is invalid
+	k := key
+
+	var original elektra.Key
+
+	if existingKey := ks.Lookup(key); existingKey != nil {
+		k = existingKey.Duplicate(elektra.KEY_CP_ALL)
+
+		// restores the session KeySet if the write fails
+		original = existingKey.Duplicate(elektra.KEY_CP_ALL)
+		defer original.Close()
+	}
+
+	for name := range metaMap(k) {
+		if _, ok := meta[name]; !ok {
+			if err = k.RemoveMeta(name); err != nil {
+				writeError(w, err)
+				return
+			}
+		}
+	}
+
+	for name, value := range meta {
+		if err = k.SetMeta(name, value); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	ks.AppendKey(k)
+
+	err = set(handle, ks, errKey)
+
+	if err != nil {
+		// the invalid metadata must not leak into the next request
+		if original != nil {
+			ks.AppendKey(original)
+		} else {
+			ks.Remove(k)
+		}
+
+		writeError(w, err)
+		return
+	}
+
+	noContent(w)
+}
+
 // postMetaHandler sets a Meta value on a key if a value was passed,
 // and deletes the existing Meta value if not.
 //
@@ -99,22 +281,35 @@ func (s *server) postMetaHandler(w http.ResponseWriter, r *http.Request) {
 // deleteMetaHandler deletes a Meta key.
 //
 // Arguments:
-//		keyName the name of the Key.
-//		key		the name of the metaKey. Passed through the key field of the JSON body.
+//		keyName 	the name of the Key. URL path param.
+//		metaName	the name of the metaKey. URL path param, after `meta:/`.
+//		key			the name of the metaKey if it is not part of the URL.
+//					Passed through the key field of the JSON body
+//					(deprecated, the body of DELETE requests is dropped by
+//					some clients and proxies).
 //
 // Response Code:
 //		201 No Content if the request is successfull.
 //		401 Bad Request if no key name was passed - or the key name is invalid.
 //      404 Not Found if the key was not found.
 //
-// Example: `curl -X DELETE -d '{ "key": "hello" }' localhost:33333/kdbMeta/user/test/hello`
+// Example: `curl -X DELETE localhost:33333/kdbMeta/user/test/hello/meta:/hello`
 func (s *server) deleteMetaHandler(w http.ResponseWriter, r *http.Request) {
 	var meta keyValueBody
 
-	keyName := parseKeyNameFromURL(r)
+	keyName, metaName, hasMetaName := parseMetaNameFromURL(r)
 
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&meta); err != nil {
+	if hasMetaName {
+		meta.Key = metaName
+	} else {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&meta); err != nil {
+			badRequest(w)
+			return
+		}
+	}
+
+	if meta.Key == "" {
 		badRequest(w)
 		return
 	}
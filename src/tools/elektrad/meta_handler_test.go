@@ -2,6 +2,8 @@ package main
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -50,3 +52,123 @@ func TestDeleteMetaHandler(t *testing.T) {
 	metaValue := key.Meta(meta.Key)
 	Assertf(t, metaValue == "", "key meta value is not empty: %q", metaValue)
 }
+
+func TestGetMeta(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdbmeta/get"
+	value := "long"
+
+	setupKeyWithMeta(t, keyName, keyValueBody{Key: "type", Value: &value})
+
+	w := testGet(t, "/kdbMeta/"+keyName)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	meta := map[string]string{}
+	parseBody(t, w, &meta)
+	Assertf(t, meta["type"] == value, "wrong meta %v", meta)
+
+	w = testGet(t, "/kdbMeta/"+keyName+"/meta:/type")
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	metaValue := ""
+	parseBody(t, w, &metaValue)
+	Assertf(t, metaValue == value, "wrong meta value %q", metaValue)
+
+	w = testGet(t, "/kdbMeta/"+keyName+"/meta:/doesnotexist")
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusNotFound, "wrong status code for missing metakey: %v", code)
+
+	removeKey(t, keyName)
+}
+
+func TestGetMetaWithSlash(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdbmeta/slash"
+	value := "1-10"
+
+	setupKeyWithMeta(t, keyName, keyValueBody{Key: "check/range", Value: &value})
+	defer removeKey(t, keyName)
+
+	w := testGet(t, "/kdbMeta/tests/elektrad/kdbmeta/slash/meta:/check/range?namespace=user")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	metaValue := ""
+	parseBody(t, w, &metaValue)
+	Assertf(t, metaValue == value, "wrong meta value %q", metaValue)
+
+	w = testGet(t, "/kdbMeta/"+keyName+"/meta:/")
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusBadRequest, "wrong status code for empty metakey name: %v", code)
+}
+
+func TestPutMeta(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdbmeta/put"
+	value := "old"
+
+	setupKeyWithMeta(t, keyName, keyValueBody{Key: "old", Value: &value})
+
+	w := testPut(t, "/kdbMeta/"+keyName, map[string]string{
+		"type":    "long",
+		"default": "1",
+	})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	key := getKey(t, keyName)
+	removeKey(t, keyName)
+	Assert(t, key != nil, "key not found")
+	Assertf(t, key.Meta("type") == "long", "wrong type %q", key.Meta("type"))
+	Assertf(t, key.Meta("default") == "1", "wrong default %q", key.Meta("default"))
+	Assert(t, !hasMeta(key, "old"), "old metakey was not removed")
+}
+
+func TestPutMetaFailure(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdbmeta/put/failure"
+	value := "old"
+
+	setupKeyWithMeta(t, keyName, keyValueBody{Key: "old", Value: &value})
+	defer removeKey(t, keyName)
+
+	s := storeSession(initPool(1), "meta-failure-test")
+	defer sessions.Delete("meta-failure-test")
+
+	s.handle.kdb = failingKDB{s.handle.kdb}
+
+	r, err := http.NewRequest("PUT", "/kdbMeta/"+keyName, strings.NewReader(`{ "type": "long" }`))
+	Check(t, err, "could not create request")
+
+	r.AddCookie(&http.Cookie{Name: "session", Value: "meta-failure-test"})
+
+	w := httptest.NewRecorder()
+	setupRouter(&server{pool: initPool(1)}).ServeHTTP(w, r)
+
+	Assertf(t, w.Code != http.StatusNoContent, "the failed write succeeded: %v", w.Code)
+
+	key := s.handle.keySet.LookupByName(keyName)
+	Assert(t, key != nil, "the key was removed from the session")
+	Assertf(t, key.Meta("old") == "old" && key.Meta("type") == "", "the session keeps the failed metadata: %v", metaMap(key))
+}
+
+func TestDeleteMetaQuery(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdbmeta/delete/query"
+	value := "value"
+
+	setupKeyWithMeta(t, keyName, keyValueBody{Key: "delmeta", Value: &value})
+
+	w := testDelete(t, "/kdbMeta/"+keyName+"/meta:/delmeta", nil)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	key := getKey(t, keyName)
+	removeKey(t, keyName)
+	Assert(t, key != nil, "key not found")
+	Assert(t, !hasMeta(key, "delmeta"), "metakey was not deleted")
+}
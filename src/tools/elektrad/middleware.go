@@ -18,7 +18,9 @@ var (
 
 type session struct {
 	handle *handle
-	mut    sync.Mutex
+	// contexts contains the handles for other resolver contexts
+	contexts map[resolverContext]*handle
+	mut      sync.Mutex
 
 	expiry time.Time
 }
@@ -35,16 +37,11 @@ func handleMiddleware(pool *handlePool) mux.MiddlewareFunc {
 			} else {
 				uuid := cookie.Value
 
-				now := time.Now()
+				var ok bool
 
-				ses, ok := sessions.Load(uuid)
-
-				if s, ok = ses.(*session); !ok || now.After(s.expiry) {
+				if s, ok = loadSession(uuid); !ok {
 					// the session expired or does not exist, create a new one
 					s = newSessionWithUUID(w, r, pool, uuid)
-				} else {
-					// extend lifetime of session after every request
-					s.expiry = sessionExpiry()
 				}
 			}
 
@@ -52,6 +49,21 @@ func handleMiddleware(pool *handlePool) mux.MiddlewareFunc {
 			s.mut.Lock()
 			defer s.mut.Unlock()
 
+			ctx, err := parseResolverContext(r)
+
+			var h *handle
+
+			if err == nil {
+				h, err = s.contextHandle(ctx)
+			}
+
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+
+			w.Header().Set("X-Elektrad-Refreshed", h.refreshed.UTC().Format(time.RFC3339Nano))
+
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -67,15 +79,17 @@ func freeHandles() {
 			s := value.(*session)
 
 			if now.After(s.expiry) {
-				err := s.handle.kdb.Close()
+				// a refresh of the session may be in progress
+				s.mut.Lock()
 
-				if err != nil {
-					log.Printf("error closing handle: %v", err)
-				}
+				closeHandle(s.handle)
 
-				s.handle.keySet.Close()
+				for _, h := range s.contexts {
+					closeHandle(h)
+				}
 
 				sessions.Delete(key)
+				s.mut.Unlock()
 			}
 
 			return true
@@ -83,6 +97,33 @@ func freeHandles() {
 	}
 }
 
+// refreshSessions refreshes the handles of all sessions that did not expire.
+// Sessions handling a request are refreshed after the request.
+func refreshSessions() {
+	sessions.Range(func(key, value interface{}) bool {
+		s := value.(*session)
+
+		s.mut.Lock()
+		defer s.mut.Unlock()
+
+		if time.Now().After(s.expiry) {
+			return true
+		}
+
+		if err := s.handle.refresh(); err != nil {
+			log.Printf("could not refresh the handle of session %v: %v", key, err)
+		}
+
+		for _, h := range s.contexts {
+			if err := h.refresh(); err != nil {
+				log.Printf("could not refresh the handle of session %v: %v", key, err)
+			}
+		}
+
+		return true
+	})
+}
+
 func newSession(w http.ResponseWriter, r *http.Request, pool *handlePool) *session {
 	uuid := uuid.New().String()
 
@@ -95,6 +136,11 @@ func newSessionWithUUID(w http.ResponseWriter, r *http.Request, pool *handlePool
 	http.SetCookie(w, cookie)
 	r.AddCookie(cookie)
 
+	return storeSession(pool, uuid)
+}
+
+// storeSession creates a session with a handle from the pool.
+func storeSession(pool *handlePool, uuid string) *session {
 	h := pool.Get()
 
 	s := &session{
@@ -107,6 +153,22 @@ func newSessionWithUUID(w http.ResponseWriter, r *http.Request, pool *handlePool
 	return s
 }
 
+// loadSession returns the session with the id `uuid` and extends its
+// lifetime. Expired sessions are not returned.
+func loadSession(uuid string) (*session, bool) {
+	ses, _ := sessions.Load(uuid)
+
+	s, ok := ses.(*session)
+
+	if !ok || time.Now().After(s.expiry) {
+		return nil, false
+	}
+
+	s.expiry = sessionExpiry()
+
+	return s, true
+}
+
 func sessionExpiry() time.Time {
 	return time.Now().Add(1 * time.Hour)
 }
@@ -135,5 +197,14 @@ func getHandle(r *http.Request) (elektra.KDB, elektra.KeySet) {
 
 	ses := s.(*session)
 
-	return ses.handle.kdb, ses.handle.keySet
+	// the context was validated and its handle opened by the middleware
+	ctx, _ := parseResolverContext(r)
+
+	h := ses.handle
+
+	if contextHandle, ok := ses.contexts[ctx]; ok {
+		h = contextHandle
+	}
+
+	return h.kdb, h.keySet
 }
@@ -11,6 +11,7 @@ import (
 // Arguments:
 // 		source	the source key. URL path param.
 //		target	the target key. JSON string POST body.
+//		recursive	move only the source key itself if `false`. Query param.
 //
 // Response Code:
 //		204 No Content if succesfull.
@@ -26,6 +27,13 @@ func (s *server) postMoveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	recursive, err := parseRecursive(r)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
 	fromKey, err := elektra.NewKey(from)
 
 	if err != nil {
@@ -44,51 +52,58 @@ func (s *server) postMoveHandler(w http.ResponseWriter, r *http.Request) {
 
 	defer toKey.Close()
 
+	handle, conf := getHandle(r)
+
+	if _, err = move(handle, conf, fromKey, toKey, recursive); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	noContent(w)
+}
+
+// move moves the key `fromKey` and, if `recursive` is set, all keys below it
+// to `toKey` and returns the count of moved keys.
+func move(handle elektra.KDB, conf elektra.KeySet, fromKey, toKey elektra.Key, recursive bool) (int, error) {
 	root := elektra.CommonKeyName(fromKey, toKey)
 
 	rootKey, err := elektra.NewKey(root)
 
 	if err != nil {
-		writeError(w, err) // this should not happen
-		return
+		return 0, err // this should not happen
 	}
 
 	defer rootKey.Close()
 
-	handle, conf := getHandle(r)
-
 	_, err = handle.Get(conf, rootKey)
 
 	if err != nil {
-		writeError(w, err)
-		return
+		return 0, err
 	}
 
-	oldConf := conf.Cut(fromKey)
+	oldConf := removeKeys(conf, fromKey, recursive)
 	defer oldConf.Close()
 
 	if oldConf.Len() < 1 {
-		noContent(w)
-		return
+		return 0, nil
 	}
 
 	newConf := elektra.NewKeySet()
 	defer newConf.Close()
 
 	for _, k := range oldConf.ToSlice() {
-		newConf.AppendKey(renameKey(k, from, to))
+		newConf.AppendKey(renameKey(k, fromKey.Name(), toKey.Name()))
 	}
 
 	newConf.Append(conf) // these are unrelated keys
 
-	err = set(handle, newConf, rootKey)
-
-	if err != nil {
-		writeError(w, err)
-		return
+	if err = set(handle, newConf, rootKey); err != nil {
+		// the moved keys are not lost for the next write
+		conf.Append(oldConf)
+		return 0, err
 	}
 
-	noContent(w)
+	return oldConf.Len(), nil
 }
 
 func renameKey(k elektra.Key, from, to string) elektra.Key {
@@ -21,3 +21,22 @@ func TestPostMove(t *testing.T) {
 	removeKey(t, keyNameTo)
 	Assert(t, key != nil, "key has not been moved")
 }
+
+func TestPostMoveSingleKey(t *testing.T) {
+	root := "user:/tests/elektrad/kdbmv/single"
+
+	removeTree(t, root)
+	defer removeTree(t, root)
+
+	setupKey(t, root+"/from", root+"/from/child")
+
+	w := testPost(t, "/kdbMv/"+root+"/from?recursive=false", root+"/to")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	Assert(t, getKey(t, root+"/to") != nil, "key has not been moved")
+	Assert(t, getKey(t, root+"/from") == nil, "the source key was not removed")
+	Assert(t, getKey(t, root+"/from/child") != nil, "child key has been moved")
+	Assert(t, getKey(t, root+"/to/child") == nil, "child key has been moved")
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	elektra "go.libelektra.org/kdb"
+)
+
+type namespaceResult struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Count     int    `json:"count"`
+}
+
+// getNamespacesHandler lists the namespaces that contain keys at or below
+// a path.
+//
+// Arguments:
+//		keyName		the path, its namespace is ignored. URL path param.
+//		cwd			the working directory used to resolve `dir:/`.
+//					Optional query parameter.
+//		home		the home directory used to resolve `user:/`.
+//					Optional query parameter.
+//
+// Response Code:
+//		200 OK if the request is successfull.
+//		400 Bad Request if the path is invalid.
+//
+// Returns: JSON array of `namespaceResult` structs in the order `spec`,
+// `proc`, `dir`, `user`, `system`, `default`.
+//
+// Example: `curl localhost:33333/namespaces/sw/org/app`
+func (s *server) getNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	path := "/" + strings.TrimPrefix(cascadingName(mux.Vars(r)["path"]), "/")
+
+	cascadingRoot, err := elektra.NewKey(path)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer cascadingRoot.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, cascadingRoot)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	results := []*namespaceResult{}
+
+	for _, namespace := range namespaces {
+		nsRoot, err := elektra.NewKey(withNamespace(path, namespace))
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		count := 0
+
+		ks.ForEach(func(k elektra.Key, _ int) {
+			if k.IsBelowOrSame(nsRoot) {
+				count++
+			}
+		})
+
+		if count > 0 {
+			results = append(results, &namespaceResult{
+				Namespace: namespace,
+				Name:      nsRoot.Name(),
+				Count:     count,
+			})
+		}
+
+		nsRoot.Close()
+	}
+
+	writeResponse(w, results)
+}
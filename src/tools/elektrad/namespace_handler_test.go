@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetNamespaces(t *testing.T) {
+	keyName := "user:/tests/elektrad/namespaces/get"
+
+	setupKey(t, keyName, keyName+"/child")
+
+	w := testGet(t, "/namespaces/tests/elektrad/namespaces/get")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var result []namespaceResult
+	parseBody(t, w, &result)
+
+	removeTree(t, keyName)
+
+	var user *namespaceResult
+
+	for i := range result {
+		if result[i].Namespace == "user" {
+			user = &result[i]
+		}
+	}
+
+	Assert(t, user != nil, "the user namespace is missing")
+	Assertf(t, user.Name == keyName, "wrong name %s", user.Name)
+	Assertf(t, user.Count == 2, "wrong count %d", user.Count)
+}
+
+func TestNamespaceScope(t *testing.T) {
+	keyName := "user:/tests/elektrad/namespaces/scope"
+
+	setupKey(t, keyName)
+
+	w := testGet(t, "/kdb/tests/elektrad/namespaces/scope?namespace=user")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var response lookupResult
+	parseBody(t, w, &response)
+
+	removeKey(t, keyName)
+
+	Assert(t, response.Exists, "key in the user namespace not found")
+	Assertf(t, response.Path == keyName, "wrong path %s", response.Path)
+
+	w = testGet(t, "/kdb/user:/tests?cwd=relative")
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusBadRequest, "wrong status code for relative cwd: %v", code)
+}
+
+func TestResolverContextDirectories(t *testing.T) {
+	home, err := ioutil.TempDir("", "elektrad-home")
+	Check(t, err, "could not create directory")
+	defer os.RemoveAll(home)
+
+	oldDirs := contextDirs
+	contextDirs = []string{home}
+	defer func() { contextDirs = oldDirs }()
+
+	outside, err := ioutil.TempDir("", "elektrad-outside")
+	Check(t, err, "could not create directory")
+	defer os.RemoveAll(outside)
+
+	link := filepath.Join(home, "link")
+	Check(t, os.Symlink(outside, link), "could not create link")
+
+	for _, dir := range []string{outside, link, home + "/../" + filepath.Base(outside)} {
+		for _, name := range []string{"cwd", "home"} {
+			w := testGet(t, "/kdb/user:/tests?"+name+"="+dir)
+
+			code := w.Result().StatusCode
+			Assertf(t, code == http.StatusBadRequest, "wrong status code for %s %s: %v", name, dir, code)
+		}
+	}
+
+	w := testGet(t, "/kdb/user:/tests?cwd="+home)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code for an allowed directory: %v", code)
+
+	// directories of other users, e.g. of a service account, can be allowed
+	contextDirs = []string{outside}
+
+	w = testGet(t, "/kdb/user:/tests?cwd="+link)
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code for a link to an allowed directory: %v", code)
+
+	contextDirs = nil
+
+	w = testGet(t, "/kdb/user:/tests?cwd="+outside)
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusBadRequest, "contexts must be disabled without -context-dirs: %v", code)
+}
+
+func TestResolverContextLimit(t *testing.T) {
+	home, err := ioutil.TempDir("", "elektrad-home")
+	Check(t, err, "could not create directory")
+	defer os.RemoveAll(home)
+
+	oldDirs := contextDirs
+	contextDirs = []string{home}
+	defer func() { contextDirs = oldDirs }()
+
+	cookie := testGet(t, "/kdb/user:/tests").Result().Cookies()
+
+	for i := 0; i <= maxSessionContexts; i++ {
+		dir := filepath.Join(home, fmt.Sprint(i))
+		Check(t, os.Mkdir(dir, 0700), "could not create directory")
+
+		header := http.Header{}
+
+		for _, c := range cookie {
+			header.Add("Cookie", c.String())
+		}
+
+		w := testHeaderRequest(t, "GET", "/kdb/user:/tests?cwd="+dir, header)
+
+		code := w.Result().StatusCode
+		expected := http.StatusOK
+
+		if i == maxSessionContexts {
+			expected = http.StatusBadRequest
+		}
+
+		Assertf(t, code == expected, "wrong status code for context %d: %v", i, code)
+	}
+}
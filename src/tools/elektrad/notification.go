@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ElektraInitiative/libelektra/elektrad/elektradpb"
+	"github.com/go-zeromq/zmq4"
+	"github.com/godbus/dbus/v5"
+	elektra "go.libelektra.org/kdb"
+)
+
+// The change types of Elektra's notifications, as sent by the `dbus` and
+// `zeromqsend` plugins.
+const (
+	notificationCommit     = "Commit"
+	notificationKeyAdded   = "KeyAdded"
+	notificationKeyChanged = "KeyChanged"
+	notificationKeyDeleted = "KeyDeleted"
+)
+
+const (
+	dbusPath      = "/org/libelektra/configuration"
+	dbusInterface = "org.libelektra"
+	// notificationQueueSize is the count of commits waiting to be published
+	notificationQueueSize = 100
+)
+
+// notifier is notified of commits and publishes the changed keys, nil if
+// notifications are disabled.
+var notifier *notificationPublisher
+
+// notificationTransport sends and receives notifications in the wire format
+// of an Elektra notification plugin.
+type notificationTransport interface {
+	publish(changeType, keyName string) error
+	// subscribe calls `notify` for received notifications until the
+	// transport is closed.
+	subscribe(notify func(changeType, keyName string)) error
+	close() error
+}
+
+// notificationPublisher publishes `KeyAdded`, `KeyChanged` and `KeyDeleted`
+// notifications for the changed keys of a commit, followed by a `Commit`
+// notification of the parent key of the commit.
+type notificationPublisher struct {
+	// handle contains the keys as they were published last
+	handle     *handle
+	transports []notificationTransport
+	commits    chan string
+}
+
+func newNotificationPublisher(transports []notificationTransport) (*notificationPublisher, error) {
+	h, err := newHandle()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &notificationPublisher{
+		handle:     h,
+		transports: transports,
+		commits:    make(chan string, notificationQueueSize),
+	}, nil
+}
+
+// committed queues the publication of the changes below `keyName`, it does
+// not block.
+func (p *notificationPublisher) committed(keyName string) {
+	select {
+	case p.commits <- keyName:
+	default:
+		log.Printf("notifications: dropped the notifications of %s, too many commits are waiting", keyName)
+	}
+}
+
+// run publishes the queued commits.
+func (p *notificationPublisher) run() {
+	for keyName := range p.commits {
+		if err := p.publishCommit(keyName); err != nil {
+			log.Printf("notifications: could not publish the changes of %s: %v", keyName, err)
+		}
+	}
+}
+
+func (p *notificationPublisher) publishCommit(keyName string) error {
+	key, err := elektra.NewKey(keyName)
+
+	if err != nil {
+		return err
+	}
+
+	defer key.Close()
+
+	before := keysBelow(p.handle.keySet, key)
+
+	after, err := snapshot(p.handle, key)
+
+	if err != nil {
+		return err
+	}
+
+	events := changes(before, after)
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key.Name < events[j].Key.Name
+	})
+
+	for _, event := range events {
+		p.publish(notificationType(event.Type), event.Key.Name)
+	}
+
+	p.publish(notificationCommit, keyName)
+
+	return nil
+}
+
+func (p *notificationPublisher) publish(changeType, keyName string) {
+	for _, t := range p.transports {
+		if err := t.publish(changeType, keyName); err != nil {
+			log.Printf("notifications: could not publish %s %s: %v", changeType, keyName, err)
+		}
+	}
+}
+
+func notificationType(t elektradpb.WatchEvent_Type) string {
+	switch t {
+	case elektradpb.WatchEvent_CREATED:
+		return notificationKeyAdded
+	case elektradpb.WatchEvent_DELETED:
+		return notificationKeyDeleted
+	}
+
+	return notificationKeyChanged
+}
+
+// notificationSubscriber invalidates cached keys when notifications of
+// other processes are received.
+type notificationSubscriber struct {
+	mut       sync.Mutex
+	listeners []func(keyName string)
+}
+
+// listen registers a function called with the key name of every received
+// notification.
+func (s *notificationSubscriber) listen(listener func(keyName string)) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.listeners = append(s.listeners, listener)
+}
+
+func (s *notificationSubscriber) notify(changeType, keyName string) {
+	s.mut.Lock()
+	listeners := s.listeners
+	s.mut.Unlock()
+
+	for _, listener := range listeners {
+		listener(keyName)
+	}
+}
+
+// subscribe receives the notifications of a transport until it is closed.
+func (s *notificationSubscriber) subscribe(t notificationTransport) {
+	if err := t.subscribe(s.notify); err != nil {
+		log.Printf("notifications: stopped receiving notifications: %v", err)
+	}
+}
+
+// zeroMQTransport sends notifications like the `zeromqsend` plugin to the
+// XSUB socket of a hub and receives notifications like the `zeromqrecv`
+// plugin from the XPUB socket of a hub. Each notification is a multipart
+// message with the change type and the key name, both null terminated.
+type zeroMQTransport struct {
+	mut sync.Mutex
+	pub zmq4.Socket
+	sub zmq4.Socket
+}
+
+// newZeroMQTransport connects to the endpoints of a hub, an empty endpoint
+// disables publishing or subscribing.
+func newZeroMQTransport(pubEndpoint, subEndpoint string) (*zeroMQTransport, error) {
+	t := &zeroMQTransport{}
+
+	if pubEndpoint != "" {
+		t.pub = zmq4.NewPub(context.Background())
+
+		if err := t.pub.Dial(pubEndpoint); err != nil {
+			t.close()
+			return nil, fmt.Errorf("could not connect to %s: %v", pubEndpoint, err)
+		}
+	}
+
+	if subEndpoint != "" {
+		t.sub = zmq4.NewSub(context.Background())
+
+		if err := t.sub.Dial(subEndpoint); err != nil {
+			t.close()
+			return nil, fmt.Errorf("could not connect to %s: %v", subEndpoint, err)
+		}
+
+		if err := t.sub.SetOption(zmq4.OptionSubscribe, ""); err != nil {
+			t.close()
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+func (t *zeroMQTransport) publish(changeType, keyName string) error {
+	if t.pub == nil {
+		return nil
+	}
+
+	t.mut.Lock()
+	defer t.mut.Unlock()
+
+	return t.pub.SendMulti(zmq4.NewMsgFrom([]byte(changeType+"\x00"), []byte(keyName+"\x00")))
+}
+
+func (t *zeroMQTransport) subscribe(notify func(changeType, keyName string)) error {
+	if t.sub == nil {
+		return nil
+	}
+
+	for {
+		msg, err := t.sub.Recv()
+
+		if err != nil {
+			return err
+		}
+
+		if len(msg.Frames) != 2 {
+			continue
+		}
+
+		notify(strings.TrimSuffix(string(msg.Frames[0]), "\x00"), strings.TrimSuffix(string(msg.Frames[1]), "\x00"))
+	}
+}
+
+func (t *zeroMQTransport) close() error {
+	var err error
+
+	if t.pub != nil {
+		err = t.pub.Close()
+	}
+
+	if t.sub != nil {
+		if subErr := t.sub.Close(); err == nil {
+			err = subErr
+		}
+	}
+
+	return err
+}
+
+// dbusTransport sends and receives notifications like the `dbus` and
+// `dbusrecv` plugins: signals of the interface `org.libelektra` on the
+// object `/org/libelektra/configuration`, named after the change type, with
+// the key name as only argument.
+type dbusTransport struct {
+	conn *dbus.Conn
+}
+
+// newDBusTransport connects to the `session` or `system` bus.
+func newDBusTransport(bus string) (*dbusTransport, error) {
+	var conn *dbus.Conn
+	var err error
+
+	switch bus {
+	case "session":
+		conn, err = dbus.SessionBusPrivate()
+	case "system":
+		conn, err = dbus.SystemBusPrivate()
+	default:
+		return nil, errors.New("the D-Bus bus must be session or system")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = conn.Auth(nil); err == nil {
+		err = conn.Hello()
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &dbusTransport{conn: conn}, nil
+}
+
+func (t *dbusTransport) publish(changeType, keyName string) error {
+	return t.conn.Emit(dbusPath, dbusInterface+"."+changeType, keyName)
+}
+
+func (t *dbusTransport) subscribe(notify func(changeType, keyName string)) error {
+	err := t.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(dbusPath),
+		dbus.WithMatchInterface(dbusInterface),
+	)
+
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan *dbus.Signal, notificationQueueSize)
+	t.conn.Signal(signals)
+
+	own := t.conn.Names()[0]
+
+	for signal := range signals {
+		// skip the notifications of this process
+		if signal.Sender == own || len(signal.Body) != 1 {
+			continue
+		}
+
+		keyName, ok := signal.Body[0].(string)
+
+		if !ok {
+			continue
+		}
+
+		notify(strings.TrimPrefix(signal.Name, dbusInterface+"."), keyName)
+	}
+
+	return errors.New("the D-Bus connection was closed")
+}
+
+func (t *dbusTransport) close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+type testNotification struct {
+	changeType string
+	keyName    string
+}
+
+// testTransport records the published notifications.
+type testTransport struct {
+	published []testNotification
+}
+
+func (t *testTransport) publish(changeType, keyName string) error {
+	t.published = append(t.published, testNotification{changeType, keyName})
+	return nil
+}
+
+func (t *testTransport) subscribe(notify func(changeType, keyName string)) error {
+	return nil
+}
+
+func (t *testTransport) close() error {
+	return nil
+}
+
+func TestNotificationPublisher(t *testing.T) {
+	root := "user:/tests/elektrad/notification"
+
+	removeTree(t, root)
+	defer removeTree(t, root)
+
+	transport := &testTransport{}
+
+	p, err := newNotificationPublisher([]notificationTransport{transport})
+	Check(t, err, "could not create publisher")
+
+	setupKey(t, root+"/a", root+"/b")
+
+	err = p.publishCommit(root)
+	Check(t, err, "could not publish")
+
+	expected := []testNotification{
+		{notificationKeyAdded, root + "/a"},
+		{notificationKeyAdded, root + "/b"},
+		{notificationCommit, root},
+	}
+
+	Assertf(t, len(transport.published) == len(expected), "wrong notifications %v", transport.published)
+
+	for i, n := range expected {
+		Assertf(t, transport.published[i] == n, "wrong notification %v, expected %v", transport.published[i], n)
+	}
+
+	transport.published = nil
+
+	removeKey(t, root+"/a")
+
+	err = p.publishCommit(root)
+	Check(t, err, "could not publish")
+
+	Assertf(t, len(transport.published) == 2, "wrong notifications %v", transport.published)
+	Assertf(t, transport.published[0] == testNotification{notificationKeyDeleted, root + "/a"}, "wrong notification %v", transport.published[0])
+}
+
+func TestZeroMQTransport(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the hub
+	xsub := zmq4.NewSub(ctx)
+	defer xsub.Close()
+
+	err := xsub.Listen("tcp://127.0.0.1:0")
+	Check(t, err, "could not listen")
+
+	xpub := zmq4.NewPub(ctx)
+	defer xpub.Close()
+
+	err = xpub.Listen("tcp://127.0.0.1:0")
+	Check(t, err, "could not listen")
+
+	transport, err := newZeroMQTransport("tcp://"+xsub.Addr().String(), "tcp://"+xpub.Addr().String())
+	Check(t, err, "could not connect")
+	defer transport.close()
+
+	// subscriptions are only sent to connected peers
+	err = xsub.SetOption(zmq4.OptionSubscribe, "")
+	Check(t, err, "could not subscribe")
+
+	received := make(chan testNotification, 100)
+
+	go transport.subscribe(func(changeType, keyName string) {
+		received <- testNotification{changeType, keyName}
+	})
+
+	// retry until the connections are established
+	go func() {
+		for ctx.Err() == nil {
+			transport.publish(notificationCommit, "user:/published")
+			xpub.SendMulti(zmq4.NewMsgFrom([]byte("KeyChanged\x00"), []byte("user:/received\x00")))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	msg, err := xsub.Recv()
+	Check(t, err, "could not receive the notification")
+	Assertf(t, len(msg.Frames) == 2, "expected 2 frames, got %d", len(msg.Frames))
+	Assertf(t, string(msg.Frames[0]) == "Commit\x00", "wrong change type %q", msg.Frames[0])
+	Assertf(t, string(msg.Frames[1]) == "user:/published\x00", "wrong key name %q", msg.Frames[1])
+
+	select {
+	case n := <-received:
+		Assertf(t, n == testNotification{notificationKeyChanged, "user:/received"}, "wrong notification %v", n)
+	case <-ctx.Done():
+		t.Fatal("no notification received")
+	}
+}
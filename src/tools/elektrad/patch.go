@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errPatchTestFailed = errors.New("test operation failed")
+
+// patchOperation is a single operation of a JSON Patch (RFC 6902).
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// mergePatch applies a JSON Merge Patch (RFC 7386) to `target`.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = mergePatch(targetObject[name], value)
+		}
+	}
+
+	return targetObject
+}
+
+// applyJSONPatch applies the operations of a JSON Patch (RFC 6902) to
+// `doc`. If a `test` operation fails `errPatchTestFailed` is returned.
+func applyJSONPatch(doc interface{}, operations []patchOperation) (interface{}, error) {
+	for i, op := range operations {
+		var err error
+
+		doc, err = applyPatchOperation(doc, op)
+
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	return doc, nil
+}
+
+func applyPatchOperation(doc interface{}, op patchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		value, err := decodeJSON(op.Value)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.Op {
+		case "add":
+			return pointerAdd(doc, path, value)
+		case "replace":
+			// replacing the root replaces the whole document
+			if len(path) == 0 {
+				return value, nil
+			}
+
+			if doc, _, err = pointerRemove(doc, path); err != nil {
+				return nil, err
+			}
+
+			return pointerAdd(doc, path, value)
+		default:
+			current, err := pointerGet(doc, path)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if !jsonEqual(current, value) {
+				return nil, errPatchTestFailed
+			}
+
+			return doc, nil
+		}
+
+	case "remove":
+		doc, _, err = pointerRemove(doc, path)
+
+		return doc, err
+
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{}
+
+		if op.Op == "move" {
+			if isPointerPrefix(from, path) && len(from) < len(path) {
+				return nil, errors.New("a value can not be moved into one of its children")
+			}
+
+			doc, value, err = pointerRemove(doc, from)
+		} else {
+			if value, err = pointerGet(doc, from); err == nil {
+				value, err = copyJSON(value)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		return pointerAdd(doc, path, value)
+
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// parseJSONPointer splits a JSON Pointer (RFC 6901) into its unescaped
+// reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+func isPointerPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			value, ok := d[token]
+
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+
+			doc = value
+		case []interface{}:
+			i, err := pointerIndex(token, len(d)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			doc = d[i]
+		default:
+			return nil, fmt.Errorf("can not resolve %q in a scalar value", token)
+		}
+	}
+
+	return doc, nil
+}
+
+// pointerUpdate calls `update` with the parent of the value `path` points
+// to and replaces the parent with the result.
+func pointerUpdate(doc interface{}, path []string, update func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return update(doc, path[0])
+	}
+
+	token := path[0]
+
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		child, ok := d[token]
+
+		if !ok {
+			return nil, fmt.Errorf("member %q does not exist", token)
+		}
+
+		child, err := pointerUpdate(child, path[1:], update)
+
+		if err != nil {
+			return nil, err
+		}
+
+		d[token] = child
+
+		return d, nil
+	case []interface{}:
+		i, err := pointerIndex(token, len(d)-1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		child, err := pointerUpdate(d[i], path[1:], update)
+
+		if err != nil {
+			return nil, err
+		}
+
+		d[i] = child
+
+		return d, nil
+	default:
+		return nil, fmt.Errorf("can not resolve %q in a scalar value", token)
+	}
+}
+
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return pointerUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[token] = value
+
+			return p, nil
+		case []interface{}:
+			if token == "-" {
+				return append(p, value), nil
+			}
+
+			i, err := pointerIndex(token, len(p))
+
+			if err != nil {
+				return nil, err
+			}
+
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+
+			return p, nil
+		default:
+			return nil, fmt.Errorf("can not add %q to a scalar value", token)
+		}
+	})
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("the root can not be removed")
+	}
+
+	var removed interface{}
+
+	doc, err := pointerUpdate(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			value, ok := p[token]
+
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+
+			removed = value
+			delete(p, token)
+
+			return p, nil
+		case []interface{}:
+			i, err := pointerIndex(token, len(p)-1)
+
+			if err != nil {
+				return nil, err
+			}
+
+			removed = p[i]
+
+			return append(p[:i], p[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("can not remove %q from a scalar value", token)
+		}
+	})
+
+	return doc, removed, err
+}
+
+// pointerIndex parses an array index of a JSON Pointer that must not be
+// greater than `max`.
+func pointerIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	i, err := strconv.Atoi(token)
+
+	if err != nil || i < 0 || i > max {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+
+	return i, nil
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, errors.New("missing value")
+	}
+
+	var value interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// copyJSON returns a deep copy of a JSON value, numbers are converted to
+// `json.Number`.
+func copyJSON(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeJSON(data)
+}
+
+func jsonEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for name, value := range x {
+			other, ok := y[name]
+
+			if !ok || !jsonEqual(value, other) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+
+		if !ok || len(x) != len(y) {
+			return false
+		}
+
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+
+		if !ok {
+			return false
+		}
+
+		if x == y {
+			return true
+		}
+
+		f1, err1 := x.Float64()
+		f2, err2 := y.Float64()
+
+		return err1 == nil && err2 == nil && f1 == f2
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+// patchKdbHandler updates a subtree with a JSON Merge Patch (RFC 7386) or
+// a JSON Patch (RFC 6902). The patch is applied to the nested JSON view of
+// the subtree, as returned by `getTreeHandler`. Metadata of keys that still
+// exist after the patch is kept, binary keys stay binary and their values are
+// base64 encoded.
+//
+// Arguments:
+//		keyName		the name of the root key. URL path param.
+//		patch		the patch, its format is determined by the Content-Type
+//					header (`application/merge-patch+json` or
+//					`application/json-patch+json`). PATCH body.
+//		typed		if `true` the patch is applied to typed values. Optional
+//					query parameter (bool).
+//
+// Response Code:
+//		204 No Content if the patch was applied.
+//		400 Bad Request if the key name or patch is invalid.
+//		409 Conflict if a `test` operation failed.
+//		415 Unsupported Media Type if the Content-Type is not supported.
+//
+// Example: `curl -X PATCH -H 'Content-Type: application/merge-patch+json' -d '{ "port": "80" }' localhost:33333/kdb/user/test`
+func (s *server) patchKdbHandler(w http.ResponseWriter, r *http.Request) {
+	contentType := mediaType(r.Header.Get("Content-Type"))
+
+	if contentType != "application/merge-patch+json" && contentType != "application/json-patch+json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var mergePatchBody interface{}
+	var jsonPatchBody []patchOperation
+	var err error
+
+	if contentType == "application/merge-patch+json" {
+		mergePatchBody, err = jsonBody(r)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&jsonPatchBody)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	keyName := parseKeyNameFromURL(r)
+
+	root, err := elektra.NewKey(keyName)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer root.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, root)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	dup := ks.Duplicate()
+	defer dup.Close()
+
+	subtree := dup.Cut(root)
+	defer subtree.Close()
+
+	doc, err := copyJSON(buildTree(root, subtree, treeOptions{typed: parseTyped(r)}))
+
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+
+	if contentType == "application/merge-patch+json" {
+		doc = mergePatch(doc, mergePatchBody)
+	} else {
+		doc, err = applyJSONPatch(doc, jsonPatchBody)
+	}
+
+	if errors.Is(err, errPatchTestFailed) {
+		writeErrorCode(w, http.StatusConflict, err)
+		return
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	err = writeTree(handle, ks, root, doc, treeUpdate)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	noContent(w)
+}
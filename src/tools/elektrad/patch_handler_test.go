@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestPatchKdbMergePatch(t *testing.T) {
+	root := "user:/tests/elektrad/kdbpatch/merge"
+	description := "the port"
+
+	setupKey(t, root+"/remove")
+	setupKeyWithMeta(t, root+"/port", keyValueBody{Key: "description", Value: &description})
+
+	w := testRawRequest(t, "PATCH", "/kdb/"+root, "application/merge-patch+json", []byte(`{"port":"80","remove":null}`))
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	port := getKey(t, root+"/port")
+	removed := getKey(t, root+"/remove")
+
+	removeTree(t, root)
+
+	Assert(t, port != nil && port.String() == "80", "port was not updated")
+	Assert(t, port.Meta("description") == description, "metadata was not kept")
+	Assert(t, removed == nil, "key was not removed")
+}
+
+func TestPatchKdbJSONPatch(t *testing.T) {
+	root := "user:/tests/elektrad/kdbpatch/json"
+
+	w := testPut(t, "/kdbTree/"+root, map[string]interface{}{
+		"hosts": []string{"a", "c"},
+	})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	w = testRawRequest(t, "PATCH", "/kdb/"+root, "application/json-patch+json", []byte(`[
+		{"op": "test", "path": "/hosts/1", "value": "wrong"},
+		{"op": "add", "path": "/hosts/1", "value": "b"}
+	]`))
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusConflict, "wrong status code: %v", code)
+
+	w = testRawRequest(t, "PATCH", "/kdb/"+root, "application/json-patch+json", []byte(`[
+		{"op": "test", "path": "/hosts/1", "value": "c"},
+		{"op": "add", "path": "/hosts/1", "value": "b"}
+	]`))
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	hosts := getKey(t, root+"/hosts")
+	host := getKey(t, root+"/hosts/#2")
+
+	removeTree(t, root)
+
+	Assert(t, hosts != nil && hosts.Meta("array") == "#2", "array metadata is wrong")
+	Assert(t, host != nil && host.String() == "c", "array was not renumbered")
+}
+
+func TestPatchKdbKeepsBinaryKeys(t *testing.T) {
+	root := "user:/tests/elektrad/kdbpatch/binary"
+
+	removeTree(t, root)
+	defer removeTree(t, root)
+
+	w := testPut(t, "/kdb/"+root+"/bin?binary=true", "/wAB")
+	Assertf(t, w.Code == http.StatusCreated, "could not create binary key: %v", w.Code)
+
+	setupKey(t, root+"/str")
+
+	w = testRawRequest(t, "PATCH", "/kdb/"+root, "application/merge-patch+json", []byte(`{"str":"y"}`))
+	Assertf(t, w.Code == http.StatusNoContent, "wrong status code: %v", w.Code)
+
+	w = testRawRequest(t, "PATCH", "/kdb/"+root, "application/json-patch+json", []byte(`[
+		{"op": "replace", "path": "", "value": {"bin": "/wAB", "str": "z"}}
+	]`))
+	Assertf(t, w.Code == http.StatusNoContent, "wrong status code: %v", w.Code)
+
+	bin := getKey(t, root+"/bin")
+	str := getKey(t, root+"/str")
+
+	Assert(t, bin != nil && isBinary(bin), "binary key is not binary")
+	Assertf(t, bytes.Equal(bin.Bytes(), []byte{0xff, 0x00, 0x01}), "wrong binary value %v", bin.Bytes())
+	Assertf(t, str != nil && str.String() == "z", "string key was not updated")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func mustDecodeJSON(t *testing.T, s string) interface{} {
+	t.Helper()
+
+	value, err := decodeJSON([]byte(s))
+	Checkf(t, err, "could not decode %s: %v", s, err)
+
+	return value
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`"a"`, `{"b":"c"}`, `{"b":"c"}`},
+	}
+
+	for _, test := range tests {
+		result := mergePatch(mustDecodeJSON(t, test.target), mustDecodeJSON(t, test.patch))
+
+		Assertf(t, jsonEqual(result, mustDecodeJSON(t, test.expected)), "%s + %s: unexpected result %v", test.target, test.patch, result)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, expected string
+	}{
+		{`{"a":"b"}`, `[{"op":"add","path":"/c","value":"d"}]`, `{"a":"b","c":"d"}`},
+		{`{"a":["b","c"]}`, `[{"op":"add","path":"/a/1","value":"x"}]`, `{"a":["b","x","c"]}`},
+		{`{"a":["b"]}`, `[{"op":"add","path":"/a/-","value":"c"}]`, `{"a":["b","c"]}`},
+		{`{"a":"b","c":"d"}`, `[{"op":"remove","path":"/a"}]`, `{"c":"d"}`},
+		{`{"a":"b"}`, `[{"op":"replace","path":"/a","value":"c"}]`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `[{"op":"move","from":"/a/b","path":"/d"}]`, `{"a":{},"d":"c"}`},
+		{`{"a":["b"]}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":["b"],"c":["b"]}`},
+		{`{"a/b":"c"}`, `[{"op":"test","path":"/a~1b","value":"c"},{"op":"remove","path":"/a~1b"}]`, `{}`},
+		{`{"a":1}`, `[{"op":"test","path":"/a","value":1.0}]`, `{"a":1}`},
+		{`{"a":"b"}`, `[{"op":"replace","path":"","value":{"c":"d"}}]`, `{"c":"d"}`},
+	}
+
+	for _, test := range tests {
+		var ops []patchOperation
+		Check(t, json.Unmarshal([]byte(test.patch), &ops), "could not decode patch")
+
+		result, err := applyJSONPatch(mustDecodeJSON(t, test.doc), ops)
+		Checkf(t, err, "%s + %s: %v", test.doc, test.patch, err)
+
+		Assertf(t, jsonEqual(result, mustDecodeJSON(t, test.expected)), "%s + %s: unexpected result %v", test.doc, test.patch, result)
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	tests := []string{
+		`[{"op":"remove","path":"/x"}]`,
+		`[{"op":"replace","path":"/x","value":1}]`,
+		`[{"op":"add","path":"/a/5","value":1}]`,
+		`[{"op":"move","from":"/a","path":"/a/0"}]`,
+		`[{"op":"unknown","path":"/a"}]`,
+		`[{"op":"add","path":"a","value":1}]`,
+	}
+
+	for _, patch := range tests {
+		var ops []patchOperation
+		Check(t, json.Unmarshal([]byte(patch), &ops), "could not decode patch")
+
+		_, err := applyJSONPatch(mustDecodeJSON(t, `{"a":["b"]}`), ops)
+		Assertf(t, err != nil, "%s should fail", patch)
+	}
+
+	var ops []patchOperation
+	Check(t, json.Unmarshal([]byte(`[{"op":"test","path":"/a","value":"c"}]`), &ops), "could not decode patch")
+
+	_, err := applyJSONPatch(mustDecodeJSON(t, `{"a":"b"}`), ops)
+	Assert(t, errors.Is(err, errPatchTestFailed), "test operation should fail")
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+// keyQuery is a parsed query of the form
+//
+//		[select <field>, ...] [below <key>] [where <condition>]
+//		[order by <field> [asc|desc]] [limit <n>]
+//
+// Fields are `name`, `basename`, `value`, `meta` (only in `select`) and
+// `meta.<name>`.
+type keyQuery struct {
+	fields     []string
+	below      string
+	where      queryCondition
+	orderBy    string
+	descending bool
+	limit      int
+}
+
+// queryCondition is a node of the `where` expression tree.
+type queryCondition interface {
+	eval(key elektra.Key) bool
+}
+
+type queryAnd struct{ left, right queryCondition }
+type queryOr struct{ left, right queryCondition }
+type queryNot struct{ condition queryCondition }
+
+// queryExists is true if the operand is a field that is set.
+type queryExists struct{ operand queryOperand }
+
+type queryComparison struct {
+	left, right queryOperand
+	op          string
+	regex       *regexp.Regexp
+}
+
+// queryOperand is either a field of a key or a literal.
+type queryOperand struct {
+	field   string
+	literal string
+	// quoted is true for string literals, they are never compared as numbers
+	quoted bool
+}
+
+type queryToken struct {
+	kind  queryTokenKind
+	value string
+}
+
+type queryTokenKind int
+
+const (
+	queryWord queryTokenKind = iota
+	queryString
+	querySymbol
+	queryEnd
+)
+
+var queryOperators = []string{"==", "!=", "<=", ">=", "=~", "!~", "<", ">", "(", ")", ","}
+
+func (c *queryAnd) eval(key elektra.Key) bool { return c.left.eval(key) && c.right.eval(key) }
+func (c *queryOr) eval(key elektra.Key) bool  { return c.left.eval(key) || c.right.eval(key) }
+func (c *queryNot) eval(key elektra.Key) bool { return !c.condition.eval(key) }
+
+func (c *queryExists) eval(key elektra.Key) bool {
+	_, ok := c.operand.value(key)
+	return ok
+}
+
+func (c *queryComparison) eval(key elektra.Key) bool {
+	left, ok := c.left.value(key)
+
+	if !ok {
+		return c.op == "!=" || c.op == "!~"
+	}
+
+	if c.regex != nil {
+		return c.regex.MatchString(left) == (c.op == "=~")
+	}
+
+	right, ok := c.right.value(key)
+
+	if !ok {
+		return c.op == "!="
+	}
+
+	var cmp int
+
+	if c.left.quoted || c.right.quoted {
+		cmp = strings.Compare(left, right)
+	} else {
+		cmp = compareQueryValues(left, right)
+	}
+
+	switch c.op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// value returns the value of the operand for `key` and whether it is set.
+func (o queryOperand) value(key elektra.Key) (string, bool) {
+	switch {
+	case o.field == "":
+		return o.literal, true
+	case o.field == "name":
+		return key.Name(), true
+	case o.field == "basename":
+		return key.BaseName(), true
+	case o.field == "value":
+		if isBinary(key) {
+			return "", false
+		}
+
+		return key.String(), true
+	default:
+		metaName := strings.TrimPrefix(o.field, "meta.")
+
+		if !hasMeta(key, metaName) {
+			return "", false
+		}
+
+		return key.Meta(metaName), true
+	}
+}
+
+// compareQueryValues compares numerically if both values are numbers and
+// lexically otherwise.
+func compareQueryValues(a, b string) int {
+	x, errA := strconv.ParseFloat(a, 64)
+	y, errB := strconv.ParseFloat(b, 64)
+
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// run evaluates the query on the keys of `ks`.
+func (q *keyQuery) run(ks elektra.KeySet, root elektra.Key) []elektra.Key {
+	var keys []elektra.Key
+
+	for _, key := range ks.ToSlice() {
+		if key.IsBelowOrSame(root) && (q.where == nil || q.where.eval(key)) {
+			keys = append(keys, key)
+		}
+	}
+
+	if q.orderBy != "" {
+		field := queryOperand{field: q.orderBy}
+
+		sort.SliceStable(keys, func(i, j int) bool {
+			a, okA := field.value(keys[i])
+			b, okB := field.value(keys[j])
+
+			if !okA || !okB {
+				// keys without the field are sorted last
+				return okA && !okB
+			}
+
+			if q.descending {
+				return compareQueryValues(a, b) > 0
+			}
+
+			return compareQueryValues(a, b) < 0
+		})
+	}
+
+	if q.limit > 0 && len(keys) > q.limit {
+		keys = keys[:q.limit]
+	}
+
+	return keys
+}
+
+// selects returns true if `field` is part of the result. Without `select`
+// the name, value and metadata are returned.
+func (q *keyQuery) selects(field string) bool {
+	if len(q.fields) == 0 {
+		return field != "basename"
+	}
+
+	for _, f := range q.fields {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseQuery parses a query, see `keyQuery` for the syntax.
+func parseQuery(query string) (*keyQuery, error) {
+	tokens, err := tokenizeQuery(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens}
+
+	q := &keyQuery{
+		below: "/",
+	}
+
+	if p.keyword("select") {
+		for {
+			field, err := p.field()
+
+			if err != nil {
+				return nil, err
+			}
+
+			if field != "meta" && strings.HasPrefix(field, "meta.") {
+				return nil, fmt.Errorf("only `meta` can be selected, not %q", field)
+			}
+
+			q.fields = append(q.fields, field)
+
+			if !p.symbol(",") {
+				break
+			}
+		}
+	}
+
+	if p.keyword("below") {
+		t := p.next()
+
+		if t.kind != queryWord && t.kind != queryString {
+			return nil, fmt.Errorf("expected a key name after `below`")
+		}
+
+		q.below = t.value
+	}
+
+	if p.keyword("where") {
+		if q.where, err = p.or(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.keyword("order") {
+		if !p.keyword("by") {
+			return nil, fmt.Errorf("expected `by` after `order`")
+		}
+
+		if q.orderBy, err = p.field(); err != nil {
+			return nil, err
+		}
+
+		if q.orderBy == "meta" {
+			return nil, fmt.Errorf("can not order by `meta`")
+		}
+
+		if p.keyword("desc") {
+			q.descending = true
+		} else {
+			p.keyword("asc")
+		}
+	}
+
+	if p.keyword("limit") {
+		t := p.next()
+
+		if q.limit, err = strconv.Atoi(t.value); t.kind != queryWord || err != nil || q.limit < 1 {
+			return nil, fmt.Errorf("invalid limit %q", t.value)
+		}
+	}
+
+	if t := p.peek(); t.kind != queryEnd {
+		return nil, fmt.Errorf("unexpected %q", t.value)
+	}
+
+	return q, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	if p.pos >= len(p.tokens) {
+		return queryToken{kind: queryEnd}
+	}
+
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	t := p.peek()
+
+	if t.kind != queryEnd {
+		p.pos++
+	}
+
+	return t
+}
+
+// keyword consumes the next token if it is the keyword `word`.
+func (p *queryParser) keyword(word string) bool {
+	if t := p.peek(); t.kind == queryWord && strings.EqualFold(t.value, word) {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+// symbol consumes the next token if it is the symbol `s`.
+func (p *queryParser) symbol(s string) bool {
+	if t := p.peek(); t.kind == querySymbol && t.value == s {
+		p.pos++
+		return true
+	}
+
+	return false
+}
+
+func (p *queryParser) field() (string, error) {
+	t := p.next()
+
+	if t.kind == queryWord && isQueryField(t.value) {
+		return t.value, nil
+	}
+
+	return "", fmt.Errorf("expected a field but got %q", t.value)
+}
+
+func (p *queryParser) or() (queryCondition, error) {
+	left, err := p.and()
+
+	for err == nil && p.keyword("or") {
+		var right queryCondition
+
+		if right, err = p.and(); err == nil {
+			left = &queryOr{left, right}
+		}
+	}
+
+	return left, err
+}
+
+func (p *queryParser) and() (queryCondition, error) {
+	left, err := p.not()
+
+	for err == nil && p.keyword("and") {
+		var right queryCondition
+
+		if right, err = p.not(); err == nil {
+			left = &queryAnd{left, right}
+		}
+	}
+
+	return left, err
+}
+
+func (p *queryParser) not() (queryCondition, error) {
+	if p.keyword("not") {
+		condition, err := p.not()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &queryNot{condition}, nil
+	}
+
+	return p.primary()
+}
+
+func (p *queryParser) primary() (queryCondition, error) {
+	if p.symbol("(") {
+		condition, err := p.or()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.symbol(")") {
+			return nil, fmt.Errorf("expected `)`")
+		}
+
+		return condition, nil
+	}
+
+	left, err := p.operand()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.keyword("exists") {
+		return &queryExists{left}, nil
+	}
+
+	t := p.next()
+
+	if t.kind != querySymbol || t.value == "(" || t.value == ")" || t.value == "," {
+		return nil, fmt.Errorf("expected an operator but got %q", t.value)
+	}
+
+	right, err := p.operand()
+
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &queryComparison{
+		left:  left,
+		right: right,
+		op:    t.value,
+	}
+
+	if t.value == "=~" || t.value == "!~" {
+		if right.field != "" {
+			return nil, fmt.Errorf("the right side of %s must be a regular expression", t.value)
+		}
+
+		if comparison.regex, err = regexp.Compile(right.literal); err != nil {
+			return nil, err
+		}
+	}
+
+	return comparison, nil
+}
+
+func (p *queryParser) operand() (queryOperand, error) {
+	t := p.next()
+
+	switch {
+	case t.kind == queryString:
+		return queryOperand{literal: t.value, quoted: true}, nil
+	case t.kind == queryWord && isQueryField(t.value) && t.value != "meta":
+		return queryOperand{field: t.value}, nil
+	case t.kind == queryWord:
+		if _, err := strconv.ParseFloat(t.value, 64); err == nil {
+			return queryOperand{literal: t.value}, nil
+		}
+	}
+
+	return queryOperand{}, fmt.Errorf("expected a field, string or number but got %q", t.value)
+}
+
+func isQueryField(word string) bool {
+	switch word {
+	case "name", "basename", "value", "meta":
+		return true
+	}
+
+	return strings.HasPrefix(word, "meta.") && len(word) > len("meta.")
+}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+
+		case c == '"' || c == '\'':
+			end := i + 1
+
+			for end < len(query) && query[end] != c {
+				if query[end] == '\\' {
+					end++
+				}
+
+				end++
+			}
+
+			if end >= len(query) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+
+			value := query[i+1 : end]
+
+			if c == '"' {
+				var err error
+
+				if value, err = strconv.Unquote(query[i : end+1]); err != nil {
+					return nil, fmt.Errorf("invalid string at position %d", i)
+				}
+			}
+
+			tokens = append(tokens, queryToken{kind: queryString, value: value})
+			i = end + 1
+
+		default:
+			if op := queryOperatorAt(query[i:]); op != "" {
+				tokens = append(tokens, queryToken{kind: querySymbol, value: op})
+				i += len(op)
+				continue
+			}
+
+			end := i
+
+			for end < len(query) && !unicode.IsSpace(rune(query[end])) && queryOperatorAt(query[end:]) == "" && query[end] != '"' && query[end] != '\'' {
+				end++
+			}
+
+			if end == i {
+				return nil, fmt.Errorf("unexpected %q at position %d", c, i)
+			}
+
+			tokens = append(tokens, queryToken{kind: queryWord, value: query[i:end]})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+func queryOperatorAt(s string) string {
+	for _, op := range queryOperators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+// postQueryHandler evaluates a query over the keys of the session KeySet.
+//
+// The query has the form
+//
+//		[select <field>, ...] [below <key>] [where <condition>]
+//		[order by <field> [asc|desc]] [limit <n>]
+//
+// where fields are `name`, `basename`, `value`, `meta` and `meta.<name>`.
+// Conditions compare fields and literals with `==`, `!=`, `<`, `<=`, `>`,
+// `>=`, match regular expressions with `=~` and `!~`, check if a field is
+// set with `exists` and are combined with `and`, `or`, `not` and parentheses.
+// Values are compared as numbers if both sides are numbers and no side is
+// a quoted string.
+//
+// Arguments:
+//		query	the query. JSON string or text/plain POST body.
+//
+// Response Code:
+//		200 OK if the query was evaluated.
+//		400 Bad Request if the query is invalid.
+//
+// Returns: JSON array of `findResult` structs.
+//
+// Example: `curl -X POST -d '"below user:/apps where meta.type == \"long\" and value > 1000 order by name limit 50"' localhost:33333/kdbQuery`
+func (s *server) postQueryHandler(w http.ResponseWriter, r *http.Request) {
+	var queryString string
+	var err error
+
+	if isJSONRequest(r) {
+		queryString, err = stringBody(r)
+	} else {
+		var body []byte
+
+		body, err = ioutil.ReadAll(r.Body)
+		queryString = string(body)
+	}
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	query, err := parseQuery(queryString)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	root, err := elektra.NewKey(query.below)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	defer root.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, root)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	results := []*findResult{}
+
+	for _, key := range query.run(ks, root) {
+		result := &findResult{}
+
+		if query.selects("name") {
+			result.Name = key.Name()
+		}
+
+		if query.selects("basename") {
+			result.BaseName = key.BaseName()
+		}
+
+		if query.selects("value") {
+			value := key.String()
+
+			if isBinary(key) {
+				value = base64.StdEncoding.EncodeToString(key.Bytes())
+			}
+
+			result.Value = &value
+		}
+
+		if query.selects("meta") {
+			result.Meta = key.MetaMap()
+		}
+
+		results = append(results, result)
+	}
+
+	writeResponse(w, results)
+}
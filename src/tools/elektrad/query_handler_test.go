@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPostQuery(t *testing.T) {
+	longType := "long"
+
+	setupKeyWithMeta(t, "user:/tests/elektrad/kdbquery/a", keyValueBody{Key: "type", Value: &longType})
+	setupKeyWithMeta(t, "user:/tests/elektrad/kdbquery/b", keyValueBody{Key: "type", Value: &longType})
+	setupKey(t, "user:/tests/elektrad/kdbquery/c")
+
+	testPut(t, "/kdb/user:/tests/elektrad/kdbquery/a", "500")
+	testPut(t, "/kdb/user:/tests/elektrad/kdbquery/b", "2000")
+	testPut(t, "/kdb/user:/tests/elektrad/kdbquery/c", "3000")
+
+	w := testPost(t, "/kdbQuery", `select name, value below user:/tests/elektrad/kdbquery where meta.type == "long" and value > 1000 order by value desc`)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	result := []*findResult{}
+	parseBody(t, w, &result)
+
+	removeTree(t, "user:/tests/elektrad/kdbquery")
+
+	Assertf(t, len(result) == 1, "result should have len() 1 but has %d", len(result))
+	Assertf(t, result[0].Name == "user:/tests/elektrad/kdbquery/b", "wrong key %s", result[0].Name)
+	Assert(t, result[0].Value != nil && *result[0].Value == "2000", "wrong value")
+	Assert(t, result[0].Meta == nil, "meta should not be selected")
+
+	w = testPost(t, "/kdbQuery", `where value ==`)
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusBadRequest, "wrong status code for invalid query: %v", code)
+}
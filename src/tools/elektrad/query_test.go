@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+func TestParseQuery(t *testing.T) {
+	valid := []string{
+		``,
+		`below user:/apps`,
+		`select name, value below "user:/apps" where value == 'a b'`,
+		`where meta.type == "long" and value > 1000 order by name limit 50`,
+		`WHERE not (value =~ "^http" or meta.check/type exists) ORDER BY value DESC`,
+		`where basename != "#0" and value <= -1.5`,
+	}
+
+	for _, query := range valid {
+		_, err := parseQuery(query)
+		Checkf(t, err, "could not parse %q: %v", query, err)
+	}
+
+	invalid := []string{
+		`below`,
+		`where`,
+		`where value`,
+		`where value = 1`,
+		`where value == name2`,
+		`where value =~ "("`,
+		`where value =~ name`,
+		`where (value == 1`,
+		`where value == "a`,
+		`select meta.type`,
+		`order name`,
+		`order by meta`,
+		`limit 0`,
+		`limit x`,
+		`where value == 1 and`,
+		`below user:/apps below user:/apps`,
+	}
+
+	for _, query := range invalid {
+		_, err := parseQuery(query)
+		Assertf(t, err != nil, "%q should be invalid", query)
+	}
+}
+
+func TestQueryEval(t *testing.T) {
+	key, err := elektra.NewKey("user:/tests/query/port", "8080")
+	Check(t, err, "could not create key")
+	Check(t, key.SetMeta("type", "unsigned_short"), "could not set meta")
+
+	tests := []struct {
+		condition string
+		expected  bool
+	}{
+		{`value == 8080`, true},
+		{`value == "8080.0"`, false},
+		{`value == 8080.0`, true},
+		{`value > 1000 and value < 9000`, true},
+		{`value > 900`, true},
+		{`meta.type == "unsigned_short"`, true},
+		{`meta.type =~ "^unsigned"`, true},
+		{`meta.default exists`, false},
+		{`meta.default != "1"`, true},
+		{`meta.default == "1"`, false},
+		{`not meta.default exists or value < 0`, true},
+		{`basename == "port" and name =~ "^user:/"`, true},
+		{`value !~ "^8"`, false},
+	}
+
+	for _, test := range tests {
+		q, err := parseQuery("where " + test.condition)
+		Checkf(t, err, "could not parse %q: %v", test.condition, err)
+
+		Assertf(t, q.where.eval(key) == test.expected, "%s should be %v", test.condition, test.expected)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+// getRawHandler returns the plain value of a key. Binary values are
+// returned unencoded with the content type of the `mimetype` metadata or
+// `application/octet-stream`. The value is always served as attachment, so
+// that browsers do not render stored values in the origin of elektrad.
+//
+// Arguments:
+//		keyName		the name of the key. URL path param.
+//
+// Response Code:
+//		200 OK if the key exists.
+//		400 Bad Request if the key name is invalid.
+//		404 Not Found if the key does not exist.
+//
+// Example: `curl -o cert.der localhost:33333/kdbRaw/user/test/certificate`
+func (s *server) getRawHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := parseKeyNameFromURL(r)
+
+	key, err := elektra.NewKey(keyName)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer key.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, key)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	foundKey := ks.Lookup(key)
+
+	if foundKey == nil {
+		notFound(w)
+		return
+	}
+
+	var value []byte
+	contentType := "text/plain; charset=utf-8"
+
+	if isBinary(foundKey) {
+		value = foundKey.Bytes()
+		contentType = binaryContentType(foundKey)
+	} else {
+		value = []byte(foundKey.String())
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	w.Header().Set("Content-Disposition", "attachment")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	w.Write(value)
+}
+
+// binaryContentType returns the `mimetype` metadata of a binary key if it is
+// a valid media type and `application/octet-stream` otherwise.
+func binaryContentType(key elektra.Key) string {
+	if mimeType := key.Meta("mimetype"); mimeType != "" {
+		if _, _, err := mime.ParseMediaType(mimeType); err == nil {
+			return mimeType
+		}
+	}
+
+	return "application/octet-stream"
+}
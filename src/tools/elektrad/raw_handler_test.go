@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetRaw(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdbraw/get"
+	value := []byte{0x30, 0x82, 0x00, 0xff}
+
+	w := testRawRequest(t, "PUT", "/kdb/"+keyName, "application/octet-stream", value)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusCreated, "wrong status code: %v", code)
+
+	w = testGet(t, "/kdbRaw/"+keyName)
+	removeKey(t, keyName)
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	contentType := w.Result().Header.Get("Content-Type")
+	Assertf(t, contentType == "application/octet-stream", "wrong content type %s", contentType)
+	Assertf(t, bytes.Equal(w.Body.Bytes(), value), "wrong value %v", w.Body.Bytes())
+}
+
+func TestGetRawHTML(t *testing.T) {
+	keyName := "user:/tests/elektrad/kdbraw/html"
+	value := []byte("<html><script>alert(1)</script></html>")
+
+	w := testRawRequest(t, "PUT", "/kdb/"+keyName, "application/octet-stream", value)
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusCreated, "wrong status code: %v", code)
+
+	w = testGet(t, "/kdbRaw/"+keyName)
+
+	contentType := w.Result().Header.Get("Content-Type")
+	Assertf(t, !strings.HasPrefix(contentType, "text/html"), "stored HTML is served as %s", contentType)
+	Assertf(t, contentType == "application/octet-stream", "wrong content type %s", contentType)
+
+	header := w.Result().Header
+	Assertf(t, header.Get("X-Content-Type-Options") == "nosniff", "wrong X-Content-Type-Options %s", header.Get("X-Content-Type-Options"))
+	Assertf(t, header.Get("Content-Disposition") == "attachment", "wrong Content-Disposition %s", header.Get("Content-Disposition"))
+
+	// the mimetype metadata is used as content type
+	mimeType := "image/png"
+
+	w = testPost(t, "/kdbMeta/"+keyName, keyValueBody{Key: "mimetype", Value: &mimeType})
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "could not set mimetype: %v", code)
+
+	w = testGet(t, "/kdbRaw/"+keyName)
+	removeKey(t, keyName)
+
+	contentType = w.Result().Header.Get("Content-Type")
+	Assertf(t, contentType == "image/png", "wrong content type %s", contentType)
+}
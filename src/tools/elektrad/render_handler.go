@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+type renderBody struct {
+	// Template is the text of the template.
+	Template string `json:"template"`
+	// TemplateKey is the name of a key containing the template.
+	TemplateKey string `json:"templateKey"`
+}
+
+// renderer renders templates with the keys of a KeySet.
+type renderer struct {
+	ks   elektra.KeySet
+	root string
+	opts treeOptions
+}
+
+// postRenderHandler renders a Go `text/template` with the subtree below a key
+// as data, in the format returned by `/kdbTree`. If the key is a cascading
+// key (a name without namespace), the keys of the subtree are resolved by
+// cascading lookup.
+//
+// Templates can use the following functions, relative key names are below
+// the rendered key and cascading names are resolved by cascading lookup:
+//
+//		lookup <name>				the value of a key, empty if it does not exist.
+//		exists <name>				if the key exists.
+//		cascade <name>				the value of a key resolved by cascading lookup,
+//									the namespace of the name is ignored.
+//		meta <name> <meta>			the value of a metakey of a key.
+//		keys <name>					the sorted base names of the keys directly below a key.
+//		default <fallback> <value>	`value`, or `fallback` if `value` is empty.
+//
+// Arguments:
+//		keyName		the name of the root key. URL path param.
+//		template	the template. text/plain POST body or the `template`
+//					field of a JSON body.
+//		templateKey	the name of a key containing the template. `templateKey`
+//					field of a JSON body.
+//		typed		if `true` values of the data are converted according to
+//					their `type` metadata. Optional query parameter (bool).
+//
+// Response Code:
+//		200 OK with the rendered template.
+//		400 Bad Request if the key name or template is invalid or rendering
+//			fails.
+//
+// Example: `curl -X POST -H 'Content-Type: text/plain' -d 'listen {{ .port }};' localhost:33333/kdbRender/user:/sw/nginx`
+func (s *server) postRenderHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := parseRenderBody(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	keyName := parseKeyNameFromURL(r)
+
+	if cascadingName(keyName) == keyName && !strings.HasPrefix(keyName, "/") {
+		// the leading slash of cascading names is lost in the URL
+		keyName = "/" + keyName
+	}
+
+	root, err := elektra.NewKey(keyName)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer root.Close()
+
+	// templates can look up any key
+	all, err := elektra.NewKey("/")
+
+	if err != nil {
+		internalServerError(w)
+		return
+	}
+
+	defer all.Close()
+
+	handle, ks := getHandle(r)
+
+	if _, err = handle.Get(ks, all); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	rd := &renderer{
+		ks:   ks,
+		root: root.Name(),
+		opts: treeOptions{typed: parseTyped(r)},
+	}
+
+	text := body.Template
+
+	if body.TemplateKey != "" {
+		k := rd.lookupKey(body.TemplateKey)
+
+		if k == nil {
+			writeError(w, errors.New("the template key does not exist"))
+			return
+		}
+
+		text = k.String()
+	}
+
+	out, err := rd.render(text)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(out)
+}
+
+// parseRenderBody parses the JSON or plain text body of a render request.
+func parseRenderBody(r *http.Request) (*renderBody, error) {
+	body := &renderBody{}
+
+	if isJSONRequest(r) {
+		if err := json.NewDecoder(r.Body).Decode(body); err != nil {
+			return nil, err
+		}
+	} else {
+		text, err := ioutil.ReadAll(r.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		body.Template = string(text)
+	}
+
+	if (body.Template == "") == (body.TemplateKey == "") {
+		return nil, errors.New("either template or templateKey is required")
+	}
+
+	return body, nil
+}
+
+func (rd *renderer) render(text string) ([]byte, error) {
+	tmpl, err := template.New("render").Funcs(rd.funcs()).Parse(text)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	if err = tmpl.Execute(&buf, rd.data()); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (rd *renderer) funcs() template.FuncMap {
+	return template.FuncMap{
+		"lookup": func(name string) string {
+			if k := rd.lookupKey(name); k != nil {
+				return k.String()
+			}
+
+			return ""
+		},
+		"exists": func(name string) bool {
+			return rd.lookupKey(name) != nil
+		},
+		"cascade": func(name string) string {
+			if k := lookupCascading(rd.ks, cascadingName(rd.resolve(name))); k != nil {
+				return k.String()
+			}
+
+			return ""
+		},
+		"meta": func(name, meta string) string {
+			if k := rd.lookupKey(name); k != nil {
+				return k.Meta(meta)
+			}
+
+			return ""
+		},
+		"keys":    rd.keys,
+		"default": defaultValue,
+	}
+}
+
+// data returns the subtree below the root as template data.
+func (rd *renderer) data() interface{} {
+	root, err := elektra.NewKey(rd.root)
+
+	if err != nil {
+		return nil
+	}
+
+	defer root.Close()
+
+	if cascadingName(rd.root) != rd.root {
+		dup := rd.ks.Duplicate()
+		defer dup.Close()
+
+		below := dup.Cut(root)
+		defer below.Close()
+
+		return buildTree(root, below, rd.opts)
+	}
+
+	resolved := elektra.NewKeySet()
+	defer resolved.Close()
+
+	seen := map[string]bool{}
+
+	for _, k := range rd.ks.ToSlice() {
+		name := cascadingName(k.Name())
+
+		if seen[name] || !k.IsBelowOrSame(root) {
+			continue
+		}
+
+		seen[name] = true
+
+		if resolvedKey := lookupCascading(rd.ks, name); resolvedKey != nil {
+			resolved.AppendKey(resolvedKey)
+		}
+	}
+
+	return buildTree(root, resolved, rd.opts)
+}
+
+// resolve returns the name of relative key names below the root.
+func (rd *renderer) resolve(name string) string {
+	if strings.HasPrefix(name, "/") || strings.Contains(name, ":/") {
+		return name
+	}
+
+	return strings.TrimSuffix(rd.root, "/") + "/" + name
+}
+
+func (rd *renderer) lookupKey(name string) elektra.Key {
+	name = rd.resolve(name)
+
+	if cascadingName(name) == name {
+		return lookupCascading(rd.ks, name)
+	}
+
+	return rd.ks.LookupByName(name)
+}
+
+func (rd *renderer) keys(name string) []string {
+	parent, err := elektra.NewKey(rd.resolve(name))
+
+	if err != nil {
+		return nil
+	}
+
+	defer parent.Close()
+
+	seen := map[string]bool{}
+	names := []string{}
+
+	for _, k := range rd.ks.ToSlice() {
+		if k.IsDirectlyBelow(parent) && !strings.HasPrefix(k.Name(), "spec:/") && !seen[k.BaseName()] {
+			seen[k.BaseName()] = true
+			names = append(names, k.BaseName())
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// lookupCascading looks up a cascading key name in the namespaces in the
+// order of the cascading lookup. If no namespace contains the key, the
+// `default` metadata of the `spec` key is used.
+func lookupCascading(ks elektra.KeySet, name string) elektra.Key {
+	for _, namespace := range namespaces[1:] {
+		if k := ks.LookupByName(namespace + ":" + name); k != nil {
+			return k
+		}
+	}
+
+	specKey := ks.LookupByName("spec:" + name)
+
+	if specKey == nil || specKey.Meta("default") == "" {
+		return nil
+	}
+
+	k, err := elektra.NewKey("default:"+name, specKey.Meta("default"))
+
+	if err != nil {
+		return nil
+	}
+
+	return k
+}
+
+// defaultValue returns `value`, or `fallback` if `value` is empty.
+func defaultValue(fallback, value interface{}) interface{} {
+	if value == nil || value == "" {
+		return fallback
+	}
+
+	return value
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPostRender(t *testing.T) {
+	root := "user:/tests/elektrad/render"
+
+	w := testPut(t, "/kdbTree/"+root, map[string]interface{}{
+		"port":     8080,
+		"hosts":    []string{"a", "b"},
+		"template": "listen {{ .port }};{{ range .hosts }} {{ . }}{{ end }}",
+	})
+	Assertf(t, w.Code == http.StatusNoContent, "could not write tree: %v", w.Code)
+
+	defer removeTree(t, root)
+
+	w = testRawRequest(t, "POST", "/kdbRender/"+root, "text/plain",
+		[]byte(`{{ .port }} {{ lookup "hosts/#1" }} {{ lookup "missing" | default "80" }} {{ exists "port" }} {{ keys "." }}`))
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+	Assertf(t, w.Body.String() == "8080 b 80 true [hosts port template]", "wrong output %q", w.Body.String())
+
+	w = testPost(t, "/kdbRender/"+root, renderBody{TemplateKey: root + "/template"})
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+	Assertf(t, w.Body.String() == "listen 8080; a b", "wrong output %q", w.Body.String())
+
+	w = testPost(t, "/kdbRender/"+root, renderBody{Template: "{{ .port"})
+	Assertf(t, w.Code == http.StatusBadRequest, "wrong status code: %v", w.Code)
+
+	w = testPost(t, "/kdbRender/"+root, renderBody{})
+	Assertf(t, w.Code == http.StatusBadRequest, "wrong status code: %v", w.Code)
+}
+
+func TestPostRenderCascading(t *testing.T) {
+	root := "/tests/elektrad/render/cascading"
+
+	w := testPut(t, "/kdb/system:"+root+"/host", "system")
+	Assertf(t, w.Code == http.StatusCreated, "could not create key: %v", w.Code)
+
+	w = testPut(t, "/kdb/user:"+root+"/host", "user")
+	Assertf(t, w.Code == http.StatusCreated, "could not create key: %v", w.Code)
+
+	w = testPut(t, "/kdb/system:"+root+"/port", "80")
+	Assertf(t, w.Code == http.StatusCreated, "could not create key: %v", w.Code)
+
+	defer removeTree(t, "user:"+root)
+	defer removeTree(t, "system:"+root)
+
+	w = testRawRequest(t, "POST", "/kdbRender"+root, "text/plain",
+		[]byte(`{{ .host }}:{{ .port }} {{ cascade "system:`+root+`/host" }}`))
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+	Assertf(t, w.Body.String() == "user:80 user", "wrong output %q", w.Body.String())
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"encoding/json"
+	"mime"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 )
@@ -18,28 +20,72 @@ func setupRouter(app *server) http.Handler {
 
 	r.HandleFunc("/kdb", app.getKdbHandler).Methods("GET")
 	r.HandleFunc("/kdb/{path:.*}", app.getKdbHandler).Methods("GET")
+	r.HandleFunc("/kdb/{path:.*}", app.headKdbHandler).Methods("HEAD")
 	r.HandleFunc("/kdb/{path:.*}", app.putKdbHandler).Methods("PUT")
 	r.HandleFunc("/kdb/{path:.*}", app.deleteKdbHandler).Methods("DELETE")
+	r.HandleFunc("/kdb/{path:.*}", app.patchKdbHandler).Methods("PATCH")
 
+	r.HandleFunc("/namespaces", app.getNamespacesHandler).Methods("GET")
+	r.HandleFunc("/namespaces/{path:.*}", app.getNamespacesHandler).Methods("GET")
+
+	r.HandleFunc("/kdbRaw/{path:.*}", app.getRawHandler).Methods("GET")
+
+	r.HandleFunc("/kdbTree/{path:.*}", app.getTreeHandler).Methods("GET")
+	r.HandleFunc("/kdbTree/{path:.*}", app.putTreeHandler).Methods("PUT")
+
+	r.HandleFunc("/kdbArray/{path:.*}", app.getArrayHandler).Methods("GET")
+	r.HandleFunc("/kdbArray/{path:.*}", app.postArrayHandler).Methods("POST")
+	r.HandleFunc("/kdbArray/{path:.*}", app.putArrayHandler).Methods("PUT")
+	r.HandleFunc("/kdbArray/{path:.*}", app.deleteArrayHandler).Methods("DELETE")
+
+	r.HandleFunc("/kdbFind", app.getFindHandler).Methods("GET")
 	r.HandleFunc("/kdbFind/{path:.*}", app.getFindHandler).Methods("GET")
 
+	r.HandleFunc("/kdbQuery", app.postQueryHandler).Methods("POST")
+
+	r.HandleFunc("/kdbExport/{path:.*}", app.getExportHandler).Methods("GET")
+
+	r.HandleFunc("/kdbRender/{path:.*}", app.postRenderHandler).Methods("POST")
+
 	r.HandleFunc("/kdbMv/{path:.*}", app.postMoveHandler).Methods("POST")
 
-	// TODO
-	// r.HandleFunc("/kdbCp/{path:.*", app.postCopyHandler).Methods("POST")
+	r.HandleFunc("/kdbCp/{path:.*}", app.postCopyHandler).Methods("POST")
 
+	r.HandleFunc("/kdbMeta/{path:.*}", app.getMetaHandler).Methods("GET")
+	r.HandleFunc("/kdbMeta/{path:.*}", app.putMetaHandler).Methods("PUT")
 	r.HandleFunc("/kdbMeta/{path:.*}", app.postMetaHandler).Methods("POST")
 	r.HandleFunc("/kdbMeta/{path:.*}", app.deleteMetaHandler).Methods("DELETE")
 
+	r.HandleFunc("/kdbSpec/{path:.*}", app.getSpecHandler).Methods("GET")
+	r.HandleFunc("/kdbSpec/{path:.*}", app.putSpecHandler).Methods("PUT")
+	r.HandleFunc("/kdbSpecMount/{path:.*}", app.postSpecMountHandler).Methods("POST")
+
+	if app.consul != nil {
+		r.HandleFunc("/v1/kv/{path:.*}", app.getConsulKVHandler).Methods("GET")
+		r.HandleFunc("/v1/kv/{path:.*}", app.putConsulKVHandler).Methods("PUT")
+		r.HandleFunc("/v1/kv/{path:.*}", app.deleteConsulKVHandler).Methods("DELETE")
+	}
+
 	return r
 }
 
+// parseKeyNameFromURL returns the key name of the `path` URL param. If the
+// `namespace` query parameter is passed, the namespace of the key name is
+// replaced with it. Endpoints that do not support `namespace`, like the spec
+// endpoints, must not use it.
 func parseKeyNameFromURL(r *http.Request) string {
-	vars := mux.Vars(r)
-	keyName := vars["path"]
+	return keyNameFromPath(r, mux.Vars(r)["path"])
+}
 
+// keyNameFromPath returns the key name of a path from the URL, in the
+// namespace of the `namespace` query parameter if it is set.
+func keyNameFromPath(r *http.Request, keyName string) string {
 	if len(keyName) == 0 {
-		return "/"
+		keyName = "/"
+	}
+
+	if namespace := r.URL.Query().Get("namespace"); namespace != "" {
+		return withNamespace(keyName, namespace)
 	}
 
 	return keyName
@@ -56,10 +102,44 @@ func stringBody(r *http.Request) (string, error) {
 	return value, nil
 }
 
+func isJSONRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+
+	if contentType == "" {
+		return true
+	}
+
+	return mediaType(contentType) == "application/json"
+}
+
+func isOctetStreamRequest(r *http.Request) bool {
+	return mediaType(r.Header.Get("Content-Type")) == "application/octet-stream"
+}
+
+func mediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		return ""
+	}
+
+	return mediaType
+}
+
+func parseBinary(r *http.Request) bool {
+	binary, _ := strconv.ParseBool(r.URL.Query().Get("binary"))
+
+	return binary
+}
+
 func notFound(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusNotFound)
 }
 
+func notModified(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotModified)
+}
+
 func noContent(w http.ResponseWriter) {
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -77,11 +157,18 @@ func internalServerError(w http.ResponseWriter) {
 }
 
 func writeError(w http.ResponseWriter, err error) {
-	badRequest(w)
+	writeErrorCode(w, http.StatusBadRequest, err)
+}
 
-	writeResponse(w, map[string]string{
+func writeErrorCode(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	js, _ := json.Marshal(map[string]string{
 		"error": err.Error(),
 	})
+
+	w.Write(js)
 }
 
 func writeResponse(w http.ResponseWriter, response interface{}) {
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	elektra "go.libelektra.org/kdb"
+)
+
+// pluginArgumentPattern matches the plugin arguments of `kdb spec-mount`: a
+// plugin name, optionally with a reference, or a `name=value` config.
+var pluginArgumentPattern = regexp.MustCompile(`^([a-z][a-z0-9_]*(#[a-z0-9_]+)?|[A-Za-z0-9_][A-Za-z0-9_/#]*=.*)$`)
+
+type specArray struct {
+	Min string `json:"min,omitempty"`
+	Max string `json:"max,omitempty"`
+}
+
+type specKey struct {
+	Name        string            `json:"name"`
+	Type        string            `json:"type,omitempty"`
+	Default     *string           `json:"default,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Checks      map[string]string `json:"checks,omitempty"`
+	Array       *specArray        `json:"array,omitempty"`
+	Meta        map[string]string `json:"meta,omitempty"`
+}
+
+type specResult struct {
+	Path string     `json:"path"`
+	Keys []*specKey `json:"keys"`
+}
+
+// getSpecHandler returns the specification of an application.
+//
+// Arguments:
+//		path	the path of the specification, with or without the `spec:`
+//				namespace. URL path param.
+//
+// Response Code:
+//		200 OK if the request is successfull.
+//		400 Bad Request if the path is invalid or `namespace` is passed.
+//
+// Returns: JSON marshaled `specResult` struct.
+//
+// Example: `curl localhost:33333/kdbSpec/sw/org/app/#0/current`
+func (s *server) getSpecHandler(w http.ResponseWriter, r *http.Request) {
+	rootName, err := parseSpecKeyNameFromURL(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	root, err := elektra.NewKey(rootName)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer root.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, root)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	dup := ks.Duplicate()
+	defer dup.Close()
+
+	specKs := dup.Cut(root)
+	defer specKs.Close()
+
+	result := specResult{
+		Path: root.Name(),
+		Keys: []*specKey{},
+	}
+
+	specKs.ForEach(func(k elektra.Key, _ int) {
+		result.Keys = append(result.Keys, buildSpecKey(k))
+	})
+
+	writeResponse(w, result)
+}
+
+// putSpecHandler replaces the specification of an application.
+//
+// If the body is JSON it must be an array of `specKey` objects, key names
+// may be relative to the path. Otherwise the body is imported with
+// `kdb import` using the format passed in the `format` query parameter.
+//
+// Arguments:
+//		path	the path of the specification. URL path param.
+//		format	the format of a non-JSON body, e.g. `ni`. Query param.
+//
+// Response Code:
+//		204 No Content if the specification was written.
+//		400 Bad Request if the path or body is invalid or `namespace` is passed.
+//		501 Not Implemented if a non-JSON body is passed with the `memory` storage.
+//
+// Example: `curl -X PUT -d '[{ "name": "port", "type": "unsigned_short" }]' localhost:33333/kdbSpec/sw/org/app/#0/current`
+func (s *server) putSpecHandler(w http.ResponseWriter, r *http.Request) {
+	rootName, err := parseSpecKeyNameFromURL(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if !isJSONRequest(r) {
+		format := r.URL.Query().Get("format")
+
+		if format == "" {
+			badRequest(w)
+			return
+		}
+
+		if !kdbToolSupported(w) {
+			return
+		}
+
+		cmd := s.kdbCommand("import", "-s", "cut", rootName, format)
+		cmd.Stdin = r.Body
+
+		if err := runCommand(cmd); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		noContent(w)
+		return
+	}
+
+	var specKeys []*specKey
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&specKeys); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	root, err := elektra.NewKey(rootName)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer root.Close()
+
+	newKs := elektra.NewKeySet()
+	defer newKs.Close()
+
+	for _, sk := range specKeys {
+		k, err := sk.toKey(root)
+
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		newKs.AppendKey(k)
+	}
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, root)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	oldKs := ks.Cut(root)
+	defer oldKs.Close()
+
+	ks.Append(newKs)
+
+	err = set(handle, ks, root)
+
+	if err != nil {
+		// restore the session KeySet
+		ks.Cut(root).Close()
+		ks.Append(oldKs)
+
+		writeError(w, err)
+		return
+	}
+
+	noContent(w)
+}
+
+// postSpecMountHandler mounts an application according to its specification
+// with `kdb spec-mount`.
+//
+// Arguments:
+//		path	the cascading mountpoint. URL path param.
+//		plugins	additional plugins to mount, plugin names or `name=value`
+//				configs. Optional JSON string array POST body.
+//
+// Response Code:
+//		204 No Content if the mount was successfull.
+//		400 Bad Request if the path or a plugin is invalid, `namespace` is passed
+//		or mounting failed.
+//		501 Not Implemented with the `memory` storage.
+//
+// Example: `curl -X POST localhost:33333/kdbSpecMount/sw/org/app/#0/current`
+func (s *server) postSpecMountHandler(w http.ResponseWriter, r *http.Request) {
+	rootName, err := parseSpecKeyNameFromURL(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	mountpoint := strings.TrimPrefix(rootName, "spec:")
+
+	var plugins []string
+
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&plugins); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	if _, err := elektra.NewKey(mountpoint); err != nil {
+		badRequest(w)
+		return
+	}
+
+	// the arguments must not be parsed as options of `kdb`
+	for _, plugin := range plugins {
+		if !pluginArgumentPattern.MatchString(plugin) {
+			writeError(w, fmt.Errorf("invalid plugin %q", plugin))
+			return
+		}
+	}
+
+	if !kdbToolSupported(w) {
+		return
+	}
+
+	cmd := s.kdbCommand(append([]string{"spec-mount", mountpoint}, plugins...)...)
+
+	if err := runCommand(cmd); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	noContent(w)
+}
+
+func (sk *specKey) toKey(root elektra.Key) (elektra.Key, error) {
+	name := sk.Name
+
+	if !strings.HasPrefix(name, "spec:/") {
+		name = root.Name() + "/" + strings.TrimPrefix(name, "/")
+	}
+
+	k, err := elektra.NewKey(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !k.IsBelowOrSame(root) {
+		return nil, fmt.Errorf("key %s is not below %s", k.Name(), root.Name())
+	}
+
+	meta := map[string]string{}
+
+	for name, value := range sk.Meta {
+		meta[name] = value
+	}
+
+	if sk.Type != "" {
+		meta["type"] = sk.Type
+	}
+
+	if sk.Default != nil {
+		meta["default"] = *sk.Default
+	}
+
+	if sk.Description != "" {
+		meta["description"] = sk.Description
+	}
+
+	for name, value := range sk.Checks {
+		meta["check/"+name] = value
+	}
+
+	if sk.Array != nil {
+		if sk.Array.Min != "" {
+			meta["array/min"] = sk.Array.Min
+		}
+
+		if sk.Array.Max != "" {
+			meta["array/max"] = sk.Array.Max
+		}
+	}
+
+	for name, value := range meta {
+		if err = k.SetMeta(name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+func buildSpecKey(k elektra.Key) *specKey {
+	sk := &specKey{
+		Name: k.Name(),
+	}
+
+	for name, value := range k.MetaMap() {
+		name = strings.TrimPrefix(name, "meta:/")
+		value := value
+
+		switch {
+		case name == "type":
+			sk.Type = value
+		case name == "default":
+			sk.Default = &value
+		case name == "description":
+			sk.Description = value
+		case strings.HasPrefix(name, "check/"):
+			if sk.Checks == nil {
+				sk.Checks = map[string]string{}
+			}
+
+			sk.Checks[strings.TrimPrefix(name, "check/")] = value
+		case name == "array/min" || name == "array/max":
+			if sk.Array == nil {
+				sk.Array = &specArray{}
+			}
+
+			if name == "array/min" {
+				sk.Array.Min = value
+			} else {
+				sk.Array.Max = value
+			}
+		default:
+			if sk.Meta == nil {
+				sk.Meta = map[string]string{}
+			}
+
+			sk.Meta[name] = value
+		}
+	}
+
+	// legacy specifications use `check/type` instead of `type`
+	if sk.Type == "" && sk.Checks["type"] != "" {
+		sk.Type = sk.Checks["type"]
+	}
+
+	return sk
+}
+
+// parseSpecKeyNameFromURL returns the key name in the `spec` namespace of the
+// `path` URL param. The `namespace` query parameter is rejected, it would
+// otherwise be part of the name, e.g. `spec:/user:/app`.
+func parseSpecKeyNameFromURL(r *http.Request) (string, error) {
+	if _, ok := r.URL.Query()["namespace"]; ok {
+		return "", errors.New("the namespace query parameter is not supported for specifications")
+	}
+
+	return specKeyName(mux.Vars(r)["path"]), nil
+}
+
+// specKeyName converts a path from the URL to a key name in the `spec`
+// namespace.
+func specKeyName(path string) string {
+	path = strings.TrimPrefix(path, "spec:")
+
+	return "spec:/" + strings.TrimPrefix(path, "/")
+}
+
+// kdbToolSupported returns true if the `kdb` tool modifies the keys of the
+// storage. Otherwise it responds with 501 Not Implemented, e.g. the `memory`
+// storage must not modify the key database.
+func kdbToolSupported(w http.ResponseWriter) bool {
+	if _, ok := backend.(elektraStorage); ok {
+		return true
+	}
+
+	writeErrorCode(w, http.StatusNotImplemented, errors.New("the kdb tool is not supported by the storage"))
+
+	return false
+}
+
+func (s *server) kdbCommand(args ...string) *exec.Cmd {
+	tool := s.kdbTool
+
+	if tool == "" {
+		tool = "kdb"
+	}
+
+	cmd := exec.Command(tool, args...)
+	cmd.Dir = serverDir
+	cmd.Env = serverEnvironment
+
+	return cmd
+}
+
+func runCommand(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+
+		if message == "" {
+			return err
+		}
+
+		return errors.New(message)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetSpec(t *testing.T) {
+	keyName := "spec:/tests/elektrad/kdbspec/get/port"
+	typeName := "unsigned_short"
+	defaultValue := "8080"
+
+	setupKeyWithMeta(t, keyName,
+		keyValueBody{Key: "type", Value: &typeName},
+		keyValueBody{Key: "default", Value: &defaultValue},
+	)
+
+	w := testGet(t, "/kdbSpec/tests/elektrad/kdbspec/get")
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var result specResult
+	parseBody(t, w, &result)
+
+	removeKey(t, keyName)
+
+	Assertf(t, len(result.Keys) == 1, "expected 1 spec key, got %d", len(result.Keys))
+
+	k := result.Keys[0]
+	Assertf(t, k.Name == keyName, "wrong spec key name %s", k.Name)
+	Assertf(t, k.Type == typeName, "wrong type %q", k.Type)
+	Assert(t, k.Default != nil && *k.Default == defaultValue, "wrong default value")
+}
+
+func TestPutSpec(t *testing.T) {
+	keyName := "spec:/tests/elektrad/kdbspec/put/port"
+	typeName := "unsigned_short"
+
+	w := testPut(t, "/kdbSpec/tests/elektrad/kdbspec/put", []*specKey{
+		{Name: "port", Type: typeName, Checks: map[string]string{"range": "1-65535"}},
+	})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	key := getKey(t, keyName)
+	removeKey(t, keyName)
+	Assert(t, key != nil, "spec key was not created")
+	Assertf(t, key.Meta("type") == typeName, "wrong type %q", key.Meta("type"))
+	Assertf(t, key.Meta("check/range") == "1-65535", "wrong range %q", key.Meta("check/range"))
+}
+
+func TestPostSpecMountInvalidPlugin(t *testing.T) {
+	for _, plugin := range []string{"--help", "-v", "", "dump; rm"} {
+		w := testPost(t, "/kdbSpecMount/tests/elektrad/kdbspec/mount", []string{plugin})
+		Assertf(t, w.Code == http.StatusBadRequest, "wrong status code for %q: %v", plugin, w.Code)
+
+		var result map[string]string
+		parseBody(t, w, &result)
+		Assertf(t, strings.HasPrefix(result["error"], "invalid plugin"), "plugin %q was not rejected: %s", plugin, result["error"])
+	}
+
+	for _, plugin := range []string{"dump", "type", "ni#1", "path=/tmp/app.ini"} {
+		Assertf(t, pluginArgumentPattern.MatchString(plugin), "valid plugin %q was rejected", plugin)
+	}
+}
+
+func TestSpecNamespaceRejected(t *testing.T) {
+	w := testGet(t, "/kdbSpec/tests/elektrad/kdbspec/namespace?namespace=user")
+	Assertf(t, w.Code == http.StatusBadRequest, "wrong status code for GET: %v", w.Code)
+
+	w = testPut(t, "/kdbSpec/tests/elektrad/kdbspec/namespace?namespace=user", []interface{}{})
+	Assertf(t, w.Code == http.StatusBadRequest, "wrong status code for PUT: %v", w.Code)
+
+	w = testPost(t, "/kdbSpecMount/tests/elektrad/kdbspec/namespace?namespace=user", nil)
+	Assertf(t, w.Code == http.StatusBadRequest, "wrong status code for POST: %v", w.Code)
+}
+
+func TestSpecKdbToolMemoryStorage(t *testing.T) {
+	if _, ok := backend.(elektraStorage); ok {
+		t.Skip("the kdb tool is supported by the key database")
+	}
+
+	w := testRawRequest(t, "PUT", "/kdbSpec/tests/elektrad/kdbspec/memory?format=ni", "text/plain", []byte("port = 1"))
+	Assertf(t, w.Code == http.StatusNotImplemented, "wrong status code for import: %v", w.Code)
+
+	w = testPost(t, "/kdbSpecMount/tests/elektrad/kdbspec/memory", []string{"dump"})
+	Assertf(t, w.Code == http.StatusNotImplemented, "wrong status code for spec-mount: %v", w.Code)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+// storage is the backend of the KDB handles. Handlers only use the
+// `elektra.KDB` interface of the handles, so they work with every storage.
+// Only the key database is replaced: keys and key sets are still provided by
+// libelektra, and the `kdb` tool only works with the `elektraStorage`.
+type storage interface {
+	// open returns a new, opened handle.
+	open() (elektra.KDB, error)
+}
+
+// backend is the storage of all handles, it is selected with `-storage`.
+var backend storage = elektraStorage{}
+
+// newStorage returns the storage with the name `elektra` or `memory`.
+func newStorage(name string) (storage, error) {
+	switch name {
+	case "elektra":
+		return elektraStorage{}, nil
+	case "memory":
+		return newMemoryStorage(), nil
+	}
+
+	return nil, fmt.Errorf("unknown storage %q", name)
+}
+
+// elektraStorage is the key database of libelektra.
+type elektraStorage struct{}
+
+func (elektraStorage) open() (elektra.KDB, error) {
+	kdb := elektra.New()
+
+	if err := kdb.Open(); err != nil {
+		return nil, err
+	}
+
+	return kdb, nil
+}
+
+// memoryVersion is the version reported by handles of the memory storage.
+const memoryVersion = "0.0.0-memory"
+
+// memoryStorage keeps all keys in memory, they are shared by all handles of
+// the storage and lost when elektrad exits. There is no conflict detection:
+// the last `Set` of a subtree wins.
+type memoryStorage struct {
+	mut  sync.Mutex
+	keys elektra.KeySet
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		keys: elektra.NewKeySet(),
+	}
+}
+
+func (m *memoryStorage) open() (elektra.KDB, error) {
+	kdb := &memoryKDB{storage: m}
+
+	return kdb, kdb.Open()
+}
+
+// memoryKDB is a handle of the memory storage.
+type memoryKDB struct {
+	storage *memoryStorage
+}
+
+func (h *memoryKDB) Open() error {
+	return nil
+}
+
+func (h *memoryKDB) Close() error {
+	return nil
+}
+
+// Get replaces the keys below `parentKey` in `ks` with copies of the stored
+// keys.
+func (h *memoryKDB) Get(ks elektra.KeySet, parentKey elektra.Key) (bool, error) {
+	h.storage.mut.Lock()
+	defer h.storage.mut.Unlock()
+
+	ks.Cut(parentKey).Close()
+
+	for _, k := range h.storage.keys.ToSlice() {
+		if k.IsBelowOrSame(parentKey) {
+			ks.AppendKey(k.Duplicate(elektra.KEY_CP_ALL))
+		}
+	}
+
+	return true, nil
+}
+
+// Set replaces the stored keys below `parentKey` with copies of the keys in
+// `ks`. Cascading keys are not stored.
+func (h *memoryKDB) Set(ks elektra.KeySet, parentKey elektra.Key) (bool, error) {
+	h.storage.mut.Lock()
+	defer h.storage.mut.Unlock()
+
+	h.storage.keys.Cut(parentKey).Close()
+
+	for _, k := range ks.ToSlice() {
+		if k.IsBelowOrSame(parentKey) && !strings.HasPrefix(k.Name(), "/") {
+			h.storage.keys.AppendKey(k.Duplicate(elektra.KEY_CP_ALL))
+		}
+	}
+
+	return true, nil
+}
+
+func (h *memoryKDB) Version() (string, error) {
+	return memoryVersion, nil
+}
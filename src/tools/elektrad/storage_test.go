@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storage := newMemoryStorage()
+
+	handle1, err := storage.open()
+	Check(t, err, "could not open handle")
+
+	handle2, err := storage.open()
+	Check(t, err, "could not open handle")
+
+	parentKey, err := elektra.NewKey("user:/tests/elektrad/memory")
+	Check(t, err, "could not create key")
+
+	key, err := elektra.NewKey("user:/tests/elektrad/memory/hello", "world")
+	Check(t, err, "could not create key")
+
+	ks := elektra.NewKeySet(key)
+
+	_, err = handle1.Set(ks, parentKey)
+	Check(t, err, "could not set keys")
+
+	// changes of the key set are not stored without `Set`
+	Check(t, key.SetString("changed"), "could not set value")
+
+	result := elektra.NewKeySet()
+
+	_, err = handle2.Get(result, parentKey)
+	Check(t, err, "could not get keys")
+
+	found := result.LookupByName("user:/tests/elektrad/memory/hello")
+	Assert(t, found != nil, "the key was not stored")
+	Assertf(t, found.String() == "world", "wrong value %q", found.String())
+
+	// keys outside of the parent key are not affected
+	otherParent, err := elektra.NewKey("user:/tests/elektrad/other")
+	Check(t, err, "could not create key")
+
+	_, err = handle2.Set(elektra.NewKeySet(), otherParent)
+	Check(t, err, "could not set keys")
+
+	_, err = handle1.Get(result, parentKey)
+	Check(t, err, "could not get keys")
+	Assertf(t, result.Len() == 1, "expected 1 key, got %d", result.Len())
+
+	// setting an empty key set removes the keys
+	_, err = handle1.Set(elektra.NewKeySet(), parentKey)
+	Check(t, err, "could not set keys")
+
+	_, err = handle2.Get(result, parentKey)
+	Check(t, err, "could not get keys")
+	Assertf(t, result.Len() == 0, "expected no keys, got %d", result.Len())
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+const (
+	treeMetaField  = "@meta"
+	treeValueField = "@value"
+)
+
+type treeMode int
+
+const (
+	// treeReplace replaces the subtree with the keys of the body.
+	treeReplace treeMode = iota
+	// treeMerge merges the keys of the body into the subtree.
+	treeMerge
+	// treeUpdate replaces the subtree with the keys of the body but keeps
+	// the metadata of keys that already exist.
+	treeUpdate
+)
+
+type treeOptions struct {
+	meta  bool
+	typed bool
+}
+
+type treeNode struct {
+	key      elektra.Key
+	children map[string]*treeNode
+	order    []string
+}
+
+// getTreeHandler returns a subtree as nested JSON. Elektra arrays are
+// returned as JSON arrays.
+//
+// Arguments:
+//		keyName		the name of the root key. URL path param.
+//		meta		if `true` the value and metadata of keys are returned in
+//					the `@value` and `@meta` fields. Optional query parameter (bool).
+//		typed		if `true` values are converted according to their
+//					`type` metadata. Optional query parameter (bool).
+//
+// Response Code:
+//		200 OK if the request is successfull.
+//		400 Bad Request if the key name is invalid.
+//
+// Example: `curl localhost:33333/kdbTree/user/test`
+func (s *server) getTreeHandler(w http.ResponseWriter, r *http.Request) {
+	keyName := parseKeyNameFromURL(r)
+
+	root, err := elektra.NewKey(keyName)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer root.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, root)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	dup := ks.Duplicate()
+	defer dup.Close()
+
+	subtree := dup.Cut(root)
+	defer subtree.Close()
+
+	meta, _ := strconv.ParseBool(r.URL.Query().Get("meta"))
+
+	writeResponse(w, buildTree(root, subtree, treeOptions{
+		meta:  meta,
+		typed: parseTyped(r),
+	}))
+}
+
+// putTreeHandler writes a subtree from nested JSON in one commit. JSON
+// arrays are stored as Elektra arrays, the `@meta` field of an object sets
+// the metadata and its `@value` field the value of the key. The values of
+// binary keys are base64 encoded, like in the response of GET.
+//
+// Arguments:
+//		keyName		the name of the root key. URL path param.
+//		mode		`replace` (default) removes all keys below the root
+//					that are not part of the body, `merge` keeps them.
+//					Optional query parameter.
+//
+// Response Code:
+//		204 No Content if the subtree was written.
+//		400 Bad Request if the key name, mode or body is invalid.
+//
+// Example: `curl -X PUT -d '{ "hosts": ["a", "b"], "port": 80 }' localhost:33333/kdbTree/user/test`
+func (s *server) putTreeHandler(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+
+	if mode != "" && mode != "replace" && mode != "merge" {
+		badRequest(w)
+		return
+	}
+
+	body, err := jsonBody(r)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	keyName := parseKeyNameFromURL(r)
+
+	root, err := elektra.NewKey(keyName)
+
+	if err != nil {
+		badRequest(w)
+		return
+	}
+
+	defer root.Close()
+
+	handle, ks := getHandle(r)
+
+	_, err = handle.Get(ks, root)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	treeMode := treeReplace
+
+	if mode == "merge" {
+		treeMode = treeMerge
+	}
+
+	err = writeTree(handle, ks, root, body, treeMode)
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	noContent(w)
+}
+
+// writeTree writes the keys described by `body` to the subtree below `root`
+// and commits the change.
+func writeTree(handle elektra.KDB, ks elektra.KeySet, root elektra.Key, body interface{}, mode treeMode) error {
+	oldKs := ks.Cut(root)
+	defer oldKs.Close()
+
+	tw := &treeWriter{
+		previous: oldKs,
+		types:    ks,
+		result:   elektra.NewKeySet(),
+	}
+
+	defer tw.result.Close()
+
+	if mode != treeReplace {
+		tw.existing = oldKs
+	}
+
+	newKs := elektra.NewKeySet()
+	defer newKs.Close()
+
+	err := tw.write(root.Name(), body)
+
+	if err == nil {
+		if mode == treeMerge {
+			newKs.Append(oldKs)
+
+			for _, name := range tw.replaced {
+				newKs.Cut(tw.result.LookupByName(name)).Close()
+			}
+		}
+
+		newKs.Append(tw.result)
+		ks.Append(newKs)
+
+		err = set(handle, ks, root)
+	}
+
+	if err != nil {
+		// restore the session KeySet
+		ks.Cut(root).Close()
+		ks.Append(oldKs)
+	}
+
+	return err
+}
+
+func buildTree(root elektra.Key, ks elektra.KeySet, opts treeOptions) interface{} {
+	rootNode := &treeNode{}
+	rootName := root.Name()
+
+	ks.ForEach(func(k elektra.Key, _ int) {
+		node := rootNode
+
+		for _, part := range splitKeyName(relativeKeyName(rootName, k.Name())) {
+			child, ok := node.children[part]
+
+			if !ok {
+				if node.children == nil {
+					node.children = map[string]*treeNode{}
+				}
+
+				child = &treeNode{}
+				node.children[part] = child
+				node.order = append(node.order, part)
+			}
+
+			node = child
+		}
+
+		node.key = k
+	})
+
+	return rootNode.toJSON(opts)
+}
+
+func (n *treeNode) toJSON(opts treeOptions) interface{} {
+	if len(n.children) == 0 {
+		if n.key != nil && hasMeta(n.key, "array") {
+			return []interface{}{}
+		}
+
+		value := n.value(opts)
+
+		if opts.meta && n.key != nil && len(n.key.MetaMap()) > 0 {
+			return map[string]interface{}{
+				treeValueField: value,
+				treeMetaField:  n.meta(),
+			}
+		}
+
+		return value
+	}
+
+	if n.isArray() {
+		var elements []interface{}
+
+		for _, part := range n.order {
+			i, _ := parseArrayIndex(part)
+
+			for len(elements) < i {
+				elements = append(elements, nil)
+			}
+
+			elements = append(elements, n.children[part].toJSON(opts))
+		}
+
+		return elements
+	}
+
+	object := map[string]interface{}{}
+
+	for _, part := range n.order {
+		object[part] = n.children[part].toJSON(opts)
+	}
+
+	if n.key != nil {
+		if value := n.value(opts); value != nil && value != "" {
+			object[treeValueField] = value
+		}
+
+		if opts.meta && len(n.key.MetaMap()) > 0 {
+			object[treeMetaField] = n.meta()
+		}
+	}
+
+	return object
+}
+
+func (n *treeNode) isArray() bool {
+	for _, part := range n.order {
+		if _, ok := parseArrayIndex(part); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (n *treeNode) value(opts treeOptions) interface{} {
+	if n.key == nil {
+		return ""
+	}
+
+	if isBinary(n.key) {
+		return base64.StdEncoding.EncodeToString(n.key.Bytes())
+	}
+
+	if opts.typed {
+		if value, err := typedValue(n.key, metaType(n.key)); err == nil {
+			return value
+		}
+	}
+
+	return n.key.String()
+}
+
+func (n *treeNode) meta() map[string]string {
+	return metaMap(n.key)
+}
+
+type treeWriter struct {
+	// existing contains the keys that are merged with the new keys
+	existing elektra.KeySet
+	// previous contains the keys of the subtree before the write, keys that
+	// were binary stay binary
+	previous elektra.KeySet
+	// types is used to look up the `type` of keys
+	types    elektra.KeySet
+	result   elektra.KeySet
+	replaced []string
+}
+
+func (tw *treeWriter) newKey(name string) (elektra.Key, error) {
+	if tw.existing != nil {
+		if k := tw.existing.LookupByName(name); k != nil {
+			return k.Duplicate(elektra.KEY_CP_ALL), nil
+		}
+	}
+
+	k, err := elektra.NewKey(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if tw.previous != nil {
+		if prev := tw.previous.LookupByName(name); prev != nil && isBinary(prev) {
+			if err = k.SetMeta("binary", ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return k, nil
+}
+
+func (tw *treeWriter) exists(name string) bool {
+	return tw.existing != nil && tw.existing.LookupByName(name) != nil
+}
+
+func (tw *treeWriter) write(name string, value interface{}) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return tw.writeObject(name, v)
+
+	case []interface{}:
+		k, err := tw.newKey(name)
+
+		if err != nil {
+			return err
+		}
+
+		lastIndex := ""
+
+		if len(v) > 0 {
+			lastIndex = arrayElementName(len(v) - 1)
+		}
+
+		if err = k.SetMeta("array", lastIndex); err != nil {
+			return err
+		}
+
+		tw.result.AppendKey(k)
+
+		// arrays always replace the existing elements
+		tw.replaced = append(tw.replaced, k.Name())
+
+		for i, element := range v {
+			if err := tw.write(name+"/"+arrayElementName(i), element); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	default:
+		k, err := tw.newKey(name)
+
+		if err != nil {
+			return err
+		}
+
+		if err = tw.setValue(k, v); err != nil {
+			return err
+		}
+
+		tw.result.AppendKey(k)
+
+		return nil
+	}
+}
+
+func (tw *treeWriter) writeObject(name string, object map[string]interface{}) error {
+	meta, hasMeta := object[treeMetaField]
+	value, hasValue := object[treeValueField]
+
+	if hasMeta || hasValue || len(object) == 0 || tw.exists(name) {
+		k, err := tw.newKey(name)
+
+		if err != nil {
+			return err
+		}
+
+		if hasMeta {
+			metaObject, ok := meta.(map[string]interface{})
+
+			if !ok {
+				return fmt.Errorf("%s of key %s is not an object", treeMetaField, name)
+			}
+
+			for metaName, metaValue := range metaObject {
+				metaString, err := typedToString(k, "", metaValue)
+
+				if err != nil {
+					return err
+				}
+
+				if err = k.SetMeta(metaName, metaString); err != nil {
+					return err
+				}
+			}
+		}
+
+		if hasValue {
+			if err = tw.setValue(k, value); err != nil {
+				return err
+			}
+		}
+
+		tw.result.AppendKey(k)
+	}
+
+	var children []string
+
+	for child := range object {
+		if child != treeMetaField && child != treeValueField {
+			children = append(children, child)
+		}
+	}
+
+	sort.Strings(children)
+
+	for _, child := range children {
+		if err := tw.write(name+"/"+escapeKeyNamePart(child), object[child]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (tw *treeWriter) setValue(k elektra.Key, value interface{}) error {
+	if _, ok := value.(map[string]interface{}); ok {
+		return errors.New(treeValueField + " must not be an object")
+	}
+
+	// binary values are base64 encoded, like in the response of GET
+	if isBinary(k) {
+		encoded, ok := value.(string)
+
+		if !ok {
+			return fmt.Errorf("the value of the binary key %s must be a base64 encoded string", k.Name())
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+
+		if err != nil {
+			return fmt.Errorf("the value of the binary key %s must be a base64 encoded string", k.Name())
+		}
+
+		return k.SetBytes(decoded)
+	}
+
+	s, err := typedToString(k, keyType(tw.types, k), value)
+
+	if err != nil {
+		return err
+	}
+
+	return k.SetString(s)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestPutTree(t *testing.T) {
+	root := "user:/tests/elektrad/kdbtree/put"
+
+	w := testPut(t, "/kdbTree/"+root, map[string]interface{}{
+		"port":  8080,
+		"hosts": []string{"a", "b"},
+		"log": map[string]interface{}{
+			"@meta":  map[string]string{"description": "log level"},
+			"@value": "debug",
+		},
+	})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	hosts := getKey(t, root+"/hosts")
+	host := getKey(t, root+"/hosts/#1")
+	logKey := getKey(t, root+"/log")
+	port := getKey(t, root+"/port")
+
+	removeTree(t, root)
+
+	Assert(t, hosts != nil && hosts.Meta("array") == "#1", "array metadata is wrong")
+	Assert(t, host != nil && host.String() == "b", "array element is wrong")
+	Assert(t, logKey != nil && logKey.String() == "debug", "value of log is wrong")
+	Assert(t, logKey.Meta("description") == "log level", "metadata of log is wrong")
+	Assert(t, port != nil && port.String() == "8080", "value of port is wrong")
+}
+
+func TestPutTreeMerge(t *testing.T) {
+	root := "user:/tests/elektrad/kdbtree/merge"
+
+	setupKey(t, root+"/keep")
+
+	w := testPut(t, "/kdbTree/"+root+"?mode=merge", map[string]interface{}{
+		"added": "value",
+	})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	keep := getKey(t, root+"/keep")
+	added := getKey(t, root+"/added")
+
+	removeTree(t, root)
+
+	Assert(t, keep != nil, "existing key was removed")
+	Assert(t, added != nil && added.String() == "value", "key was not added")
+}
+
+func TestGetTree(t *testing.T) {
+	root := "user:/tests/elektrad/kdbtree/get"
+
+	w := testPut(t, "/kdbTree/"+root, map[string]interface{}{
+		"server": map[string]interface{}{
+			"hosts": []string{"a", "b"},
+			"port":  "80",
+		},
+	})
+
+	code := w.Result().StatusCode
+	Assertf(t, code == http.StatusNoContent, "wrong status code: %v", code)
+
+	w = testGet(t, "/kdbTree/"+root)
+	removeTree(t, root)
+
+	code = w.Result().StatusCode
+	Assertf(t, code == http.StatusOK, "wrong status code: %v", code)
+
+	var result struct {
+		Server struct {
+			Hosts []string `json:"hosts"`
+			Port  string   `json:"port"`
+		} `json:"server"`
+	}
+
+	parseBody(t, w, &result)
+
+	CompareStrings(t, []string{"a", "b"}, result.Server.Hosts, "array is wrong")
+	Assertf(t, result.Server.Port == "80", "wrong port %q", result.Server.Port)
+}
+
+func TestPutTreeBinaryRoundTrip(t *testing.T) {
+	root := "user:/tests/elektrad/kdbtree/binary"
+
+	removeTree(t, root)
+	defer removeTree(t, root)
+
+	w := testPut(t, "/kdb/"+root+"/bin?binary=true", "/wAB")
+	Assertf(t, w.Code == http.StatusCreated, "could not create binary key: %v", w.Code)
+
+	w = testPut(t, "/kdb/"+root+"/str", "x")
+	Assertf(t, w.Code == http.StatusCreated, "could not create key: %v", w.Code)
+
+	for _, query := range []string{"", "?meta=true"} {
+		w = testGet(t, "/kdbTree/"+root+query)
+		Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+
+		var tree map[string]interface{}
+		parseBody(t, w, &tree)
+
+		w = testPut(t, "/kdbTree/"+root, tree)
+		Assertf(t, w.Code == http.StatusNoContent, "could not write tree %v: %v", tree, w.Code)
+
+		k := getKey(t, root+"/bin")
+		Assert(t, k != nil, "binary key was removed")
+		Assertf(t, isBinary(k), "key is not binary after round trip %q", query)
+		Assertf(t, bytes.Equal(k.Bytes(), []byte{0xff, 0x00, 0x01}), "wrong value %v after round trip %q", k.Bytes(), query)
+	}
+
+	w = testPut(t, "/kdbTree/"+root, map[string]interface{}{"bin": "not base64!"})
+	Assertf(t, w.Code == http.StatusBadRequest, "invalid binary value was accepted: %v", w.Code)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+// hexnumberMeta is set by the hexnumber plugin on keys it converted to
+// decimal, the plugin converts them back to hexadecimal on kdbSet.
+const hexnumberMeta = "internal/hexnumber/ishex"
+
+var (
+	trueValues  = []string{"1", "yes", "on", "true", "enabled", "enable"}
+	falseValues = []string{"0", "no", "off", "false", "disabled", "disable"}
+)
+
+type integerRange struct {
+	unsigned bool
+	bits     int
+}
+
+// integerTypes maps the integer types of the type plugin to their range,
+// see `doc/METADATA.ini`.
+var integerTypes = map[string]integerRange{
+	"short":              {unsigned: false, bits: 16},
+	"unsigned_short":     {unsigned: true, bits: 16},
+	"long":               {unsigned: false, bits: 32},
+	"unsigned_long":      {unsigned: true, bits: 32},
+	"long_long":          {unsigned: false, bits: 64},
+	"unsigned_long_long": {unsigned: true, bits: 64},
+	"octet":              {unsigned: true, bits: 8},
+}
+
+var floatTypes = map[string]int{
+	"float":       32,
+	"double":      64,
+	"long_double": 64,
+}
+
+func parseTyped(r *http.Request) bool {
+	typed, _ := strconv.ParseBool(r.URL.Query().Get("typed"))
+
+	return typed
+}
+
+func jsonBody(r *http.Request) (interface{}, error) {
+	var value interface{}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+// keyType returns the `type` of a key. If the key itself is not typed the
+// type of the corresponding key in the `spec` namespace is used.
+func keyType(ks elektra.KeySet, key elektra.Key) string {
+	if t := metaType(key); t != "" {
+		return t
+	}
+
+	if specKey := ks.LookupByName("spec:" + cascadingName(key.Name())); specKey != nil {
+		return metaType(specKey)
+	}
+
+	return ""
+}
+
+func metaType(key elektra.Key) string {
+	if t := key.Meta("type"); t != "" {
+		return t
+	}
+
+	return key.Meta("check/type")
+}
+
+// cascadingName strips the namespace from a key name.
+func cascadingName(name string) string {
+	if i := strings.Index(name, ":/"); i >= 0 {
+		return name[i+1:]
+	}
+
+	return name
+}
+
+// typedValue converts the value of a key to a boolean, number or nil
+// according to its type.
+func typedValue(key elektra.Key, typeName string) (interface{}, error) {
+	return parseTypedString(key, typeName, key.String())
+}
+
+// parseTypedString converts `value` to a boolean, number or nil according to
+// the type of `key`.
+func parseTypedString(key elektra.Key, typeName string, value string) (interface{}, error) {
+	if value == "" && typeName != "" && !isStringType(typeName) {
+		return nil, nil
+	}
+
+	if typeName == "boolean" {
+		if key.Meta("check/boolean/true") == value {
+			return true, nil
+		}
+
+		if key.Meta("check/boolean/false") == value {
+			return false, nil
+		}
+
+		if containsFold(trueValues, value) {
+			return true, nil
+		}
+
+		if containsFold(falseValues, value) {
+			return false, nil
+		}
+
+		return nil, fmt.Errorf("invalid boolean value %q of key %s", value, key.Name())
+	}
+
+	if r, ok := integerTypes[typeName]; ok {
+		base, digits := integerBase(value)
+
+		if r.unsigned {
+			i, err := strconv.ParseUint(digits, base, r.bits)
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value %q of key %s", typeName, value, key.Name())
+			}
+
+			return i, nil
+		}
+
+		i, err := strconv.ParseInt(digits, base, r.bits)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q of key %s", typeName, value, key.Name())
+		}
+
+		return i, nil
+	}
+
+	if bits, ok := floatTypes[typeName]; ok {
+		f, err := strconv.ParseFloat(value, bits)
+
+		if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("invalid %s value %q of key %s", typeName, value, key.Name())
+		}
+
+		return f, nil
+	}
+
+	return value, nil
+}
+
+// integerBase returns the base and the digits of an integer value. Integers
+// are decimal, except for the `0x` prefixed values of the hexnumber plugin.
+func integerBase(value string) (int, string) {
+	for _, prefix := range []string{"0x", "0X"} {
+		if strings.HasPrefix(value, prefix) {
+			return 16, strings.TrimPrefix(value, prefix)
+		}
+	}
+
+	return 10, value
+}
+
+// typedToString converts a decoded JSON value to the canonical string
+// representation of the key's type. Values that are incompatible with the
+// type are rejected.
+func typedToString(key elektra.Key, typeName string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+
+	case string:
+		// the type plugin is not mounted in every backend
+		if _, err := parseTypedString(key, typeName, v); err != nil {
+			return "", err
+		}
+
+		return v, nil
+
+	case bool:
+		if typeName != "" && typeName != "boolean" && typeName != "any" {
+			return "", fmt.Errorf("boolean is incompatible with type %s of key %s", typeName, key.Name())
+		}
+
+		if v {
+			return "1", nil
+		}
+
+		return "0", nil
+
+	case json.Number:
+		if r, ok := integerTypes[typeName]; ok {
+			return formatInteger(key, typeName, r, v)
+		}
+
+		if bits, ok := floatTypes[typeName]; ok {
+			f, err := strconv.ParseFloat(v.String(), bits)
+
+			if err != nil {
+				return "", fmt.Errorf("%s is not a valid %s", v, typeName)
+			}
+
+			return strconv.FormatFloat(f, 'g', -1, bits), nil
+		}
+
+		if typeName != "" && typeName != "any" {
+			return "", fmt.Errorf("number is incompatible with type %s of key %s", typeName, key.Name())
+		}
+
+		return v.String(), nil
+
+	default:
+		return "", fmt.Errorf("%T can not be stored in key %s", value, key.Name())
+	}
+}
+
+func formatInteger(key elektra.Key, typeName string, r integerRange, n json.Number) (string, error) {
+	var u uint64
+
+	if r.unsigned {
+		i, err := strconv.ParseUint(n.String(), 10, r.bits)
+
+		if err != nil {
+			return "", fmt.Errorf("%s is not a valid %s", n, typeName)
+		}
+
+		u = i
+	} else {
+		i, err := strconv.ParseInt(n.String(), 10, r.bits)
+
+		if err != nil {
+			return "", fmt.Errorf("%s is not a valid %s", n, typeName)
+		}
+
+		if i < 0 {
+			return strconv.FormatInt(i, 10), nil
+		}
+
+		u = uint64(i)
+	}
+
+	// the hexnumber plugin converts decimal values back to hexadecimal if
+	// it is mounted, otherwise we have to write the hexadecimal form
+	if key.Meta("unit/base") == "hex" && key.Meta(hexnumberMeta) == "" {
+		return "0x" + strconv.FormatUint(u, 16), nil
+	}
+
+	return strconv.FormatUint(u, 10), nil
+}
+
+func isStringType(typeName string) bool {
+	_, isInteger := integerTypes[typeName]
+	_, isFloat := floatTypes[typeName]
+
+	return typeName != "boolean" && !isInteger && !isFloat
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	elektra "go.libelektra.org/kdb"
+)
+
+func TestTypedToString(t *testing.T) {
+	tests := []struct {
+		typeName string
+		meta     map[string]string
+		value    interface{}
+		expected string
+		fails    bool
+	}{
+		{typeName: "boolean", value: false, expected: "0"},
+		{typeName: "boolean", value: json.Number("1"), fails: true},
+		{typeName: "long", value: json.Number("-12"), expected: "-12"},
+		{typeName: "long", value: json.Number("1.5"), fails: true},
+		{typeName: "short", value: json.Number("40000"), fails: true},
+		{typeName: "unsigned_long", value: json.Number("-1"), fails: true},
+		{typeName: "unsigned_long", meta: map[string]string{"unit/base": "hex"}, value: json.Number("31"), expected: "0x1f"},
+		{typeName: "unsigned_long", meta: map[string]string{"unit/base": "hex", hexnumberMeta: "1"}, value: json.Number("31"), expected: "31"},
+		{typeName: "double", value: json.Number("0.5"), expected: "0.5"},
+		{typeName: "string", value: true, fails: true},
+		{typeName: "", value: json.Number("7"), expected: "7"},
+		{typeName: "long", value: nil, expected: ""},
+		{typeName: "long", value: []interface{}{}, fails: true},
+		{typeName: "long", value: "abc", fails: true},
+		{typeName: "long", value: "0x1f", expected: "0x1f"},
+		{typeName: "unsigned_short", value: "-1", fails: true},
+		{typeName: "double", value: "1.5", expected: "1.5"},
+		{typeName: "double", value: "NaN", fails: true},
+		{typeName: "boolean", value: "maybe", fails: true},
+		{typeName: "boolean", value: "on", expected: "on"},
+		{typeName: "string", value: "abc", expected: "abc"},
+	}
+
+	for _, test := range tests {
+		key, err := elektra.NewKey("user:/tests/elektrad/typed")
+		Check(t, err, "could not create key")
+
+		for name, value := range test.meta {
+			Check(t, key.SetMeta(name, value), "could not set meta")
+		}
+
+		result, err := typedToString(key, test.typeName, test.value)
+
+		if test.fails {
+			Assertf(t, err != nil, "%s %#v should be rejected", test.typeName, test.value)
+		} else {
+			Checkf(t, err, "%s %#v: %v", test.typeName, test.value, err)
+			Assertf(t, result == test.expected, "%s %#v: expected %q, got %q", test.typeName, test.value, test.expected, result)
+		}
+	}
+}
+
+func TestTypedValueInvalidInteger(t *testing.T) {
+	for _, value := range []string{"1_000", "0b101", "0o17", "0x", "12a"} {
+		key, err := elektra.NewKey("user:/tests/elektrad/typed", value)
+		Check(t, err, "could not create key")
+
+		_, err = typedValue(key, "long")
+		Assertf(t, err != nil, "invalid long %q was accepted", value)
+	}
+}
+
+func TestTypedValue(t *testing.T) {
+	tests := []struct {
+		typeName string
+		value    string
+		expected interface{}
+	}{
+		{typeName: "boolean", value: "1", expected: true},
+		{typeName: "boolean", value: "off", expected: false},
+		{typeName: "long", value: "0x1F", expected: int64(31)},
+		{typeName: "unsigned_short", value: "8080", expected: uint64(8080)},
+		{typeName: "long", value: "010", expected: int64(10)},
+		{typeName: "unsigned_long", value: "0XfF", expected: uint64(255)},
+		{typeName: "float", value: "2.5", expected: 2.5},
+		{typeName: "long", value: "", expected: nil},
+		{typeName: "string", value: "", expected: ""},
+	}
+
+	for _, test := range tests {
+		key, err := elektra.NewKey("user:/tests/elektrad/typed", test.value)
+		Check(t, err, "could not create key")
+
+		result, err := typedValue(key, test.typeName)
+		Checkf(t, err, "%s %q: %v", test.typeName, test.value, err)
+		Assertf(t, result == test.expected, "%s %q: expected %#v, got %#v", test.typeName, test.value, test.expected, result)
+	}
+}
@@ -0,0 +1,581 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ElektraInitiative/libelektra/elektrad/elektradpb"
+	"github.com/google/uuid"
+	elektra "go.libelektra.org/kdb"
+)
+
+const (
+	// webhookQueueSize is the count of deliveries a webhook can queue,
+	// further deliveries are dead-lettered.
+	webhookQueueSize = 100
+	webhookTimeout   = 10 * time.Second
+)
+
+// webhooks is notified of successful mutations, nil if webhooks are
+// disabled.
+var webhooks *webhookDispatcher
+
+// webhookRoot is the key containing the webhooks, empty if webhooks are
+// disabled. The secrets of the webhooks are hidden from the handles serving
+// clients.
+var webhookRoot string
+
+// webhook POSTs the changes below `key` to `url`. It is configured with the
+// keys `url`, `key` and `secret` below the key `<root>/<name>`. The `secret`
+// can be written but not read by clients.
+type webhook struct {
+	name   string
+	url    string
+	key    string
+	secret string
+}
+
+type webhookPayload struct {
+	Webhook string          `json:"webhook"`
+	Key     string          `json:"key"`
+	Time    time.Time       `json:"time"`
+	Changes []webhookChange `json:"changes"`
+}
+
+// webhookChange is a changed key, the value of binary keys is base64
+// encoded.
+type webhookChange struct {
+	Type   string            `json:"type"`
+	Name   string            `json:"name"`
+	Value  string            `json:"value,omitempty"`
+	Binary bool              `json:"binary,omitempty"`
+	Meta   map[string]string `json:"meta,omitempty"`
+}
+
+type webhookDelivery struct {
+	id   string
+	hook webhook
+	body []byte
+}
+
+// webhookState is the state of the keys of a webhook when they were last
+// checked.
+type webhookState struct {
+	key  string
+	keys map[string]*elektradpb.Key
+}
+
+// webhookDispatcher checks the keys of all webhooks for changes after
+// mutations and delivers the changes.
+type webhookDispatcher struct {
+	// root is the key containing the webhooks
+	root   string
+	handle *handle
+	client *http.Client
+	// hosts are the hosts webhooks may be delivered to, empty allows all
+	hosts   []string
+	retries int
+	// backoff is the delay before the first retry, it doubles with every
+	// retry
+	backoff time.Duration
+
+	notify chan struct{}
+	states map[string]webhookState
+
+	mut        sync.Mutex
+	queues     map[string]chan webhookDelivery
+	deadLetter io.Writer
+}
+
+func newWebhookDispatcher(root string, hosts []string, retries int, backoff time.Duration, deadLetter io.Writer) (*webhookDispatcher, error) {
+	var h *handle
+
+	err := resolverContext{}.inContext(func() error {
+		kdb, err := backend.open()
+
+		if err != nil {
+			return err
+		}
+
+		// unlike the handles of the clients, the dispatcher reads the secrets
+		h, err = openHandleWith(kdb)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	d := &webhookDispatcher{
+		root:   root,
+		handle: h,
+		client: &http.Client{
+			Timeout: webhookTimeout,
+			// a redirect could lead to a host that is not allowed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		hosts:      hosts,
+		retries:    retries,
+		backoff:    backoff,
+		notify:     make(chan struct{}, 1),
+		states:     map[string]webhookState{},
+		queues:     map[string]chan webhookDelivery{},
+		deadLetter: deadLetter,
+	}
+
+	// the current keys are the baseline of the first changes
+	d.check()
+
+	return d, nil
+}
+
+// changed notifies the dispatcher of a mutation, it does not block.
+func (d *webhookDispatcher) changed() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+		// a check is already pending
+	}
+}
+
+// run checks the webhooks after every notification.
+func (d *webhookDispatcher) run() {
+	for range d.notify {
+		d.check()
+	}
+}
+
+// check delivers the changes of all webhooks since the last check.
+func (d *webhookDispatcher) check() {
+	hooks, err := d.load()
+
+	if err != nil {
+		log.Printf("webhooks: could not load webhooks: %v", err)
+		return
+	}
+
+	states := map[string]webhookState{}
+
+	for _, hook := range hooks {
+		key, err := elektra.NewKey(hook.key)
+
+		if err != nil {
+			log.Printf("webhooks: invalid key %q of webhook %s", hook.key, hook.name)
+			continue
+		}
+
+		keys, err := snapshot(d.handle, key)
+		key.Close()
+
+		if err != nil {
+			log.Printf("webhooks: could not get keys of webhook %s: %v", hook.name, err)
+			continue
+		}
+
+		for name := range keys {
+			if isWebhookSecret(d.root, name) {
+				delete(keys, name)
+			}
+		}
+
+		states[hook.name] = webhookState{key: hook.key, keys: keys}
+
+		prev, ok := d.states[hook.name]
+
+		if !ok || prev.key != hook.key {
+			continue
+		}
+
+		if events := changes(prev.keys, keys); len(events) > 0 {
+			d.enqueue(hook, events)
+		}
+	}
+
+	d.states = states
+}
+
+// load reads the configured webhooks.
+func (d *webhookDispatcher) load() ([]webhook, error) {
+	rootKey, err := elektra.NewKey(d.root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rootKey.Close()
+
+	ks := d.handle.keySet
+
+	if _, err = d.handle.kdb.Get(ks, rootKey); err != nil {
+		return nil, err
+	}
+
+	value := func(name string) string {
+		if k := ks.LookupByName(name); k != nil {
+			return k.String()
+		}
+
+		return ""
+	}
+
+	var hooks []webhook
+
+	seen := map[string]bool{}
+
+	for _, k := range ks.ToSlice() {
+		if !k.IsBelow(rootKey) {
+			continue
+		}
+
+		// the key of the webhook itself does not need to exist
+		name := splitKeyName(relativeKeyName(rootKey.Name(), k.Name()))[0]
+
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		hookName := rootKey.Name() + "/" + escapeKeyNamePart(name)
+
+		hook := webhook{
+			name:   name,
+			url:    value(hookName + "/url"),
+			key:    value(hookName + "/key"),
+			secret: value(hookName + "/secret"),
+		}
+
+		if hook.url == "" || hook.key == "" {
+			log.Printf("webhooks: webhook %s needs an url and a key", hook.name)
+			continue
+		}
+
+		if err := validateWebhookURL(hook.url, d.hosts); err != nil {
+			log.Printf("webhooks: webhook %s: %v", hook.name, err)
+			continue
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, nil
+}
+
+// validateWebhookURL checks that webhooks may be delivered to `rawURL`: it
+// must be an http or https URL of one of the `hosts`, if there are any.
+func validateWebhookURL(rawURL string, hosts []string) error {
+	u, err := url.Parse(rawURL)
+
+	if err != nil {
+		return err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s is not an http or https URL", rawURL)
+	}
+
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	for _, host := range hosts {
+		if strings.EqualFold(u.Hostname(), strings.TrimSpace(host)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("webhooks may not be delivered to %s", u.Hostname())
+}
+
+func (d *webhookDispatcher) enqueue(hook webhook, events []*elektradpb.WatchEvent) {
+	payload := webhookPayload{
+		Webhook: hook.name,
+		Key:     hook.key,
+		Time:    time.Now().UTC(),
+	}
+
+	for _, event := range events {
+		change := webhookChange{
+			Type:   webhookChangeType(event.Type),
+			Name:   event.Key.Name,
+			Binary: event.Key.Binary,
+			Meta:   event.Key.Meta,
+		}
+
+		if change.Binary {
+			change.Value = base64.StdEncoding.EncodeToString(event.Key.Value)
+		} else {
+			change.Value = string(event.Key.Value)
+		}
+
+		payload.Changes = append(payload.Changes, change)
+	}
+
+	sort.Slice(payload.Changes, func(i, j int) bool {
+		return payload.Changes[i].Name < payload.Changes[j].Name
+	})
+
+	body, _ := json.Marshal(payload)
+
+	delivery := webhookDelivery{
+		id:   uuid.New().String(),
+		hook: hook,
+		body: body,
+	}
+
+	d.mut.Lock()
+	queue, ok := d.queues[hook.name]
+
+	if !ok {
+		queue = make(chan webhookDelivery, webhookQueueSize)
+		d.queues[hook.name] = queue
+
+		go d.deliverAll(queue)
+	}
+	d.mut.Unlock()
+
+	select {
+	case queue <- delivery:
+	default:
+		d.writeDeadLetter(delivery, errors.New("the delivery queue is full"))
+	}
+}
+
+func webhookChangeType(t elektradpb.WatchEvent_Type) string {
+	switch t {
+	case elektradpb.WatchEvent_CREATED:
+		return "created"
+	case elektradpb.WatchEvent_DELETED:
+		return "deleted"
+	}
+
+	return "updated"
+}
+
+// deliverAll delivers the deliveries of a webhook in order.
+func (d *webhookDispatcher) deliverAll(queue chan webhookDelivery) {
+	for delivery := range queue {
+		d.deliver(delivery)
+	}
+}
+
+// deliver POSTs a delivery, failed deliveries are retried with exponential
+// backoff and written to the dead-letter log after the last retry.
+func (d *webhookDispatcher) deliver(delivery webhookDelivery) {
+	backoff := d.backoff
+
+	for attempt := 0; ; attempt++ {
+		err := d.post(delivery)
+
+		if err == nil {
+			return
+		}
+
+		if attempt >= d.retries {
+			d.writeDeadLetter(delivery, err)
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (d *webhookDispatcher) post(delivery webhookDelivery) error {
+	req, err := http.NewRequest("POST", delivery.hook.url, bytes.NewReader(delivery.body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Elektrad-Delivery", delivery.id)
+
+	if delivery.hook.secret != "" {
+		req.Header.Set("X-Elektrad-Signature", webhookSignature(delivery.hook.secret, delivery.body))
+	}
+
+	resp, err := d.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// webhookSignature returns the `X-Elektrad-Signature` header, the hex encoded
+// HMAC-SHA256 of the body.
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeDeadLetter writes an undeliverable delivery as JSON line to the
+// dead-letter log.
+func (d *webhookDispatcher) writeDeadLetter(delivery webhookDelivery, err error) {
+	line, _ := json.Marshal(struct {
+		Time     time.Time       `json:"time"`
+		Webhook  string          `json:"webhook"`
+		URL      string          `json:"url"`
+		Delivery string          `json:"delivery"`
+		Error    string          `json:"error"`
+		Payload  json.RawMessage `json:"payload"`
+	}{
+		Time:     time.Now().UTC(),
+		Webhook:  delivery.hook.name,
+		URL:      delivery.hook.url,
+		Delivery: delivery.id,
+		Error:    err.Error(),
+		Payload:  delivery.body,
+	})
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	if _, err = d.deadLetter.Write(append(line, '\n')); err != nil {
+		log.Printf("webhooks: could not write dead letter of webhook %s: %v", delivery.hook.name, err)
+	}
+}
+
+// isWebhookSecret checks if `name` is the `secret` key of a webhook below
+// `root`. The namespaces of the names are ignored.
+func isWebhookSecret(root, name string) bool {
+	prefix := strings.TrimSuffix(cascadingName(root), "/") + "/"
+	name = cascadingName(name)
+
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+
+	parts := splitKeyName(name[len(prefix):])
+
+	return len(parts) == 2 && parts[1] == "secret"
+}
+
+// secretHidingKDB removes the secrets of the webhooks from the fetched keys,
+// so that clients can not read them. They are kept aside and stored again
+// with the other keys, unless the client replaced the secret or removed its
+// webhook.
+type secretHidingKDB struct {
+	elektra.KDB
+
+	root    string
+	secrets map[string]elektra.Key
+}
+
+// hideWebhookSecrets returns `kdb` wrapped by a secretHidingKDB if webhooks
+// are enabled.
+func hideWebhookSecrets(kdb elektra.KDB) elektra.KDB {
+	if webhookRoot == "" {
+		return kdb
+	}
+
+	return &secretHidingKDB{
+		KDB:     kdb,
+		root:    webhookRoot,
+		secrets: map[string]elektra.Key{},
+	}
+}
+
+func (h *secretHidingKDB) Get(ks elektra.KeySet, parentKey elektra.Key) (bool, error) {
+	changed, err := h.KDB.Get(ks, parentKey)
+
+	if err != nil {
+		return changed, err
+	}
+
+	if changed {
+		// the secrets were fetched again if they still exist
+		for name, k := range h.secrets {
+			if k.IsBelowOrSame(parentKey) {
+				delete(h.secrets, name)
+			}
+		}
+	}
+
+	h.hide(ks)
+
+	return changed, nil
+}
+
+func (h *secretHidingKDB) Set(ks elektra.KeySet, parentKey elektra.Key) (bool, error) {
+	h.restore(ks)
+
+	changed, err := h.KDB.Set(ks, parentKey)
+
+	h.hide(ks)
+
+	return changed, err
+}
+
+// hide moves the secrets from `ks` to `h.secrets`.
+func (h *secretHidingKDB) hide(ks elektra.KeySet) {
+	for _, k := range ks.ToSlice() {
+		if isWebhookSecret(h.root, k.Name()) {
+			h.secrets[k.Name()] = ks.Remove(k)
+		}
+	}
+}
+
+// restore adds the hidden secrets to `ks` whose webhook still has keys.
+func (h *secretHidingKDB) restore(ks elektra.KeySet) {
+	for name, secret := range h.secrets {
+		if ks.LookupByName(name) != nil {
+			// the client set a new secret
+			continue
+		}
+
+		if !hasWebhookKeys(ks, strings.TrimSuffix(name, "/secret")) {
+			delete(h.secrets, name)
+			continue
+		}
+
+		ks.AppendKey(secret)
+	}
+}
+
+// hasWebhookKeys checks if there are keys below the key of a webhook.
+func hasWebhookKeys(ks elektra.KeySet, hookName string) bool {
+	hookKey, err := elektra.NewKey(hookName)
+
+	if err != nil {
+		return false
+	}
+
+	defer hookKey.Close()
+
+	for _, k := range ks.ToSlice() {
+		if k.IsBelow(hookKey) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const webhookTestRoot = "user:/tests/elektrad/webhooks"
+
+// syncBuffer is a bytes.Buffer that can be written and read concurrently.
+type syncBuffer struct {
+	mut sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+
+	return b.buf.String()
+}
+
+func setupWebhook(t *testing.T, name, url string) {
+	t.Helper()
+
+	w := testPut(t, "/kdbTree/"+webhookTestRoot+"/config/"+name, map[string]string{
+		"url":    url,
+		"key":    webhookTestRoot + "/data",
+		"secret": "secret",
+	})
+	Assertf(t, w.Code == http.StatusNoContent, "could not create webhook: %v", w.Code)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	removeTree(t, webhookTestRoot)
+	defer removeTree(t, webhookTestRoot)
+
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+
+	requests := make(chan request, 10)
+	failures := 1
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		requests <- request{r.Header, body}
+	}))
+	defer s.Close()
+
+	setupWebhook(t, "deploy", s.URL)
+
+	d, err := newWebhookDispatcher(webhookTestRoot+"/config", nil, 2, time.Millisecond, &syncBuffer{})
+	Check(t, err, "could not create dispatcher")
+
+	w := testPut(t, "/kdb/"+webhookTestRoot+"/data/port", "8080")
+	Assertf(t, w.Code == http.StatusCreated, "could not create key: %v", w.Code)
+
+	d.check()
+
+	select {
+	case r := <-requests:
+		signature := r.header.Get("X-Elektrad-Signature")
+		Assertf(t, signature == webhookSignature("secret", r.body), "wrong signature %s", signature)
+
+		var payload webhookPayload
+		err = json.Unmarshal(r.body, &payload)
+		Check(t, err, "invalid payload")
+
+		Assertf(t, payload.Webhook == "deploy", "wrong webhook %s", payload.Webhook)
+		Assertf(t, len(payload.Changes) == 1, "expected 1 change, got %d", len(payload.Changes))
+
+		change := payload.Changes[0]
+		Assertf(t, change.Type == "created", "wrong change type %s", change.Type)
+		Assertf(t, change.Name == webhookTestRoot+"/data/port", "wrong key %s", change.Name)
+		Assertf(t, change.Value == "8080", "wrong value %s", change.Value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook was not delivered")
+	}
+
+	// no changes, no delivery
+	d.check()
+
+	select {
+	case r := <-requests:
+		t.Fatalf("unexpected delivery %s", r.body)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestWebhookDeadLetter(t *testing.T) {
+	removeTree(t, webhookTestRoot)
+	defer removeTree(t, webhookTestRoot)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer s.Close()
+
+	setupWebhook(t, "failing", s.URL)
+
+	deadLetter := &syncBuffer{}
+
+	d, err := newWebhookDispatcher(webhookTestRoot+"/config", nil, 1, time.Millisecond, deadLetter)
+	Check(t, err, "could not create dispatcher")
+
+	setupKey(t, webhookTestRoot+"/data/key")
+
+	d.check()
+
+	for i := 0; i < 500 && deadLetter.String() == ""; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	line := deadLetter.String()
+	Assertf(t, strings.Contains(line, `"webhook":"failing"`), "wrong dead letter %s", line)
+	Assertf(t, strings.Contains(line, "500 Internal Server Error"), "wrong dead letter %s", line)
+}
+
+func TestWebhookSecretHidden(t *testing.T) {
+	removeTree(t, webhookTestRoot)
+	defer removeTree(t, webhookTestRoot)
+
+	webhookRoot = webhookTestRoot + "/config"
+	defer func() { webhookRoot = "" }()
+
+	hook := webhookTestRoot + "/config/deploy"
+
+	setupWebhook(t, "deploy", "http://localhost/hook")
+
+	w := testGet(t, "/kdb/"+hook+"/secret")
+
+	var response lookupResult
+	parseBody(t, w, &response)
+	Assert(t, !response.Exists, "the secret is readable")
+
+	w = testGet(t, "/kdbTree/"+hook)
+	Assertf(t, w.Code == http.StatusOK, "wrong status code: %v", w.Code)
+	Assertf(t, !strings.Contains(w.Body.String(), "secret"), "the secret is readable: %s", w.Body.String())
+
+	// other writes keep the secret
+	w = testPut(t, "/kdb/"+hook+"/url", "http://localhost/other")
+	Assertf(t, w.Code == http.StatusOK, "could not set url: %v", w.Code)
+
+	secret := getKey(t, hook+"/secret")
+	Assert(t, secret != nil && secret.String() == "secret", "the secret was not kept")
+
+	// the secret can be replaced
+	w = testPut(t, "/kdb/"+hook+"/secret", "new")
+	Assertf(t, w.Code == http.StatusOK || w.Code == http.StatusCreated, "could not set secret: %v", w.Code)
+
+	secret = getKey(t, hook+"/secret")
+	Assert(t, secret != nil && secret.String() == "new", "the secret was not replaced")
+
+	// removing the webhook removes the secret
+	w = testDelete(t, "/kdb/"+hook+"?recursive=true", nil)
+	Assertf(t, w.Code == http.StatusNoContent, "could not remove webhook: %v", w.Code)
+
+	Assert(t, getKey(t, hook+"/secret") == nil, "the secret of the removed webhook was kept")
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	Check(t, validateWebhookURL("https://deploy.example.com/hook", nil), "valid URL rejected")
+	Check(t, validateWebhookURL("https://deploy.example.com/hook", []string{"other.example.com", "Deploy.example.com"}), "allowed host rejected")
+
+	Assert(t, validateWebhookURL("file:///etc/passwd", nil) != nil, "file URL accepted")
+	Assert(t, validateWebhookURL("http:///hook", nil) != nil, "URL without host accepted")
+	Assert(t, validateWebhookURL("http://169.254.169.254/latest", []string{"deploy.example.com"}) != nil, "host that is not allowed accepted")
+}
@@ -86,12 +86,8 @@ const setmeta = (host, path, key, value) =>
   });
 
 const rmmeta = (host, path, key) =>
-  fetch(`${host}/kdbMeta/${encodePath(path)}`, {
+  fetch(`${host}/kdbMeta/${encodePath(path)}/meta:/${encodePath(key)}`, {
     method: "DELETE",
-    headers: {
-      "Content-Type": "application/json",
-    },
-    body: JSON.stringify({ key }),
   }).then((res) => {
     return { status: res.status };
   });